@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ecomz/backend/libs/utils"
@@ -13,17 +15,28 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	Redis    RedisConfig
+	Auth     AuthConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
+	OAuth    OAuthConfig
+	Password PasswordConfig
+	Catalog  CatalogConfig
 }
 
 type AppConfig struct {
 	Name string
 	Port string
+	// TrustProxyHeaders takes the client IP from the X-Real-IP header set by
+	// the reverse proxy. Only enable it when the service is not reachable
+	// directly.
+	TrustProxyHeaders bool
 }
 
 func getAppConfig() AppConfig {
 	return AppConfig{
-		Name: utils.GetStringOrPanic("APP_NAME"),
-		Port: utils.GetStringOrPanic("HTTP_PORT"),
+		Name:              utils.GetStringOrPanic("APP_NAME"),
+		Port:              utils.GetStringOrPanic("HTTP_PORT"),
+		TrustProxyHeaders: utils.GetBoolOrDefault("TRUST_PROXY_HEADERS", false),
 	}
 }
 
@@ -46,16 +59,32 @@ func getDatabaseConfig() DatabaseConfig {
 }
 
 type JWTConfig struct {
+	// SecretKey is only required when SigningAlg is HS256.
 	SecretKey  string
 	LoginExp   time.Duration
 	RefreshExp time.Duration
+	// SigningAlg is one of HS256, RS256 or EdDSA.
+	SigningAlg  string
+	KeyRotation time.Duration
+	// KeyEncryptionKey encrypts the private signing keys at rest. It is
+	// required unless SigningAlg is HS256.
+	KeyEncryptionKey string
+	// JWKSURL is used by services that verify tokens issued by auth-service
+	// with asymmetric keys instead of a shared secret.
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
 }
 
 func getJWTConfig() JWTConfig {
 	return JWTConfig{
-		SecretKey:  utils.GetStringOrPanic("JWT_SECRET_KEY"),
-		LoginExp:   time.Duration(utils.GetIntOrDefault("JWT_LOGIN_EXP", 24)) * time.Hour,
-		RefreshExp: time.Duration(utils.GetIntOrDefault("JWT_REFRESH_EXP", 7)) * 24 * time.Hour,
+		SecretKey:        utils.GetStringOrDefault("JWT_SECRET_KEY", ""),
+		LoginExp:         time.Duration(utils.GetIntOrDefault("JWT_LOGIN_EXP", 24)) * time.Hour,
+		RefreshExp:       time.Duration(utils.GetIntOrDefault("JWT_REFRESH_EXP", 7)) * 24 * time.Hour,
+		SigningAlg:       utils.GetStringOrDefault("JWT_SIGNING_ALG", "HS256"),
+		KeyRotation:      time.Duration(utils.GetIntOrDefault("JWT_KEY_ROTATION", 30)) * 24 * time.Hour,
+		KeyEncryptionKey: utils.GetStringOrDefault("JWT_KEY_ENCRYPTION_KEY", ""),
+		JWKSURL:          utils.GetStringOrDefault("JWT_JWKS_URL", ""),
+		JWKSCacheTTL:     time.Duration(utils.GetIntOrDefault("JWT_JWKS_CACHE_TTL", 15)) * time.Minute,
 	}
 }
 
@@ -75,6 +104,265 @@ func getRedisConfig() RedisConfig {
 	}
 }
 
+type AuthConfig struct {
+	DefaultRole string
+	// PasswordResetURL is the frontend page that receives the reset token as
+	// a "token" query parameter.
+	PasswordResetURL string
+	PasswordResetExp time.Duration
+	// EmailVerificationURL is the frontend page that receives the
+	// verification token as a "token" query parameter.
+	EmailVerificationURL            string
+	EmailVerificationExp            time.Duration
+	EmailVerificationResendInterval time.Duration
+	// RequireVerifiedEmail blocks login until the email is verified.
+	RequireVerifiedEmail bool
+	// VerifiedEmailPermissions are withheld from tokens of users whose email
+	// is not verified yet.
+	VerifiedEmailPermissions []string
+	// MFAEncryptionKey encrypts TOTP secrets at rest. MFA enrollment is
+	// refused while it is empty.
+	MFAEncryptionKey string
+	MFAIssuer        string
+	MFAChallengeExp  time.Duration
+	// MFASkew is the number of 30 second steps a TOTP code may be early or
+	// late.
+	MFASkew int
+	// LoginFailureWindow is how long failed logins are counted for.
+	LoginFailureWindow time.Duration
+	// LoginDelayAfter is the number of failures on an account after which
+	// every further failure locks it for LoginDelayBase, doubling each time.
+	LoginDelayAfter int
+	LoginDelayBase  time.Duration
+	// LoginMaxFailures and LoginIPMaxFailures lock the account or client IP
+	// for LoginLockoutDuration.
+	LoginMaxFailures     int
+	LoginIPMaxFailures   int
+	LoginLockoutDuration time.Duration
+	// MagicLinkEnabled allows passwordless login with links mailed to the
+	// user. MagicLinkURL is the frontend page that receives the token as a
+	// "token" query parameter.
+	MagicLinkEnabled bool
+	MagicLinkURL     string
+	MagicLinkExp     time.Duration
+	// MagicLinkMaxRequests is the number of links that may be requested for
+	// an address within MagicLinkWindow.
+	MagicLinkMaxRequests int
+	MagicLinkWindow      time.Duration
+	// ImpersonationExp is the lifetime of the access token an administrator
+	// impersonates a user with. ImpersonationPermissions are the only
+	// permissions of the user that token carries.
+	ImpersonationExp         time.Duration
+	ImpersonationPermissions []string
+	// OrganizationInvitationURL is the frontend page that receives the
+	// invitation token as a "token" query parameter.
+	OrganizationInvitationURL string
+	OrganizationInvitationExp time.Duration
+	// DataExportExp is how long a personal data export can be downloaded.
+	// Data requests are picked up every DataRequestPollInterval and retried
+	// once they have been running for DataRequestTimeout.
+	DataExportExp           time.Duration
+	DataRequestPollInterval time.Duration
+	DataRequestTimeout      time.Duration
+}
+
+func getAuthConfig() AuthConfig {
+	return AuthConfig{
+		DefaultRole:      utils.GetStringOrDefault("DEFAULT_ROLE", "customer"),
+		PasswordResetURL: utils.GetStringOrDefault("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		PasswordResetExp: time.Duration(utils.GetIntOrDefault("PASSWORD_RESET_EXP", 30)) * time.Minute,
+
+		EmailVerificationURL:            utils.GetStringOrDefault("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email"),
+		EmailVerificationExp:            time.Duration(utils.GetIntOrDefault("EMAIL_VERIFICATION_EXP", 24)) * time.Hour,
+		EmailVerificationResendInterval: time.Duration(utils.GetIntOrDefault("EMAIL_VERIFICATION_RESEND_INTERVAL", 60)) * time.Second,
+		RequireVerifiedEmail:            utils.GetBoolOrDefault("REQUIRE_VERIFIED_EMAIL", false),
+		VerifiedEmailPermissions:        utils.GetStringSliceOrDefault("VERIFIED_EMAIL_PERMISSIONS", nil),
+
+		MFAEncryptionKey: utils.GetStringOrDefault("MFA_ENCRYPTION_KEY", ""),
+		MFAIssuer:        utils.GetStringOrDefault("MFA_ISSUER", "ecomz"),
+		MFAChallengeExp:  time.Duration(utils.GetIntOrDefault("MFA_CHALLENGE_EXP", 5)) * time.Minute,
+		MFASkew:          utils.GetIntOrDefault("MFA_SKEW", 1),
+
+		LoginFailureWindow:   time.Duration(utils.GetIntOrDefault("LOGIN_FAILURE_WINDOW", 15)) * time.Minute,
+		LoginDelayAfter:      utils.GetIntOrDefault("LOGIN_DELAY_AFTER", 3),
+		LoginDelayBase:       time.Duration(utils.GetIntOrDefault("LOGIN_DELAY_BASE", 1)) * time.Second,
+		LoginMaxFailures:     utils.GetIntOrDefault("LOGIN_MAX_FAILURES", 10),
+		LoginIPMaxFailures:   utils.GetIntOrDefault("LOGIN_IP_MAX_FAILURES", 100),
+		LoginLockoutDuration: time.Duration(utils.GetIntOrDefault("LOGIN_LOCKOUT_DURATION", 15)) * time.Minute,
+
+		MagicLinkEnabled:     utils.GetBoolOrDefault("MAGIC_LINK_ENABLED", false),
+		MagicLinkURL:         utils.GetStringOrDefault("MAGIC_LINK_URL", "http://localhost:3000/magic-link"),
+		MagicLinkExp:         time.Duration(utils.GetIntOrDefault("MAGIC_LINK_EXP", 15)) * time.Minute,
+		MagicLinkMaxRequests: utils.GetIntOrDefault("MAGIC_LINK_MAX_REQUESTS", 5),
+		MagicLinkWindow:      time.Duration(utils.GetIntOrDefault("MAGIC_LINK_WINDOW", 60)) * time.Minute,
+
+		ImpersonationExp:         time.Duration(utils.GetIntOrDefault("IMPERSONATION_EXP", 15)) * time.Minute,
+		ImpersonationPermissions: utils.GetStringSliceOrDefault("IMPERSONATION_PERMISSIONS", nil),
+
+		OrganizationInvitationURL: utils.GetStringOrDefault("ORGANIZATION_INVITATION_URL", "http://localhost:3000/invitations/accept"),
+		OrganizationInvitationExp: time.Duration(utils.GetIntOrDefault("ORGANIZATION_INVITATION_EXP", 7)) * 24 * time.Hour,
+
+		DataExportExp:           time.Duration(utils.GetIntOrDefault("DATA_EXPORT_EXP", 7)) * 24 * time.Hour,
+		DataRequestPollInterval: time.Duration(utils.GetIntOrDefault("DATA_REQUEST_POLL_INTERVAL", 10)) * time.Second,
+		DataRequestTimeout:      time.Duration(utils.GetIntOrDefault("DATA_REQUEST_TIMEOUT", 30)) * time.Minute,
+	}
+}
+
+type MailConfig struct {
+	// Driver is one of smtp, file or console.
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string
+}
+
+func getMailConfig() MailConfig {
+	return MailConfig{
+		Driver:       utils.GetStringOrDefault("MAIL_DRIVER", "console"),
+		From:         utils.GetStringOrDefault("MAIL_FROM", "no-reply@ecomz.local"),
+		SMTPHost:     utils.GetStringOrDefault("SMTP_HOST", ""),
+		SMTPPort:     utils.GetIntOrDefault("SMTP_PORT", 587),
+		SMTPUsername: utils.GetStringOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword: utils.GetStringOrDefault("SMTP_PASSWORD", ""),
+		FileDir:      utils.GetStringOrDefault("MAIL_FILE_DIR", "./mail"),
+	}
+}
+
+type OIDCConfig struct {
+	// RedirectURL is the frontend page providers send the user back to with
+	// the code and state query parameters. It must be registered with every
+	// provider.
+	RedirectURL string
+	StateExp    time.Duration
+	Providers   []OIDCProviderConfig
+}
+
+// OIDCProviderConfig configures a login provider named in OIDC_PROVIDERS.
+// Its settings are read from OIDC_<NAME>_* variables.
+type OIDCProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Issuer enables OpenID Connect discovery. Providers that only speak
+	// OAuth2, such as GitHub, leave it empty and set the endpoints instead.
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+}
+
+func getOIDCConfig() OIDCConfig {
+	cfg := OIDCConfig{
+		RedirectURL: utils.GetStringOrDefault("OIDC_REDIRECT_URL", "http://localhost:3000/oauth/callback"),
+		StateExp:    time.Duration(utils.GetIntOrDefault("OIDC_STATE_EXP", 10)) * time.Minute,
+	}
+
+	for _, name := range utils.GetStringSliceOrDefault("OIDC_PROVIDERS", nil) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			ClientID:     utils.GetStringOrPanic(prefix + "CLIENT_ID"),
+			ClientSecret: utils.GetStringOrDefault(prefix+"CLIENT_SECRET", ""),
+			Issuer:       utils.GetStringOrDefault(prefix+"ISSUER", ""),
+			AuthURL:      utils.GetStringOrDefault(prefix+"AUTH_URL", ""),
+			TokenURL:     utils.GetStringOrDefault(prefix+"TOKEN_URL", ""),
+			UserInfoURL:  utils.GetStringOrDefault(prefix+"USERINFO_URL", ""),
+		}
+
+		defaultScopes := []string{"openid", "email", "profile"}
+		if provider.Issuer == "" {
+			defaultScopes = nil
+		}
+		provider.Scopes = utils.GetStringSliceOrDefault(prefix+"SCOPES", defaultScopes)
+
+		cfg.Providers = append(cfg.Providers, provider)
+	}
+
+	return cfg
+}
+
+// OAuthConfig configures auth-service as an authorization server for OAuth
+// clients.
+type OAuthConfig struct {
+	AuthorizationCodeExp time.Duration
+	// AccessTokenExp is kept short since client tokens cannot be refreshed
+	// and are only denylisted when their client or consent is removed.
+	AccessTokenExp time.Duration
+}
+
+func getOAuthConfig() OAuthConfig {
+	return OAuthConfig{
+		AuthorizationCodeExp: time.Duration(utils.GetIntOrDefault("OAUTH_CODE_EXP", 60)) * time.Second,
+		AccessTokenExp:       time.Duration(utils.GetIntOrDefault("OAUTH_ACCESS_TOKEN_EXP", 60)) * time.Minute,
+	}
+}
+
+type PasswordConfig struct {
+	// Algorithm hashes new passwords, bcrypt or argon2id. Stored hashes of
+	// the other algorithm or with weaker parameters are upgraded when their
+	// user logs in.
+	Algorithm  string
+	BcryptCost int
+	Argon2     utils.Argon2Params
+	MinLength  int
+	// MaxLength bounds the hashing work per request. With bcrypt passwords
+	// are also limited to 72 bytes.
+	MaxLength int
+	// BreachedListPath is a file of known breached passwords, one per line,
+	// that users may not choose.
+	BreachedListPath string
+}
+
+func getPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		Algorithm:  utils.GetStringOrDefault("PASSWORD_HASH_ALGORITHM", utils.PasswordAlgArgon2id),
+		BcryptCost: utils.GetIntOrDefault("PASSWORD_BCRYPT_COST", 12),
+		Argon2: utils.Argon2Params{
+			Memory:      uint32(utils.GetIntOrDefault("PASSWORD_ARGON2_MEMORY", 64*1024)),
+			Iterations:  uint32(utils.GetIntOrDefault("PASSWORD_ARGON2_ITERATIONS", 3)),
+			Parallelism: uint8(utils.GetIntOrDefault("PASSWORD_ARGON2_PARALLELISM", 2)),
+		},
+		MinLength:        utils.GetIntOrDefault("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:        utils.GetIntOrDefault("PASSWORD_MAX_LENGTH", 128),
+		BreachedListPath: utils.GetStringOrDefault("PASSWORD_BREACHED_LIST", ""),
+	}
+}
+
+// CatalogConfig defines the facets product listings can return and the
+// caching of autocomplete suggestions.
+type CatalogConfig struct {
+	// Facets are the facets computed on request, out of category, price,
+	// has_price and has_description.
+	Facets []string
+	// PriceBuckets are the ascending lower bounds of the price facet's
+	// buckets. The last bucket has no upper bound.
+	PriceBuckets []float64
+	// SuggestCacheTTL is how long autocomplete suggestions are cached, and
+	// so how long they may miss catalogue changes.
+	SuggestCacheTTL time.Duration
+}
+
+func getCatalogConfig() CatalogConfig {
+	var buckets []float64
+	for _, value := range utils.GetStringSliceOrDefault("CATALOG_PRICE_BUCKETS", []string{"0", "25", "50", "100", "250", "500"}) {
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil || (len(buckets) > 0 && bound <= buckets[len(buckets)-1]) {
+			panic("invalid CATALOG_PRICE_BUCKETS, expected ascending numbers: " + value)
+		}
+		buckets = append(buckets, bound)
+	}
+
+	return CatalogConfig{
+		Facets:          utils.GetStringSliceOrDefault("CATALOG_FACETS", []string{"category", "price", "has_price", "has_description"}),
+		PriceBuckets:    buckets,
+		SuggestCacheTTL: time.Duration(utils.GetIntOrDefault("CATALOG_SUGGEST_CACHE_TTL", 60)) * time.Second,
+	}
+}
+
 func LoadConfigFromFile(path, fileName, ext string) *Config {
 	viper.AddConfigPath(path)
 	viper.SetConfigName(fileName)
@@ -90,5 +378,11 @@ func LoadConfigFromFile(path, fileName, ext string) *Config {
 		Database: getDatabaseConfig(),
 		JWT:      getJWTConfig(),
 		Redis:    getRedisConfig(),
+		Auth:     getAuthConfig(),
+		Mail:     getMailConfig(),
+		OIDC:     getOIDCConfig(),
+		OAuth:    getOAuthConfig(),
+		Password: getPasswordConfig(),
+		Catalog:  getCatalogConfig(),
 	}
 }
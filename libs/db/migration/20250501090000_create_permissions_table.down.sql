@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+
+COMMIT;
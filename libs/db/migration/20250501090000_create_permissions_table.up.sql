@@ -0,0 +1,34 @@
+BEGIN;
+
+CREATE TABLE permissions (
+   id SERIAL PRIMARY KEY,
+   name VARCHAR(255) NOT NULL UNIQUE,
+   description VARCHAR(255),
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE role_permissions (
+   role_id integer NOT NULL,
+   permission_id integer NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   PRIMARY KEY (role_id, permission_id),
+   CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+   CONSTRAINT fk_permission FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+   ('role:read', 'List roles and their permissions'),
+   ('role:write', 'Create roles and change their permissions'),
+   ('permission:read', 'List permissions'),
+   ('permission:write', 'Create permissions'),
+   ('product:write', 'Create, update and delete products'),
+   ('category:write', 'Create, update and delete categories');
+
+INSERT INTO roles (name) VALUES ('admin'), ('customer') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+COMMIT;
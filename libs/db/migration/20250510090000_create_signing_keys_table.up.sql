@@ -0,0 +1,15 @@
+BEGIN;
+
+CREATE TABLE signing_keys (
+   id VARCHAR(64) PRIMARY KEY,
+   algorithm VARCHAR(16) NOT NULL,
+   private_key TEXT NOT NULL,
+   activates_at TIMESTAMP NOT NULL,
+   retires_at TIMESTAMP NOT NULL,
+   expires_at TIMESTAMP NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_signing_keys_expires_at ON signing_keys (expires_at);
+
+COMMIT;
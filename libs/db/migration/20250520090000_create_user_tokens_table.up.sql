@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE user_tokens (
+   id SERIAL PRIMARY KEY,
+   user_id uuid NOT NULL,
+   purpose VARCHAR(32) NOT NULL,
+   token_hash VARCHAR(64) NOT NULL UNIQUE,
+   expires_at TIMESTAMP NOT NULL,
+   used_at TIMESTAMP,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_tokens_user_id_purpose ON user_tokens (user_id, purpose);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN email_verified_at;
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- rows registered without an email cannot be verified, give them a
+-- placeholder so the column can become NOT NULL
+UPDATE users SET email = id::text || '@invalid.local' WHERE email IS NULL;
+
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- accounts from before verification existed count as verified, otherwise
+-- REQUIRE_VERIFIED_EMAIL would lock them all out. The placeholders stay
+-- unverified.
+UPDATE users SET email_verified_at = created_at WHERE email NOT LIKE '%@invalid.local';
+
+COMMIT;
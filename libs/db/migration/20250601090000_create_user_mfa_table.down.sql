@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE roles DROP COLUMN mfa_required;
+
+DROP TABLE mfa_recovery_codes;
+DROP TABLE user_mfa;
+
+COMMIT;
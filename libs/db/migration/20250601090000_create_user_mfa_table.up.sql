@@ -0,0 +1,30 @@
+BEGIN;
+
+CREATE TABLE user_mfa (
+   user_id uuid PRIMARY KEY,
+   secret TEXT NOT NULL,
+   enabled_at TIMESTAMP,
+   last_used_step BIGINT NOT NULL DEFAULT 0,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_recovery_codes (
+   id SERIAL PRIMARY KEY,
+   user_id uuid NOT NULL,
+   code_hash VARCHAR(64) NOT NULL,
+   used_at TIMESTAMP,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+ALTER TABLE roles ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE roles SET mfa_required = TRUE WHERE name = 'admin';
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DELETE FROM permissions WHERE name IN ('user:read', 'user:write');
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+INSERT INTO permissions (name, description) VALUES
+   ('user:read', 'List users and login lockouts'),
+   ('user:write', 'Manage users and clear login lockouts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name IN ('user:read', 'user:write');
+
+COMMIT;
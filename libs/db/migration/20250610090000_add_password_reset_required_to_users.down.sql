@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN password_reset_required;
+
+COMMIT;
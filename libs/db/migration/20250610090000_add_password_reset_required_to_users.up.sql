@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+COMMIT;
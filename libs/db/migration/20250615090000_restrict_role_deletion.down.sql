@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX idx_users_role_id;
+
+DROP INDEX idx_roles_name;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+ALTER TABLE users DROP CONSTRAINT fk_role;
+ALTER TABLE users ADD CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- deleting a role must never delete the users holding it
+ALTER TABLE users DROP CONSTRAINT fk_role;
+ALTER TABLE users ADD CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE RESTRICT;
+
+-- names of soft-deleted roles can be reused
+ALTER TABLE roles DROP CONSTRAINT roles_name_key;
+CREATE UNIQUE INDEX idx_roles_name ON roles (name) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_users_role_id ON users (role_id);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- a changed email address only replaces email once it is verified
+ALTER TABLE users ADD COLUMN pending_email VARCHAR(255);
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- one row per login, the id is the refresh token family id
+CREATE TABLE sessions (
+   id VARCHAR(64) PRIMARY KEY,
+   user_id uuid NOT NULL,
+   user_agent TEXT NOT NULL DEFAULT '',
+   ip VARCHAR(64) NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP NOT NULL,
+   revoked_at TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- external login provider accounts linked to a user
+CREATE TABLE user_identities (
+   id SERIAL PRIMARY KEY,
+   user_id uuid NOT NULL,
+   provider VARCHAR(64) NOT NULL,
+   subject VARCHAR(255) NOT NULL,
+   email VARCHAR(255) NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   last_login_at TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+   CONSTRAINT uq_user_identities_provider_subject UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+COMMIT;
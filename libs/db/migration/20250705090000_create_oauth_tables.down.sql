@@ -0,0 +1,8 @@
+BEGIN;
+
+DELETE FROM permissions WHERE name IN ('client:read', 'client:write');
+
+DROP TABLE oauth_consents;
+DROP TABLE oauth_clients;
+
+COMMIT;
@@ -0,0 +1,42 @@
+BEGIN;
+
+-- list columns hold space separated values, like OAuth scope strings
+CREATE TABLE oauth_clients (
+   id VARCHAR(64) PRIMARY KEY,
+   name VARCHAR(255) NOT NULL,
+   -- public clients have no secret and must use PKCE
+   secret_hash VARCHAR(64),
+   redirect_uris TEXT NOT NULL DEFAULT '',
+   grant_types TEXT NOT NULL DEFAULT '',
+   scopes TEXT NOT NULL DEFAULT '',
+   -- first party clients are not asked for consent
+   first_party BOOLEAN NOT NULL DEFAULT FALSE,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE oauth_consents (
+   user_id uuid NOT NULL,
+   client_id VARCHAR(64) NOT NULL,
+   scopes TEXT NOT NULL DEFAULT '',
+   -- shared by the tokens issued under the consent so they can be revoked
+   token_family VARCHAR(64) NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   PRIMARY KEY (user_id, client_id),
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+   CONSTRAINT fk_client FOREIGN KEY (client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_oauth_consents_client_id ON oauth_consents (client_id);
+
+INSERT INTO permissions (name, description) VALUES
+   ('client:read', 'List OAuth clients'),
+   ('client:write', 'Manage OAuth clients');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name IN ('client:read', 'client:write');
+
+COMMIT;
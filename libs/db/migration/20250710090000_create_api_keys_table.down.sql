@@ -0,0 +1,7 @@
+BEGIN;
+
+DELETE FROM permissions WHERE name IN ('api_key:read', 'api_key:write');
+
+DROP TABLE api_keys;
+
+COMMIT;
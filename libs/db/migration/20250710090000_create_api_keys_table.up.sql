@@ -0,0 +1,33 @@
+BEGIN;
+
+-- personal keys belong to a user, service keys (user_id NULL) to no one
+CREATE TABLE api_keys (
+   id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+   user_id uuid,
+   name VARCHAR(100) NOT NULL,
+   -- the start of the key, shown to tell keys apart
+   prefix VARCHAR(32) NOT NULL,
+   key_hash VARCHAR(64) NOT NULL UNIQUE,
+   -- space separated permission names
+   scopes TEXT NOT NULL DEFAULT '',
+   created_by uuid,
+   expires_at TIMESTAMP,
+   last_used_at TIMESTAMP,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   revoked_at TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+   CONSTRAINT fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+INSERT INTO permissions (name, description) VALUES
+   ('api_key:read', 'List all API keys'),
+   ('api_key:write', 'Manage service API keys and revoke any API key');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name IN ('api_key:read', 'api_key:write');
+
+COMMIT;
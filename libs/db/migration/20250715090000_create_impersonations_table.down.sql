@@ -0,0 +1,7 @@
+BEGIN;
+
+DELETE FROM permissions WHERE name = 'user:impersonate';
+
+DROP TABLE impersonations;
+
+COMMIT;
@@ -0,0 +1,32 @@
+BEGIN;
+
+-- audit trail of administrators impersonating users, kept when either user
+-- is removed
+CREATE TABLE impersonations (
+   id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+   actor_id uuid,
+   user_id uuid,
+   reason TEXT NOT NULL,
+   ip VARCHAR(64) NOT NULL DEFAULT '',
+   user_agent TEXT NOT NULL DEFAULT '',
+   -- space separated permissions of the issued token
+   permissions TEXT NOT NULL DEFAULT '',
+   started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP NOT NULL,
+   ended_at TIMESTAMP,
+
+   CONSTRAINT fk_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_impersonations_actor_id ON impersonations (actor_id);
+CREATE INDEX idx_impersonations_user_id ON impersonations (user_id);
+
+INSERT INTO permissions (name, description) VALUES
+   ('user:impersonate', 'Log in as another user with restricted permissions');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name = 'user:impersonate';
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+DROP INDEX idx_products_organization_id;
+DROP INDEX idx_categories_organization_id;
+
+ALTER TABLE products DROP COLUMN organization_id;
+ALTER TABLE categories DROP COLUMN organization_id;
+ALTER TABLE sessions DROP COLUMN organization_id;
+
+DELETE FROM permissions WHERE name IN ('organization:read', 'organization:write', 'member:write');
+
+DROP TABLE organization_invitations;
+DROP TABLE organization_members;
+DROP TABLE organization_role_permissions;
+DROP TABLE organization_roles;
+DROP TABLE organizations;
+
+COMMIT;
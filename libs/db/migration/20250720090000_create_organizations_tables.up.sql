@@ -0,0 +1,94 @@
+BEGIN;
+
+-- merchants selling on the marketplace
+CREATE TABLE organizations (
+   id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+   name VARCHAR(100) NOT NULL,
+   slug VARCHAR(64) NOT NULL UNIQUE,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- roles members hold within their organization, their permissions only
+-- apply to that organization
+CREATE TABLE organization_roles (
+   id SERIAL PRIMARY KEY,
+   name VARCHAR(50) NOT NULL UNIQUE,
+   description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE organization_role_permissions (
+   organization_role_id integer NOT NULL,
+   permission_id integer NOT NULL,
+
+   PRIMARY KEY (organization_role_id, permission_id),
+   CONSTRAINT fk_organization_role FOREIGN KEY (organization_role_id) REFERENCES organization_roles(id) ON DELETE CASCADE,
+   CONSTRAINT fk_permission FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE organization_members (
+   organization_id uuid NOT NULL,
+   user_id uuid NOT NULL,
+   organization_role_id integer NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   PRIMARY KEY (organization_id, user_id),
+   CONSTRAINT fk_organization FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+   CONSTRAINT fk_organization_role FOREIGN KEY (organization_role_id) REFERENCES organization_roles(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE organization_invitations (
+   id SERIAL PRIMARY KEY,
+   organization_id uuid NOT NULL,
+   email VARCHAR(255) NOT NULL,
+   organization_role_id integer NOT NULL,
+   token_hash VARCHAR(64) NOT NULL UNIQUE,
+   invited_by uuid,
+   expires_at TIMESTAMP NOT NULL,
+   accepted_at TIMESTAMP,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+   CONSTRAINT fk_organization FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+   CONSTRAINT fk_organization_role FOREIGN KEY (organization_role_id) REFERENCES organization_roles(id) ON DELETE CASCADE,
+   CONSTRAINT fk_invited_by FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_organization_invitations_organization_id ON organization_invitations (organization_id);
+
+-- the organization a session acts for, put in its access tokens
+ALTER TABLE sessions ADD COLUMN organization_id uuid
+   REFERENCES organizations(id) ON DELETE SET NULL;
+
+-- products and categories without an organization belong to the platform
+ALTER TABLE categories ADD COLUMN organization_id uuid
+   REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE products ADD COLUMN organization_id uuid
+   REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_categories_organization_id ON categories (organization_id);
+CREATE INDEX idx_products_organization_id ON products (organization_id);
+
+INSERT INTO permissions (name, description) VALUES
+   ('organization:read', 'List all organizations'),
+   ('organization:write', 'Manage any organization and its members'),
+   ('member:write', 'Invite and manage the members of an organization');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name IN ('organization:read', 'organization:write');
+
+INSERT INTO organization_roles (name, description) VALUES
+   ('owner', 'Manages the organization, its members and its catalogue'),
+   ('manager', 'Manages the catalogue'),
+   ('staff', 'Manages products');
+
+INSERT INTO organization_role_permissions (organization_role_id, permission_id)
+SELECT r.id, p.id FROM organization_roles r JOIN permissions p ON
+   (r.name = 'owner' AND p.name IN ('member:write', 'product:write', 'category:write'))
+   OR (r.name = 'manager' AND p.name IN ('product:write', 'category:write'))
+   OR (r.name = 'staff' AND p.name = 'product:write');
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE data_requests;
+
+ALTER TABLE users DROP COLUMN erased_at;
+
+COMMIT;
@@ -0,0 +1,31 @@
+BEGIN;
+
+-- erased users keep their row so references stay valid, but every personal
+-- field is overwritten
+ALTER TABLE users ADD COLUMN erased_at TIMESTAMP;
+
+-- personal data exports and erasures, processed asynchronously
+CREATE TABLE data_requests (
+   id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+   user_id uuid,
+   -- export or erasure
+   kind VARCHAR(16) NOT NULL,
+   -- pending, running, completed or failed
+   status VARCHAR(16) NOT NULL DEFAULT 'pending',
+   requested_by uuid,
+   error TEXT NOT NULL DEFAULT '',
+   -- the JSON archive of a completed export until it expires
+   archive BYTEA,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   started_at TIMESTAMP,
+   completed_at TIMESTAMP,
+   expires_at TIMESTAMP,
+
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+   CONSTRAINT fk_requested_by FOREIGN KEY (requested_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_data_requests_user_id ON data_requests (user_id);
+CREATE INDEX idx_data_requests_status ON data_requests (status, created_at);
+
+COMMIT;
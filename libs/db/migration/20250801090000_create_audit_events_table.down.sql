@@ -0,0 +1,9 @@
+BEGIN;
+
+DELETE FROM permissions WHERE name = 'audit:read';
+
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
+DROP FUNCTION audit_events_erase_only();
+
+COMMIT;
@@ -0,0 +1,66 @@
+BEGIN;
+
+-- append-only security audit log. Every event stores the hash of the
+-- previous one, so removed or altered rows break the chain. Users are
+-- referenced without foreign keys, the rows must never change.
+--
+-- ip, user_agent and details are personal data that has to be erasable.
+-- The chain covers pii_digest instead, a keyed hash of them with pii_salt.
+-- Erasure blanks them together with the salt, which leaves the chain intact
+-- and the digest impossible to match against guessed values.
+CREATE TABLE audit_events (
+   id BIGSERIAL PRIMARY KEY,
+   event VARCHAR(64) NOT NULL,
+   actor_id VARCHAR(64) NOT NULL DEFAULT '',
+   target_type VARCHAR(32) NOT NULL DEFAULT '',
+   target_id VARCHAR(255) NOT NULL DEFAULT '',
+   ip VARCHAR(64) NOT NULL DEFAULT '',
+   user_agent TEXT NOT NULL DEFAULT '',
+   -- JSON object, kept as text so the hashed bytes are stored as is
+   details TEXT NOT NULL DEFAULT '{}',
+   pii_salt VARCHAR(64) NOT NULL DEFAULT '',
+   pii_digest VARCHAR(64) NOT NULL,
+   created_at TIMESTAMP NOT NULL,
+   prev_hash VARCHAR(64) NOT NULL,
+   hash VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX idx_audit_events_target_id ON audit_events (target_id);
+CREATE INDEX idx_audit_events_event ON audit_events (event);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+   RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+   BEFORE DELETE OR TRUNCATE ON audit_events
+   FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- the only update allowed is erasing the personal data of an event
+CREATE FUNCTION audit_events_erase_only() RETURNS trigger AS $$
+BEGIN
+   IF (NEW.id, NEW.event, NEW.actor_id, NEW.target_type, NEW.target_id, NEW.pii_digest, NEW.created_at, NEW.prev_hash, NEW.hash)
+         IS DISTINCT FROM (OLD.id, OLD.event, OLD.actor_id, OLD.target_type, OLD.target_id, OLD.pii_digest, OLD.created_at, OLD.prev_hash, OLD.hash)
+      OR NEW.ip <> '' OR NEW.user_agent <> '' OR NEW.details <> '{}' OR NEW.pii_salt <> '' THEN
+      RAISE EXCEPTION 'audit_events is append-only, only personal data may be erased';
+   END IF;
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_erase_only
+   BEFORE UPDATE ON audit_events
+   FOR EACH ROW EXECUTE FUNCTION audit_events_erase_only();
+
+INSERT INTO permissions (name, description) VALUES
+   ('audit:read', 'Read and export the security audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name = 'audit:read';
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX idx_products_created_at_id;
+DROP INDEX idx_products_name_id;
+DROP INDEX idx_products_price_id;
+DROP INDEX idx_products_category_id;
+
+ALTER TABLE products ALTER COLUMN created_at DROP NOT NULL;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- keyset pagination compares (sort column, id), rows need a creation time
+UPDATE products SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE products ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX idx_products_category_id ON products (category_id);
+CREATE INDEX idx_products_price_id ON products (price, id);
+CREATE INDEX idx_products_name_id ON products (name, id);
+CREATE INDEX idx_products_created_at_id ON products (created_at, id);
+
+COMMIT;
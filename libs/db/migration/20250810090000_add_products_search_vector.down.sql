@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX idx_products_search_vector;
+DROP TRIGGER products_search_vector_update ON products;
+DROP FUNCTION products_search_vector_update();
+
+ALTER TABLE products DROP COLUMN search_vector;
+
+COMMIT;
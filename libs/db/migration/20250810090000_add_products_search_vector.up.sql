@@ -0,0 +1,26 @@
+BEGIN;
+
+-- full-text search over the name, weighted above the description. The
+-- search queries must use the same text search configuration.
+ALTER TABLE products ADD COLUMN search_vector tsvector;
+
+CREATE FUNCTION products_search_vector_update() RETURNS trigger AS $$
+BEGIN
+   NEW.search_vector :=
+      setweight(to_tsvector('english', COALESCE(NEW.name, '')), 'A') ||
+      setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'B');
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_search_vector_update
+   BEFORE INSERT OR UPDATE OF name, description ON products
+   FOR EACH ROW EXECUTE FUNCTION products_search_vector_update();
+
+UPDATE products SET search_vector =
+   setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+   setweight(to_tsvector('english', COALESCE(description, '')), 'B');
+
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX idx_categories_name_trgm;
+DROP INDEX idx_products_name_trgm;
+
+DROP EXTENSION IF EXISTS pg_trgm;
+
+COMMIT;
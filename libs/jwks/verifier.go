@@ -0,0 +1,165 @@
+package jwks
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// minRefreshInterval limits how often an unknown kid may force a refetch.
+const minRefreshInterval = 30 * time.Second
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// RemoteKeySet fetches a JWKS document and caches its keys. The document is
+// fetched again when the cache is older than ttl, or when a token references
+// a kid that is not cached yet, which happens right after a key rotation.
+type RemoteKeySet struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+func NewRemoteKeySet(url string, ttl time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]publicKey),
+	}
+}
+
+// Keyfunc resolves the verification key of a token by its kid header. It can
+// be passed to any jwt parse function.
+func (s *RemoteKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, err := s.key(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %s is not valid for %s", kid, token.Method.Alg())
+	}
+
+	return key.key, nil
+}
+
+func (s *RemoteKeySet) key(kid string) (publicKey, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	fetchedAt := s.fetchedAt
+	s.mu.RUnlock()
+
+	stale := time.Since(fetchedAt) > s.ttl
+	if ok && !stale {
+		return key, nil
+	}
+
+	if !stale && time.Since(fetchedAt) < minRefreshInterval {
+		return publicKey{}, ErrUnknownKey
+	}
+
+	if err := s.refresh(); err != nil {
+		// keep serving the cached key if the issuer is briefly unavailable
+		if ok {
+			return key, nil
+		}
+		return publicKey{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return publicKey{}, ErrUnknownKey
+}
+
+func (s *RemoteKeySet) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// another request refreshed the keys while we were waiting for the lock
+	if time.Since(s.fetchedAt) < minRefreshInterval {
+		return nil
+	}
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey{alg: jwk.Alg, key: key}
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+type keySetVerifier struct {
+	keySet *RemoteKeySet
+}
+
+// NewVerifier verifies tokens signed with any key published in keySet.
+func NewVerifier(keySet *RemoteKeySet) utils.TokenVerifier {
+	return &keySetVerifier{keySet: keySet}
+}
+
+func (v *keySetVerifier) Verify(token string) (*utils.MyClaims, error) {
+	return utils.ParseTokenWithKeyFunc(token, v.keySet.Keyfunc, AlgRS256, AlgEdDSA)
+}
+
+// NewVerifierFromConfig returns a JWKS backed verifier when JWT_JWKS_URL is
+// configured and falls back to the shared HS256 secret otherwise.
+func NewVerifierFromConfig(cfg config.JWTConfig) (utils.TokenVerifier, error) {
+	if cfg.JWKSURL != "" {
+		return NewVerifier(NewRemoteKeySet(cfg.JWKSURL, cfg.JWKSCacheTTL)), nil
+	}
+
+	if cfg.SecretKey == "" {
+		return nil, errors.New("either JWT_JWKS_URL or JWT_SECRET_KEY must be set")
+	}
+	return utils.NewHMACVerifier(cfg.SecretKey), nil
+}
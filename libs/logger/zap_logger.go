@@ -11,6 +11,12 @@ func NewZapLogger() Logger {
 	if err != nil {
 		panic(err)
 	}
+	return FromZap(l)
+}
+
+// FromZap wraps l, for programs that also hand the zap logger to libraries
+// taking it directly.
+func FromZap(l *zap.Logger) Logger {
 	return &zapLogger{logger: l}
 }
 
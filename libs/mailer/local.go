@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ecomz/backend/libs/utils"
+)
+
+// fileMailer writes every message as an .eml file, for local development and
+// tests where no SMTP server is available.
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(from, dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileMailer{from: from, dir: dir}, nil
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	suffix, err := utils.RandomString(4)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), suffix)
+	return os.WriteFile(filepath.Join(m.dir, name), encode(m.from, msg), 0o644)
+}
+
+// consoleMailer prints every message to w.
+type consoleMailer struct {
+	from string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func NewConsoleMailer(from string, w io.Writer) Mailer {
+	return &consoleMailer{from: from, w: w}
+}
+
+func (m *consoleMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "----- mail -----\n%s\n----------------\n", encode(m.from, msg))
+	return err
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"os"
+	"time"
+
+	"github.com/ecomz/backend/libs/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailer builds the mailer selected by MAIL_DRIVER.
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.FileDir)
+	case "console":
+		return NewConsoleMailer(cfg.From, os.Stdout), nil
+	}
+
+	return nil, fmt.Errorf("unsupported mail driver %q", cfg.Driver)
+}
+
+// encode renders msg as an RFC 5322 message.
+func encode(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/libs/utils"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// Authenticator validates bearer access tokens, and API keys when enabled,
+// and enforces permissions on the routes it wraps. It can be used with
+// gorilla/mux through Router.Use or by wrapping individual handlers.
+type Authenticator struct {
+	verifier utils.TokenVerifier
+	denylist utils.TokenDenylist
+	activity utils.SessionActivity
+	apiKeys  utils.APIKeyVerifier
+}
+
+func NewAuthenticator(verifier utils.TokenVerifier, denylist utils.TokenDenylist) *Authenticator {
+	return &Authenticator{
+		verifier: verifier,
+		denylist: denylist,
+	}
+}
+
+// WithSessionActivity makes the authenticator record the last request of
+// every session it lets through.
+func (a *Authenticator) WithSessionActivity(activity utils.SessionActivity) *Authenticator {
+	a.activity = activity
+	return a
+}
+
+// WithAPIKeys makes the authenticator accept an API key in the X-API-Key
+// header as an alternative to a bearer token.
+func (a *Authenticator) WithAPIKeys(apiKeys utils.APIKeyVerifier) *Authenticator {
+	a.apiKeys = apiKeys
+	return a
+}
+
+// Authenticate rejects requests without a valid access token and stores the
+// token claims in the request context.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ClaimsFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := a.authenticate(r)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+	})
+}
+
+// AuthenticateUser is Authenticate for endpoints that manage the user's own
+// account, which OAuth clients, API keys and impersonation sessions must not
+// reach.
+func (a *Authenticator) AuthenticateUser(next http.Handler) http.Handler {
+	return a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if !claims.IsUserSession() {
+			utils.ErrorResponse(w, http.StatusForbidden, "only available to the user's own login")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequirePermission authenticates the request and only lets it through when
+// the token grants the given permission.
+func (a *Authenticator) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if !claims.HasPermission(permission) {
+				utils.ErrorResponse(w, http.StatusForbidden, "missing permission "+permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireOrgPermission is RequirePermission that also accepts the
+// permission from the role in the session's organization. Handlers must then
+// limit the request to the resources of claims.OrgScope(permission).
+func (a *Authenticator) RequireOrgPermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if !claims.HasPermission(permission) && !claims.HasOrgPermission(permission) {
+				utils.ErrorResponse(w, http.StatusForbidden, "missing permission "+permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (*utils.MyClaims, error) {
+	if key := r.Header.Get(utils.APIKeyHeader); key != "" && a.apiKeys != nil {
+		return a.apiKeys.Verify(key)
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, utils.ErrInvalidToken
+	}
+
+	claims, err := a.verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.IsAccessToken() {
+		return nil, utils.ErrInvalidToken
+	}
+
+	if a.denylist != nil {
+		revoked, err := a.denylist.IsRevoked(claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, utils.ErrTokenRevoked
+		}
+	}
+
+	if a.activity != nil {
+		// last seen times are informational, a failed write must not fail
+		// the request
+		_ = a.activity.Touch(claims.FamilyID, time.Now())
+	}
+
+	return claims, nil
+}
+
+// ClaimsFromContext returns the claims stored by Authenticate.
+func ClaimsFromContext(ctx context.Context) (*utils.MyClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*utils.MyClaims)
+	return claims, ok
+}
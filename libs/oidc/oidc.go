@@ -0,0 +1,370 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/jwks"
+	"github.com/ecomz/backend/libs/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const keySetCacheTTL = time.Hour
+
+var ErrNoEmail = errors.New("provider did not share an email address")
+
+// Token is the result of exchanging an authorization code. IDToken is empty
+// for providers that only speak OAuth2.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// Identity is the provider account a login resolved to.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Provider runs the authorization code flow with PKCE against one configured
+// provider. Providers with an issuer are discovered lazily on first use and
+// their ID tokens are verified; the others are identified through their
+// userinfo endpoint.
+type Provider struct {
+	cfg         config.OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+	keySet      *jwks.RemoteKeySet
+}
+
+func NewProvider(cfg config.OIDCProviderConfig, redirectURL string) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		authURL:     cfg.AuthURL,
+		tokenURL:    cfg.TokenURL,
+		userInfoURL: cfg.UserInfoURL,
+	}
+}
+
+// NewProviders builds every configured provider keyed by name.
+func NewProviders(cfg config.OIDCConfig) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg.Providers))
+	for _, provider := range cfg.Providers {
+		providers[provider.Name] = NewProvider(provider, cfg.RedirectURL)
+	}
+	return providers
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider page the user is sent to.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	if err := p.discover(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.redirectURL},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	}
+	if p.keySet != nil {
+		params.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(p.authURL, "?") {
+		separator = "&"
+	}
+	return p.authURL + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for the provider's tokens.
+func (p *Provider) Exchange(code, codeVerifier string) (*Token, error) {
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		Token
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.do(req, &body); err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	// some providers answer errors with 200
+	if body.Error != "" {
+		return nil, fmt.Errorf("failed to exchange code: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.AccessToken == "" {
+		return nil, errors.New("failed to exchange code: no access token")
+	}
+
+	return &body.Token, nil
+}
+
+// Identity resolves the account behind token. The ID token is verified
+// against nonce when the provider issued one; claims it lacks are read from
+// the userinfo endpoint.
+func (p *Provider) Identity(token *Token, nonce string) (*Identity, error) {
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+
+	var identity *Identity
+	if p.keySet != nil {
+		if token.IDToken == "" {
+			return nil, errors.New("provider returned no id token")
+		}
+		var err error
+		identity, err = p.verifyIDToken(token.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if identity.Email != "" || p.userInfoURL == "" {
+			return requireEmail(identity)
+		}
+	}
+
+	info, err := p.userInfo(token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if info.Subject != identity.Subject {
+			return nil, errors.New("userinfo subject does not match id token")
+		}
+		identity.Email, identity.EmailVerified = info.Email, info.EmailVerified
+		if identity.Name == "" {
+			identity.Name = info.Name
+		}
+		return requireEmail(identity)
+	}
+	return requireEmail(info)
+}
+
+func (p *Provider) verifyIDToken(idToken, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, p.keySet.Keyfunc,
+		jwt.WithValidMethods([]string{jwks.AlgRS256, jwks.AlgES256, jwks.AlgEdDSA}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) userInfo(accessToken string) (*Identity, error) {
+	if p.userInfoURL == "" {
+		return nil, errors.New("provider has no userinfo endpoint")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]any
+	if err := p.do(req, &info); err != nil {
+		return nil, fmt.Errorf("failed to fetch userinfo: %w", err)
+	}
+
+	// OAuth2 providers such as GitHub use a numeric id instead of sub
+	subject := stringClaim(info, "sub")
+	if subject == "" {
+		subject = stringClaim(info, "id")
+	}
+	if subject == "" {
+		return nil, errors.New("userinfo has no subject")
+	}
+
+	name := stringClaim(info, "name")
+	if name == "" {
+		name = stringClaim(info, "login")
+	}
+
+	return &Identity{
+		Subject:       subject,
+		Email:         stringClaim(info, "email"),
+		EmailVerified: isTrue(info["email_verified"]),
+		Name:          name,
+	}, nil
+}
+
+func (p *Provider) discover() error {
+	if p.cfg.Issuer == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var doc discoveryDocument
+	if err := p.do(req, &doc); err != nil {
+		return fmt.Errorf("failed to discover %s: %w", p.cfg.Name, err)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return fmt.Errorf("failed to discover %s: issuer mismatch %q", p.cfg.Name, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return fmt.Errorf("failed to discover %s: incomplete discovery document", p.cfg.Name)
+	}
+
+	// explicitly configured endpoints win over discovered ones
+	if p.authURL == "" {
+		p.authURL = doc.AuthorizationEndpoint
+	}
+	if p.tokenURL == "" {
+		p.tokenURL = doc.TokenEndpoint
+	}
+	if p.userInfoURL == "" {
+		p.userInfoURL = doc.UserInfoEndpoint
+	}
+	p.keySet = jwks.NewRemoteKeySet(doc.JWKSURI, keySetCacheTTL)
+	p.discovered = true
+	return nil
+}
+
+func (p *Provider) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier.
+func NewCodeVerifier() (string, error) {
+	return utils.RandomString(32)
+}
+
+// CodeChallenge derives the S256 PKCE challenge of verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func requireEmail(identity *Identity) (*Identity, error) {
+	if identity.Email == "" {
+		return nil, ErrNoEmail
+	}
+	return identity, nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// isTrue reads email_verified, which some providers send as a string.
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
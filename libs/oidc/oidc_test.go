@@ -0,0 +1,280 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/jwks"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "client"
+	testRedirectURL = "http://localhost/callback"
+	testKid         = "key-1"
+)
+
+// fakeIssuer is an OpenID Connect provider serving discovery, JWKS, token
+// and userinfo endpoints. It remembers the PKCE challenge and nonce of every
+// authorization it hands out a code for.
+type fakeIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+
+	// idClaims adjusts the claims of issued ID tokens
+	idClaims func(claims *idTokenClaims)
+	userInfo map[string]any
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{t: t, key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("GET /jwks", f.jwks)
+	mux.HandleFunc("POST /token", f.token)
+	mux.HandleFunc("GET /userinfo", f.userinfo)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeIssuer) config() config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Name:     "fake",
+		ClientID: testClientID,
+		Scopes:   []string{"openid", "email"},
+		Issuer:   f.server.URL,
+	}
+}
+
+// authorize plays the user consenting on the provider page of authURL and
+// returns the code the provider redirects back with.
+func (f *fakeIssuer) authorize(authURL string) string {
+	f.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	params := u.Query()
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		f.t.Fatalf("authorization url has no PKCE challenge: %s", authURL)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	code := rand.Text()
+	f.codes[code] = params
+	return code
+}
+
+func (f *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, discoveryDocument{
+		Issuer:                f.server.URL,
+		AuthorizationEndpoint: f.server.URL + "/authorize",
+		TokenEndpoint:         f.server.URL + "/token",
+		UserInfoEndpoint:      f.server.URL + "/userinfo",
+		JWKSURI:               f.server.URL + "/jwks",
+	})
+}
+
+func (f *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, err := jwks.NewJWK(testKid, jwks.AlgRS256, &f.key.PublicKey)
+	if err != nil {
+		f.t.Error(err)
+	}
+	writeJSON(w, jwks.JWKS{Keys: []jwks.JWK{jwk}})
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	params, ok := f.codes[r.FormValue("code")]
+	delete(f.codes, r.FormValue("code"))
+	f.mu.Unlock()
+
+	if !ok || r.FormValue("client_id") != params.Get("client_id") ||
+		CodeChallenge(r.FormValue("code_verifier")) != params.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := &idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    f.server.URL,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce:         params.Get("nonce"),
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane",
+	}
+	if f.idClaims != nil {
+		f.idClaims(claims)
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = testKid
+	signed, err := idToken.SignedString(f.key)
+	if err != nil {
+		f.t.Error(err)
+	}
+	writeJSON(w, Token{AccessToken: "access-token", IDToken: signed})
+}
+
+func (f *fakeIssuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, f.userInfo)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// login runs the whole flow against p and returns the resolved identity.
+func login(t *testing.T, f *fakeIssuer, p *Provider) (*Identity, error) {
+	t.Helper()
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := rand.Text()
+	authURL, err := p.AuthCodeURL("state", nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := p.Exchange(f.authorize(authURL), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Identity(token, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(f.config(), testRedirectURL)
+
+	identity, err := login(t, f, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeRequiresCodeVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(f.config(), testRedirectURL)
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL("state", "nonce", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.authorize(authURL)
+
+	other, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(code, other); err == nil {
+		t.Fatal("exchange with another code verifier succeeded")
+	}
+}
+
+func TestIdentityRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims *idTokenClaims)
+	}{
+		{"nonce", func(claims *idTokenClaims) { claims.Nonce = "other" }},
+		{"issuer", func(claims *idTokenClaims) { claims.Issuer = "https://attacker.example.com" }},
+		{"audience", func(claims *idTokenClaims) { claims.Audience = jwt.ClaimStrings{"other-client"} }},
+		{"expired", func(claims *idTokenClaims) { claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			f.idClaims = tt.claims
+			p := NewProvider(f.config(), testRedirectURL)
+
+			if identity, err := login(t, f, p); err == nil {
+				t.Fatalf("identity %+v accepted", *identity)
+			}
+		})
+	}
+}
+
+func TestIdentityFromUserInfo(t *testing.T) {
+	f := newFakeIssuer(t)
+	// GitHub has a numeric id and a login instead of sub and name
+	f.userInfo = map[string]any{"id": 4711, "login": "jane", "email": "jane@example.com"}
+	p := NewProvider(config.OIDCProviderConfig{
+		Name:        "github",
+		ClientID:    testClientID,
+		AuthURL:     f.server.URL + "/authorize",
+		TokenURL:    f.server.URL + "/token",
+		UserInfoURL: f.server.URL + "/userinfo",
+	}, testRedirectURL)
+
+	identity, err := login(t, f, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "4711", Email: "jane@example.com", Name: "jane"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestIdentityRequiresEmail(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.userInfo = map[string]any{"id": 4711, "login": "jane"}
+	p := NewProvider(config.OIDCProviderConfig{
+		Name:        "github",
+		ClientID:    testClientID,
+		AuthURL:     f.server.URL + "/authorize",
+		TokenURL:    f.server.URL + "/token",
+		UserInfoURL: f.server.URL + "/userinfo",
+	}, testRedirectURL)
+
+	if _, err := login(t, f, p); !errors.Is(err, ErrNoEmail) {
+		t.Fatalf("err = %v, want %v", err, ErrNoEmail)
+	}
+}
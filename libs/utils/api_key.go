@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// APIKeyHeader carries API keys, which are sent instead of a bearer
+	// token.
+	APIKeyHeader = "X-API-Key"
+	apiKeyPrefix = "ecomz_"
+	// apiKeyTouchInterval limits how often last_used_at is written for a
+	// busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyVerifier resolves an API key to claims like those of an access
+// token. Personal keys act as their user with the key's scopes, limited to
+// the permissions a login of the user would be granted. Service keys belong
+// to no user and grant their scopes.
+type APIKeyVerifier interface {
+	Verify(key string) (*MyClaims, error)
+}
+
+type apiKeyRow struct {
+	ID        string         `db:"id"`
+	UserID    sql.NullString `db:"user_id"`
+	Name      string         `db:"name"`
+	Scopes    string         `db:"scopes"`
+	ExpiresAt sql.NullTime   `db:"expires_at"`
+}
+
+type apiKeyUser struct {
+	Name          string       `db:"name"`
+	Email         string       `db:"email"`
+	EmailVerified sql.NullTime `db:"email_verified_at"`
+	// MFAMissing is set when the user's role requires MFA and the user has
+	// not enabled it, the role then grants nothing.
+	MFAMissing bool `db:"mfa_missing"`
+	// PasswordResetRequired locks the user's keys until the password is
+	// reset, as it blocks login.
+	PasswordResetRequired bool `db:"password_reset_required"`
+}
+
+type dbAPIKeyVerifier struct {
+	db *sqlx.DB
+	// verifiedEmailPermissions are withheld from users whose email is not
+	// verified, as they are at login.
+	verifiedEmailPermissions []string
+}
+
+func NewAPIKeyVerifier(db *sqlx.DB, verifiedEmailPermissions []string) APIKeyVerifier {
+	return &dbAPIKeyVerifier{db: db, verifiedEmailPermissions: verifiedEmailPermissions}
+}
+
+func (v *dbAPIKeyVerifier) Verify(key string) (*MyClaims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	var row apiKeyRow
+	err := v.db.Get(&row, `
+		SELECT id, user_id, name, scopes, expires_at FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL`,
+		HashToken(key),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if row.ExpiresAt.Valid && !row.ExpiresAt.Time.After(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	claims := &MyClaims{
+		ID:        row.ID,
+		Name:      row.Name,
+		TokenType: AccessToken,
+		APIKeyID:  row.ID,
+	}
+	claims.Permissions = strings.Fields(row.Scopes)
+
+	if row.UserID.Valid {
+		var user apiKeyUser
+		err := v.db.Get(&user, `
+			SELECT u.name, u.email, u.email_verified_at, u.password_reset_required,
+				r.mfa_required AND NOT EXISTS (
+					SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.enabled_at IS NOT NULL
+				) AS mfa_missing
+			FROM users u
+			JOIN roles r ON r.id = u.role_id
+			WHERE u.id = $1 AND u.deleted_at IS NULL`,
+			row.UserID.String,
+		)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrInvalidAPIKey
+			}
+			return nil, err
+		}
+		if user.PasswordResetRequired {
+			return nil, ErrInvalidAPIKey
+		}
+
+		var rolePermissions []string
+		if !user.MFAMissing {
+			err = v.db.Select(&rolePermissions, `
+				SELECT p.name FROM users u
+				JOIN role_permissions rp ON rp.role_id = u.role_id
+				JOIN permissions p ON p.id = rp.permission_id
+				WHERE u.id = $1`,
+				row.UserID.String,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !user.EmailVerified.Valid {
+			rolePermissions = slices.DeleteFunc(rolePermissions, func(permission string) bool {
+				return slices.Contains(v.verifiedEmailPermissions, permission)
+			})
+		}
+
+		claims.ID = row.UserID.String
+		claims.Name = user.Name
+		claims.Email = user.Email
+		claims.EmailVerified = user.EmailVerified.Valid
+		claims.Permissions = slices.DeleteFunc(claims.Permissions, func(scope string) bool {
+			return !slices.Contains(rolePermissions, scope)
+		})
+	}
+
+	// last used times are informational, a failed write must not fail the
+	// request
+	_, _ = v.db.Exec(
+		"UPDATE api_keys SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)",
+		now, row.ID, now.Add(-apiKeyTouchInterval),
+	)
+
+	return claims, nil
+}
+
+// GenerateAPIKey returns a new key, the prefix shown to identify it later
+// and the hash to store.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	secret, err := RandomString(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + secret
+	return key, key[:len(apiKeyPrefix)+8], HashToken(key), nil
+}
@@ -15,9 +15,24 @@ type Cache struct {
 type CacheService interface {
 	Ping() error
 	Get(key string) ([]byte, error)
+	// GetDel returns the value of key and deletes it in one step, so that
+	// concurrent callers cannot both read a single use value.
+	GetDel(key string) ([]byte, error)
 	Set(key string, value []byte, ttl int64) error
+	SetNX(key string, value []byte, ttl int64) (bool, error)
 	Exists(key string) (bool, error)
 	Delete(key string) error
+	// Incr increments the counter at key and returns its new value. The ttl
+	// is applied when the counter is created.
+	Incr(key string, ttl int64) (int64, error)
+	// Decr decrements the counter at key and returns its new value. Counters
+	// reaching zero are removed.
+	Decr(key string) (int64, error)
+	// TTL returns the remaining time to live of key in seconds, -2 when the
+	// key does not exist and -1 when it has no expiry.
+	TTL(key string) (int64, error)
+	// Keys returns the keys matching pattern, iterating with SCAN.
+	Keys(pattern string) ([]string, error)
 }
 
 var (
@@ -85,6 +100,20 @@ func (c *Cache) Get(key string) ([]byte, error) {
 	return data, nil
 }
 
+func (c *Cache) GetDel(key string) ([]byte, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GETDEL", key))
+	if err != nil {
+		c.Logger.Error("failed to get and delete data from redis", zap.Error(err))
+		return nil, err
+	}
+
+	c.Logger.Info("data retrieved and deleted from redis", zap.String("key", key))
+	return data, nil
+}
+
 func (c *Cache) Set(key string, value []byte, ttl int64) error {
 	conn := c.Pool.Get()
 	defer conn.Close()
@@ -107,6 +136,26 @@ func (c *Cache) Set(key string, value []byte, ttl int64) error {
 	return nil
 }
 
+// SetNX sets key only when it does not exist yet and reports whether it did.
+func (c *Cache) SetNX(key string, value []byte, ttl int64) (bool, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	args := []any{key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "EX", ttl)
+	}
+
+	reply, err := conn.Do("SET", args...)
+	if err != nil {
+		c.Logger.Error("failed to set data to redis", zap.Error(err))
+		return false, err
+	}
+
+	c.Logger.Info("data set to redis if not exists", zap.String("key", key), zap.Bool("set", reply != nil))
+	return reply != nil, nil
+}
+
 func (c *Cache) Exists(key string) (bool, error) {
 	conn := c.Pool.Get()
 	defer conn.Close()
@@ -134,3 +183,87 @@ func (c *Cache) Delete(key string) error {
 	c.Logger.Info("key deleted from redis", zap.String("key", key))
 	return nil
 }
+
+func (c *Cache) Incr(key string, ttl int64) (int64, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	count, err := redis.Int64(conn.Do("INCR", key))
+	if err != nil {
+		c.Logger.Error("failed to increment key in redis", zap.Error(err))
+		return 0, err
+	}
+
+	if count == 1 && ttl > 0 {
+		if _, err := conn.Do("EXPIRE", key, ttl); err != nil {
+			c.Logger.Error("failed to set ttl to redis", zap.Error(err))
+			return 0, err
+		}
+	}
+
+	c.Logger.Info("key incremented in redis", zap.String("key", key), zap.Int64("count", count))
+	return count, nil
+}
+
+func (c *Cache) Decr(key string) (int64, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	count, err := redis.Int64(conn.Do("DECR", key))
+	if err != nil {
+		c.Logger.Error("failed to decrement key in redis", zap.Error(err))
+		return 0, err
+	}
+
+	// a counter that expired in the meantime would otherwise come back
+	// negative and without a ttl
+	if count <= 0 {
+		if _, err := conn.Do("DEL", key); err != nil {
+			c.Logger.Error("failed to delete key from redis", zap.Error(err))
+			return 0, err
+		}
+		count = 0
+	}
+
+	c.Logger.Info("key decremented in redis", zap.String("key", key), zap.Int64("count", count))
+	return count, nil
+}
+
+func (c *Cache) TTL(key string) (int64, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	ttl, err := redis.Int64(conn.Do("TTL", key))
+	if err != nil {
+		c.Logger.Error("failed to get ttl from redis", zap.Error(err))
+		return 0, err
+	}
+
+	return ttl, nil
+}
+
+func (c *Cache) Keys(pattern string) ([]string, error) {
+	conn := c.Pool.Get()
+	defer conn.Close()
+
+	var keys []string
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil {
+			c.Logger.Error("failed to scan keys in redis", zap.Error(err))
+			return nil, err
+		}
+
+		var batch []string
+		if _, err := redis.Scan(reply, &cursor, &batch); err != nil {
+			c.Logger.Error("failed to scan keys in redis", zap.Error(err))
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TokenDenylist keeps track of tokens that were revoked before they expired.
+// Individual tokens are denied by their jti, whole logins by their family ID.
+type TokenDenylist interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	RevokeFamily(familyID string, ttl time.Duration) error
+	IsRevoked(claims *MyClaims) (bool, error)
+}
+
+type redisDenylist struct {
+	pool *redis.Pool
+}
+
+func NewTokenDenylist(pool *redis.Pool) TokenDenylist {
+	return &redisDenylist{pool: pool}
+}
+
+func revokedTokenKey(jti string) string {
+	return "revoked_token:" + jti
+}
+
+func revokedFamilyKey(familyID string) string {
+	return "revoked_family:" + familyID
+}
+
+func (d *redisDenylist) RevokeToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+
+	conn := d.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", revokedTokenKey(jti), 1, "EX", int64(ttl.Seconds())+1)
+	return err
+}
+
+// RevokeFamily denies every token of a login. ttl should cover the lifetime
+// of the longest lived token still in circulation for that family.
+func (d *redisDenylist) RevokeFamily(familyID string, ttl time.Duration) error {
+	if familyID == "" {
+		return nil
+	}
+
+	conn := d.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", revokedFamilyKey(familyID), 1, "EX", int64(ttl.Seconds())+1)
+	return err
+}
+
+func (d *redisDenylist) IsRevoked(claims *MyClaims) (bool, error) {
+	keys := redis.Args{}
+	if claims.RegisteredClaims.ID != "" {
+		keys = keys.Add(revokedTokenKey(claims.RegisteredClaims.ID))
+	}
+	if claims.FamilyID != "" {
+		keys = keys.Add(revokedFamilyKey(claims.FamilyID))
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	conn := d.pool.Get()
+	defer conn.Close()
+
+	count, err := redis.Int(conn.Do("EXISTS", keys...))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -1,29 +1,140 @@
 package utils
 
 import (
+	"crypto/rand"
 	"errors"
+	"slices"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	// MFAChallengeToken is returned by the first login step of users with
+	// multi-factor authentication and is only accepted by the second step.
+	MFAChallengeToken = "mfa_challenge"
+)
+
 type MyClaims struct {
 	jwt.RegisteredClaims
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	TokenType string `json:"token_type,omitempty"`
+	// Role and Permissions are only set on access tokens. They are a snapshot
+	// taken when the token was issued.
+	Role          string   `json:"role,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	// FamilyID identifies the login a token was issued from and is shared by
+	// its access and refresh tokens. Generation is only set on refresh tokens
+	// and is bumped on each rotation.
+	FamilyID   string `json:"fid,omitempty"`
+	Generation int    `json:"gen,omitempty"`
+	// ClientID is set on tokens issued to an OAuth client, either for the
+	// client itself or on behalf of a user. Scope lists the granted scopes,
+	// which are also its Permissions.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// APIKeyID is set when the request authenticated with an API key
+	// instead of a token.
+	APIKeyID string `json:"-"`
+	// OrgID is the organization the session acts for. OrgPermissions are
+	// granted by the user's role in it and only apply to its resources.
+	OrgID          string   `json:"org_id,omitempty"`
+	OrgRole        string   `json:"org_role,omitempty"`
+	OrgPermissions []string `json:"org_permissions,omitempty"`
+	// Act is set on tokens an administrator impersonates the user with and
+	// names that administrator, like the actor claim of RFC 8693.
+	Act *ActorClaim `json:"act,omitempty"`
 }
 
-func NewClaims(id, name, email, issuer string, duration time.Time) MyClaims {
+type ActorClaim struct {
+	ID string `json:"sub"`
+}
+
+func NewClaims(id, name, email, issuer, tokenType string, duration time.Time) MyClaims {
 	return MyClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        rand.Text(),
 			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(duration),
 		},
-		ID:    id,
-		Name:  name,
-		Email: email,
+		ID:        id,
+		Name:      name,
+		Email:     email,
+		TokenType: tokenType,
+	}
+}
+
+// IsAccessToken reports whether the token may be used to call APIs. Tokens
+// issued before token types were introduced carry no type.
+func (c *MyClaims) IsAccessToken() bool {
+	return c.TokenType == "" || c.TokenType == AccessToken
+}
+
+// IsUserSession reports whether the claims come from a user's own login,
+// rather than from an OAuth client, an API key or an impersonating
+// administrator acting for them.
+func (c *MyClaims) IsUserSession() bool {
+	return c.ClientID == "" && c.APIKeyID == "" && !c.IsImpersonated()
+}
+
+func (c *MyClaims) IsImpersonated() bool {
+	return c.Act != nil
+}
+
+func (c *MyClaims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+func (c *MyClaims) HasOrgPermission(permission string) bool {
+	return c.OrgID != "" && slices.Contains(c.OrgPermissions, permission)
+}
+
+// OrgScope returns the organization a use of permission is limited to, or
+// an empty string when the permission is held platform wide.
+func (c *MyClaims) OrgScope(permission string) string {
+	if c.HasPermission(permission) {
+		return ""
 	}
+	return c.OrgID
+}
+
+// TokenSigner issues signed tokens for a set of claims.
+type TokenSigner interface {
+	Sign(claims MyClaims) (string, error)
+}
+
+// TokenVerifier checks the signature and expiry of a token and returns its
+// claims.
+type TokenVerifier interface {
+	Verify(token string) (*MyClaims, error)
+}
+
+type hmacTokens struct {
+	secret string
+}
+
+// NewHMACSigner signs tokens with HS256 and a shared secret.
+func NewHMACSigner(secret string) TokenSigner {
+	return &hmacTokens{secret: secret}
+}
+
+// NewHMACVerifier verifies HS256 tokens signed with a shared secret.
+func NewHMACVerifier(secret string) TokenVerifier {
+	return &hmacTokens{secret: secret}
+}
+
+func (h *hmacTokens) Sign(claims MyClaims) (string, error) {
+	return GenerateToken(claims, h.secret)
+}
+
+func (h *hmacTokens) Verify(token string) (*MyClaims, error) {
+	return ParseToken(token, h.secret)
 }
 
 func GenerateToken(claim MyClaims, secret string) (string, error) {
@@ -32,23 +143,29 @@ func GenerateToken(claim MyClaims, secret string) (string, error) {
 }
 
 func ParseToken(accessToken, secret string) (*MyClaims, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &MyClaims{}, func(t *jwt.Token) (interface{}, error) {
+	return ParseTokenWithKeyFunc(accessToken, func(t *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
-	})
+	}, jwt.SigningMethodHS256.Alg())
+}
+
+// ParseTokenWithKeyFunc parses a token whose signature is checked with the
+// key returned by keyFunc. Only the given signing algorithms are accepted.
+func ParseTokenWithKeyFunc(accessToken string, keyFunc jwt.Keyfunc, algorithms ...string) (*MyClaims, error) {
+	token, err := jwt.ParseWithClaims(accessToken, &MyClaims{}, keyFunc, jwt.WithValidMethods(algorithms))
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, errors.New("token expired")
+			return nil, ErrTokenExpired
 		}
 		return nil, err
 	}
 
 	claims, ok := token.Claims.(*MyClaims)
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return nil, errors.New("token expired")
+	if !ok {
+		return nil, ErrInvalidToken
 	}
 
-	if !ok {
-		return nil, errors.New("invalid token")
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Time.Before(time.Now()) {
+		return nil, ErrTokenExpired
 	}
 
 	return claims, nil
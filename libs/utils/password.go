@@ -1,13 +1,236 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordAlgBcrypt   = "bcrypt"
+	PasswordAlgArgon2id = "argon2id"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// bcryptMaxPasswordBytes is the longest password bcrypt accepts.
+	bcryptMaxPasswordBytes = 72
+)
+
+// ErrPasswordPolicy is wrapped by the errors of PasswordPolicy.Validate.
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+// PasswordHasher hashes new passwords with one algorithm but verifies hashes
+// of every supported one, so changing the algorithm does not lock anybody
+// out.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) bool
+	// NeedsRehash reports whether hash uses another algorithm or weaker
+	// parameters than Hash would.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// NewPasswordHasher returns the hasher for algorithm, bcrypt or argon2id.
+func NewPasswordHasher(algorithm string, bcryptCost int, argon2Params Argon2Params) (PasswordHasher, error) {
+	switch algorithm {
+	case PasswordAlgBcrypt:
+		return NewBcryptHasher(bcryptCost)
+	case PasswordAlgArgon2id:
+		return NewArgon2idHasher(argon2Params)
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) (PasswordHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &bcryptHasher{cost: cost}, nil
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
 	return string(bytes), err
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func (h *bcryptHasher) Verify(password, hash string) bool {
+	return verifyPassword(password, hash)
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.cost
+}
+
+type argon2idHasher struct {
+	params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) (PasswordHasher, error) {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+	return &argon2idHasher{params: params}, nil
+}
+
+// Hash encodes the hash in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(password, hash string) bool {
+	return verifyPassword(password, hash)
+}
+
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism < h.params.Parallelism ||
+		len(key) < argon2KeyLength
+}
+
+// verifyPassword checks password against a bcrypt or argon2id hash.
+func verifyPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func decodeArgon2id(hash string) (params Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgArgon2id {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, err
+	}
+	if len(key) == 0 || params.Iterations < 1 || params.Parallelism < 1 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
+
+// PasswordPolicy decides which new passwords users may choose.
+type PasswordPolicy interface {
+	Validate(password string) error
+}
+
+type passwordPolicy struct {
+	minLength int
+	maxLength int
+	// maxBytes limits the encoded length for hash algorithms that cannot
+	// take longer passwords, 0 for none.
+	maxBytes int
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy loads the breached passwords from breachedListPath, a
+// file with one password per line, when it is not empty. The list is
+// matched case-insensitively. algorithm is the one new passwords are hashed
+// with; bcrypt additionally limits passwords to 72 bytes.
+func NewPasswordPolicy(algorithm string, minLength, maxLength int, breachedListPath string) (PasswordPolicy, error) {
+	policy := &passwordPolicy{
+		minLength: minLength,
+		maxLength: maxLength,
+		breached:  make(map[string]struct{}),
+	}
+	if algorithm == PasswordAlgBcrypt {
+		policy.maxBytes = bcryptMaxPasswordBytes
+	}
+	if breachedListPath == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachedListPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			policy.breached[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading breached password list: %w", err)
+	}
+
+	return policy, nil
+}
+
+func (p *passwordPolicy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrPasswordPolicy, p.minLength)
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		return fmt.Errorf("%w: it must be at most %d characters long", ErrPasswordPolicy, p.maxLength)
+	}
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		return fmt.Errorf("%w: it must be at most %d bytes long", ErrPasswordPolicy, p.maxBytes)
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: it appears in a list of breached passwords", ErrPasswordPolicy)
+	}
+	return nil
 }
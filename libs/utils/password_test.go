@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testArgon2Params keep the tests fast, they are not meant for production.
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func newTestHasher(t *testing.T, algorithm string, bcryptCost int, params Argon2Params) PasswordHasher {
+	t.Helper()
+
+	hasher, err := NewPasswordHasher(algorithm, bcryptCost, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"argon2id", newTestHasher(t, PasswordAlgArgon2id, 0, testArgon2Params)},
+		{"bcrypt", newTestHasher(t, PasswordAlgBcrypt, 4, Argon2Params{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(hash, "$") || strings.Contains(hash, "correct horse") {
+				t.Fatalf("hash = %q", hash)
+			}
+			if !tt.hasher.Verify("correct horse", hash) {
+				t.Error("password not verified")
+			}
+			if tt.hasher.Verify("wrong horse", hash) {
+				t.Error("wrong password verified")
+			}
+			if tt.hasher.NeedsRehash(hash) {
+				t.Error("fresh hash needs rehash")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherVerifiesOtherAlgorithm(t *testing.T) {
+	argon2id := newTestHasher(t, PasswordAlgArgon2id, 0, testArgon2Params)
+	bcrypt := newTestHasher(t, PasswordAlgBcrypt, 4, Argon2Params{})
+
+	bcryptHash, err := bcrypt.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !argon2id.Verify("correct horse", bcryptHash) {
+		t.Error("argon2id hasher rejected a bcrypt hash")
+	}
+	if !argon2id.NeedsRehash(bcryptHash) {
+		t.Error("bcrypt hash does not need rehash with argon2id")
+	}
+
+	argon2Hash, err := argon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bcrypt.Verify("correct horse", argon2Hash) {
+		t.Error("bcrypt hasher rejected an argon2id hash")
+	}
+	if !bcrypt.NeedsRehash(argon2Hash) {
+		t.Error("argon2id hash does not need rehash with bcrypt")
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	weak := newTestHasher(t, PasswordAlgArgon2id, 0, testArgon2Params)
+	hash, err := weak.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := newTestHasher(t, PasswordAlgBcrypt, 4, Argon2Params{}).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"same params", weak, hash, false},
+		{"more memory", newTestHasher(t, PasswordAlgArgon2id, 0, Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1}), hash, true},
+		{"more iterations", newTestHasher(t, PasswordAlgArgon2id, 0, Argon2Params{Memory: 64, Iterations: 2, Parallelism: 1}), hash, true},
+		{"more parallelism", newTestHasher(t, PasswordAlgArgon2id, 0, Argon2Params{Memory: 64, Iterations: 1, Parallelism: 2}), hash, true},
+		{"weaker params", newTestHasher(t, PasswordAlgArgon2id, 0, Argon2Params{Memory: 32, Iterations: 1, Parallelism: 1}), hash, false},
+		{"same bcrypt cost", newTestHasher(t, PasswordAlgBcrypt, 4, Argon2Params{}), bcryptHash, false},
+		{"higher bcrypt cost", newTestHasher(t, PasswordAlgBcrypt, 5, Argon2Params{}), bcryptHash, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherMalformedHash(t *testing.T) {
+	hasher := newTestHasher(t, PasswordAlgArgon2id, 0, testArgon2Params)
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"garbage", "not a hash"},
+		{"missing key", strings.Join(parts[:5], "$")},
+		{"other version", strings.Replace(hash, "$v=19$", "$v=16$", 1)},
+		{"bad params", strings.Replace(hash, parts[3], "m=x,t=1,p=1", 1)},
+		{"zero iterations", strings.Replace(hash, parts[3], "m=64,t=0,p=1", 1)},
+		{"bad salt", strings.Replace(hash, parts[4], "!!!", 1)},
+		{"empty key", strings.Join(append(parts[:5:5], ""), "$")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hasher.Verify("correct horse", tt.hash) {
+				t.Error("malformed hash verified")
+			}
+			if !hasher.NeedsRehash(tt.hash) {
+				t.Error("malformed hash does not need rehash")
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		password  string
+		wantErr   bool
+	}{
+		{"valid", PasswordAlgArgon2id, "correct horse", false},
+		{"too short", PasswordAlgArgon2id, "short", true},
+		{"too long", PasswordAlgArgon2id, strings.Repeat("a", 101), true},
+		{"multibyte counts characters", PasswordAlgArgon2id, strings.Repeat("ä", 100), false},
+		{"bcrypt byte limit", PasswordAlgBcrypt, strings.Repeat("ä", 37), true},
+		{"bcrypt at byte limit", PasswordAlgBcrypt, strings.Repeat("a", 72), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(tt.algorithm, 8, 100, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.Validate(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrPasswordPolicy) {
+				t.Errorf("err = %v, want %v", err, ErrPasswordPolicy)
+			}
+		})
+	}
+}
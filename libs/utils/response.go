@@ -46,3 +46,40 @@ func ValidationErrorResponse(w http.ResponseWriter, errors map[string]string) {
 	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(response)
 }
+
+// Pagination describes where a page of a list response stands in the whole
+// list. NextCursor is empty on the last page.
+type Pagination struct {
+	Total      int    `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PaginatedResponse is a Response whose data is a page of a list. Facets,
+// when requested, describe the whole list rather than the page.
+type PaginatedResponse struct {
+	Response
+	Pagination Pagination `json:"pagination"`
+	Facets     any        `json:"facets,omitempty"`
+}
+
+func PaginatedSuccessResponse(w http.ResponseWriter, statusCode int, message string, data any, pagination Pagination) {
+	FacetedSuccessResponse(w, statusCode, message, data, pagination, nil)
+}
+
+func FacetedSuccessResponse(w http.ResponseWriter, statusCode int, message string, data any, pagination Pagination, facets any) {
+	response := PaginatedResponse{
+		Response: Response{
+			StatusCode: 200,
+			Message:    message,
+			Data:       data,
+		},
+		Pagination: pagination,
+		Facets:     facets,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
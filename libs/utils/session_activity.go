@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// SessionActivity records when each session, identified by its refresh token
+// family, last made an authenticated request.
+type SessionActivity interface {
+	Touch(familyID string, at time.Time) error
+	// LastSeen returns the last activity of the given sessions. Sessions
+	// without recorded activity are left out.
+	LastSeen(familyIDs []string) (map[string]time.Time, error)
+}
+
+type redisSessionActivity struct {
+	pool *redis.Pool
+	ttl  time.Duration
+}
+
+// NewSessionActivity keeps the activity of a session for ttl after its last
+// request, which should match the refresh token lifetime.
+func NewSessionActivity(pool *redis.Pool, ttl time.Duration) SessionActivity {
+	return &redisSessionActivity{pool: pool, ttl: ttl}
+}
+
+func sessionLastSeenKey(familyID string) string {
+	return "session_last_seen:" + familyID
+}
+
+func (a *redisSessionActivity) Touch(familyID string, at time.Time) error {
+	if familyID == "" {
+		return nil
+	}
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", sessionLastSeenKey(familyID), at.Unix(), "EX", int64(a.ttl.Seconds()))
+	return err
+}
+
+func (a *redisSessionActivity) LastSeen(familyIDs []string) (map[string]time.Time, error) {
+	lastSeen := make(map[string]time.Time, len(familyIDs))
+	if len(familyIDs) == 0 {
+		return lastSeen, nil
+	}
+
+	keys := redis.Args{}
+	for _, familyID := range familyIDs {
+		keys = keys.Add(sessionLastSeenKey(familyID))
+	}
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Int64s(conn.Do("MGET", keys...))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		// missing keys come back as nil, which redigo converts to 0
+		if value > 0 {
+			lastSeen[familyIDs[i]] = time.Unix(value, 0)
+		}
+	}
+	return lastSeen, nil
+}
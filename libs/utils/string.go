@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -27,9 +28,16 @@ func GetStringOrPanic(key string) string {
 	return getString(key)
 }
 
+func GetStringOrDefault(key, def string) string {
+	if val := getString(key); val != "" {
+		return val
+	}
+	return def
+}
+
 func GetIntOrDefault(key string, def int) int {
 	val := getString(key)
-	if intVal, err := strconv.Atoi(val); err != nil {
+	if intVal, err := strconv.Atoi(val); err == nil {
 		return intVal
 	}
 	return def
@@ -39,3 +47,27 @@ func GetIntOrPanic(key string) int {
 	checkKey(key)
 	return GetIntOrDefault(key, 0)
 }
+
+func GetBoolOrDefault(key string, def bool) bool {
+	val := getString(key)
+	if boolVal, err := strconv.ParseBool(val); err == nil {
+		return boolVal
+	}
+	return def
+}
+
+// GetStringSliceOrDefault reads a comma separated list.
+func GetStringSliceOrDefault(key string, def []string) []string {
+	val := getString(key)
+	if val == "" {
+		return def
+	}
+
+	var values []string
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -18,3 +18,9 @@ func ValidateStruct(data any) map[string]string {
 
 	return nil
 }
+
+// ValidateVar validates a single value against a validator tag such as
+// "uuid".
+func ValidateVar(field any, tag string) error {
+	return validate.Var(field, tag)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +12,9 @@ import (
 	"github.com/ecomz/backend/auth-service/internal/service"
 	"github.com/ecomz/backend/libs/config"
 	"github.com/ecomz/backend/libs/db"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/oidc"
 	"github.com/ecomz/backend/libs/utils"
 	"go.uber.org/zap"
 )
@@ -40,21 +44,90 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to create Redis pool", zap.Error(err))
 	}
-	utils.NewCacheService(pool, logger)
+	cache := utils.NewCacheService(pool, logger)
+	denylist := utils.NewTokenDenylist(pool)
+	activity := utils.NewSessionActivity(pool, cfg.JWT.RefreshExp)
 	logger.Info("Successfully connected to Redis")
 
 	sqlDB := dbConn.GetDB()
 
 	userRepo := repository.NewUserRepository(sqlDB, pool)
 	roleRepo := repository.NewRoleRepository(sqlDB)
+	permissionRepo := repository.NewPermissionRepository(sqlDB)
+	signingKeyRepo := repository.NewSigningKeyRepository(sqlDB)
+	userTokenRepo := repository.NewUserTokenRepository(sqlDB)
+	mfaRepo := repository.NewMFARepository(sqlDB)
+	sessionRepo := repository.NewSessionRepository(sqlDB)
+	identityRepo := repository.NewIdentityRepository(sqlDB)
+	oauthClientRepo := repository.NewOAuthClientRepository(sqlDB)
+	oauthConsentRepo := repository.NewOAuthConsentRepository(sqlDB)
+	apiKeyRepo := repository.NewAPIKeyRepository(sqlDB)
+	impersonationRepo := repository.NewImpersonationRepository(sqlDB)
+	organizationRepo := repository.NewOrganizationRepository(sqlDB)
+	dataRequestRepo := repository.NewDataRequestRepository(sqlDB)
+	auditRepo := repository.NewAuditRepository(sqlDB)
 
-	userService := service.NewUserService(logger, cfg, userRepo, roleRepo)
-	roleService := service.NewRoleService(logger, roleRepo)
+	mail, err := mailer.NewMailer(cfg.Mail)
+	if err != nil {
+		logger.Fatal("Failed to create mailer", zap.Error(err))
+	}
 
-	userHandler := handler.NewUserHandler(userService)
+	keyService, err := service.NewKeyService(logger, cfg, signingKeyRepo)
+	if err != nil {
+		logger.Fatal("Failed to initialize signing keys", zap.Error(err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go keyService.Run(ctx)
+
+	passwordHasher, err := utils.NewPasswordHasher(cfg.Password.Algorithm, cfg.Password.BcryptCost, cfg.Password.Argon2)
+	if err != nil {
+		logger.Fatal("Failed to create password hasher", zap.Error(err))
+	}
+	passwordPolicy, err := utils.NewPasswordPolicy(cfg.Password.Algorithm, cfg.Password.MinLength, cfg.Password.MaxLength, cfg.Password.BreachedListPath)
+	if err != nil {
+		logger.Fatal("Failed to load password policy", zap.Error(err))
+	}
+
+	auditService := service.NewAuditService(logger, auditRepo)
+	loginThrottle := service.NewLoginThrottle(logger, cfg, cache)
+	mfaService := service.NewMFAService(logger, cfg, mfaRepo, userRepo, roleRepo)
+	accountMailer := service.NewAccountMailer(logger, cfg, userTokenRepo, mail)
+	sessionService := service.NewSessionService(logger, cfg, userRepo, roleRepo, permissionRepo, sessionRepo, organizationRepo, keyService, denylist, activity, mfaService, auditService)
+	dataRequestService := service.NewDataRequestService(logger, cfg, dataRequestRepo, userRepo, roleRepo, sessionService, accountMailer)
+	go dataRequestService.Run(ctx)
+	userService := service.NewUserService(logger, cfg, userRepo, roleRepo, userTokenRepo, denylist, keyService, cache, mfaService, loginThrottle, sessionService, accountMailer, passwordHasher, passwordPolicy, auditService)
+	profileService := service.NewProfileService(logger, cfg, userRepo, roleRepo, userTokenRepo, denylist, loginThrottle, sessionService, accountMailer, dataRequestService, passwordHasher, passwordPolicy, auditService)
+	userAdminService := service.NewUserAdminService(logger, userRepo, roleRepo, sessionService, accountMailer, dataRequestService)
+	oidcService := service.NewOIDCService(logger, cfg, userRepo, roleRepo, identityRepo, oidc.NewProviders(cfg.OIDC), cache, mfaService, sessionService, accountMailer, passwordHasher, auditService)
+	magicLinkService := service.NewMagicLinkService(logger, cfg, userRepo, userTokenRepo, cache, loginThrottle, mfaService, sessionService, accountMailer, auditService)
+	roleService := service.NewRoleService(logger, cfg, roleRepo, sessionService)
+	permissionService := service.NewPermissionService(logger, permissionRepo, roleRepo)
+	apiKeyService := service.NewAPIKeyService(logger, apiKeyRepo)
+	impersonationService := service.NewImpersonationService(logger, cfg, impersonationRepo, userRepo, roleRepo, permissionRepo, mfaService, keyService, denylist)
+	organizationService := service.NewOrganizationService(logger, cfg, organizationRepo, userRepo, mail)
+	oauthService := service.NewOAuthService(logger, cfg, oauthClientRepo, oauthConsentRepo, userRepo, roleRepo, permissionRepo, mfaService, keyService, denylist, cache)
+
+	userHandler := handler.NewUserHandler(userService, profileService, oidcService, magicLinkService, cfg.App.TrustProxyHeaders)
 	roleHandler := handler.NewRoleHandler(roleService)
+	permissionHandler := handler.NewPermissionHandler(permissionService)
+	keyHandler := handler.NewKeyHandler(keyService)
+	mfaHandler := handler.NewMFAHandler(mfaService)
+	lockoutHandler := handler.NewLockoutHandler(loginThrottle)
+	adminUserHandler := handler.NewAdminUserHandler(userAdminService)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	impersonationHandler := handler.NewImpersonationHandler(impersonationService, cfg.App.TrustProxyHeaders)
+	organizationHandler := handler.NewOrganizationHandler(organizationService)
+	dataRequestHandler := handler.NewDataRequestHandler(dataRequestService)
+	auditHandler := handler.NewAuditHandler(auditService, cfg.App.TrustProxyHeaders)
+
+	authenticator := middleware.NewAuthenticator(keyService, denylist).
+		WithSessionActivity(activity).
+		WithAPIKeys(utils.NewAPIKeyVerifier(sqlDB, cfg.Auth.VerifiedEmailPermissions))
 
-	r := router.NewRouter(userHandler, roleHandler)
+	r := router.NewRouter(authenticator, userHandler, roleHandler, permissionHandler, keyHandler, mfaHandler, lockoutHandler, adminUserHandler, oauthHandler, apiKeyHandler, impersonationHandler, organizationHandler, dataRequestHandler, auditHandler)
 
 	serverAddress := ":" + cfg.App.Port
 	log.Printf("Starting server on %s", serverAddress)
@@ -0,0 +1,8 @@
+package dto
+
+// APIKeyRequest creates an API key. Keys without ExpiresInDays never expire.
+type APIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"gte=0,lte=3650"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeySecretResponse is only returned when the key is created, it cannot
+// be retrieved later.
+type APIKeySecretResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func NewAPIKeyResponse(key *model.APIKey) APIKeyResponse {
+	res := APIKeyResponse{
+		ID:        key.ID,
+		UserID:    key.UserID.String,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.ScopeList(),
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		res.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		res.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return res
+}
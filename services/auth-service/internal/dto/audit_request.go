@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+// AuditEventListQuery holds the query parameters of the audit log listing
+// and export. Export ignores Page and Limit.
+type AuditEventListQuery struct {
+	Event    string `validate:"max=64"`
+	ActorID  string `validate:"max=64"`
+	TargetID string `validate:"max=255"`
+	IP       string `validate:"omitempty,ip"`
+	From     time.Time
+	To       time.Time
+	Page     int `validate:"gte=1"`
+	Limit    int `validate:"gte=1,lte=100"`
+}
@@ -0,0 +1,57 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+type AuditEventResponse struct {
+	ID         int64             `json:"id"`
+	Event      string            `json:"event"`
+	ActorID    string            `json:"actor_id"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	Details    map[string]string `json:"details"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Hash       string            `json:"hash"`
+}
+
+type AuditEventListResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	Page   int                  `json:"page"`
+	Limit  int                  `json:"limit"`
+	Total  int                  `json:"total"`
+}
+
+// AuditVerificationResponse reports whether the hash chain is intact.
+// LastHash can be kept elsewhere to detect later removal of the newest
+// events, which the chain alone cannot reveal.
+type AuditVerificationResponse struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *int64 `json:"broken_at"`
+	LastHash string `json:"last_hash"`
+}
+
+func NewAuditEventResponse(event *model.AuditEvent) AuditEventResponse {
+	details := map[string]string{}
+	// stored by AuditService, which only writes string maps
+	json.Unmarshal([]byte(event.Details), &details)
+
+	return AuditEventResponse{
+		ID:         event.ID,
+		Event:      event.Event,
+		ActorID:    event.ActorID,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         event.IP,
+		UserAgent:  event.UserAgent,
+		Details:    details,
+		CreatedAt:  event.CreatedAt,
+		Hash:       event.Hash,
+	}
+}
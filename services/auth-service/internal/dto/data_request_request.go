@@ -0,0 +1,10 @@
+package dto
+
+type DataErasureRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type DataRequestListQuery struct {
+	UserID string `validate:"omitempty,uuid"`
+	Limit  int    `validate:"min=1,max=100"`
+}
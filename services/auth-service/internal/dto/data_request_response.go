@@ -0,0 +1,108 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+type DataRequestResponse struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id,omitempty"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// ExpiresAt is when the archive of an export stops being available.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func NewDataRequestResponse(request *model.DataRequest) DataRequestResponse {
+	res := DataRequestResponse{
+		ID:        request.ID,
+		UserID:    request.UserID.String,
+		Kind:      request.Kind,
+		Status:    request.Status,
+		Error:     request.Error,
+		CreatedAt: request.CreatedAt,
+	}
+	if request.StartedAt.Valid {
+		res.StartedAt = &request.StartedAt.Time
+	}
+	if request.CompletedAt.Valid {
+		res.CompletedAt = &request.CompletedAt.Time
+	}
+	if request.ExpiresAt.Valid {
+		res.ExpiresAt = &request.ExpiresAt.Time
+	}
+	return res
+}
+
+// PersonalDataExport is the archive users download. Secrets such as
+// password hashes, MFA secrets and key hashes are left out.
+type PersonalDataExport struct {
+	GeneratedAt    time.Time               `json:"generated_at"`
+	User           AdminUserResponse       `json:"user"`
+	MFAEnabled     bool                    `json:"mfa_enabled"`
+	Sessions       []SessionResponse       `json:"sessions"`
+	Identities     []IdentityResponse      `json:"identities"`
+	APIKeys        []APIKeyResponse        `json:"api_keys"`
+	OAuthConsents  []ConsentResponse       `json:"oauth_consents"`
+	Organizations  []OrganizationResponse  `json:"organizations"`
+	Impersonations []ImpersonationResponse `json:"impersonations"`
+	DataRequests   []DataRequestResponse   `json:"data_requests"`
+	AuditEvents    []AuditEventResponse    `json:"audit_events"`
+}
+
+func NewPersonalDataExport(data *model.PersonalData, role *model.Role, generatedAt time.Time) PersonalDataExport {
+	res := PersonalDataExport{
+		GeneratedAt:    generatedAt,
+		User:           NewAdminUserResponse(data.User, role),
+		MFAEnabled:     data.MFA != nil && data.MFA.EnabledAt.Valid,
+		Sessions:       make([]SessionResponse, 0, len(data.Sessions)),
+		Identities:     make([]IdentityResponse, 0, len(data.Identities)),
+		APIKeys:        make([]APIKeyResponse, 0, len(data.APIKeys)),
+		OAuthConsents:  make([]ConsentResponse, 0, len(data.OAuthConsents)),
+		Organizations:  make([]OrganizationResponse, 0, len(data.Organizations)),
+		Impersonations: make([]ImpersonationResponse, 0, len(data.Impersonations)),
+		DataRequests:   make([]DataRequestResponse, 0, len(data.DataRequests)),
+		AuditEvents:    make([]AuditEventResponse, 0, len(data.AuditEvents)),
+	}
+
+	for _, session := range data.Sessions {
+		res.Sessions = append(res.Sessions, NewSessionResponse(session, session.LastSeenAt, false))
+	}
+	for _, identity := range data.Identities {
+		res.Identities = append(res.Identities, NewIdentityResponse(identity))
+	}
+	for _, key := range data.APIKeys {
+		res.APIKeys = append(res.APIKeys, NewAPIKeyResponse(key))
+	}
+	for _, consent := range data.OAuthConsents {
+		res.OAuthConsents = append(res.OAuthConsents, ConsentResponse{
+			ClientID:   consent.ClientID,
+			ClientName: data.OAuthClientNames[consent.ClientID],
+			Scopes:     consent.ScopeList(),
+			CreatedAt:  consent.CreatedAt,
+			UpdatedAt:  consent.UpdatedAt,
+		})
+	}
+	for _, organization := range data.Organizations {
+		organizationRes := NewOrganizationResponse(&organization.Organization)
+		organizationRes.Role = organization.RoleName
+		res.Organizations = append(res.Organizations, organizationRes)
+	}
+	for _, impersonation := range data.Impersonations {
+		res.Impersonations = append(res.Impersonations, NewImpersonationResponse(impersonation))
+	}
+	for _, request := range data.DataRequests {
+		res.DataRequests = append(res.DataRequests, NewDataRequestResponse(request))
+	}
+	for _, event := range data.AuditEvents {
+		res.AuditEvents = append(res.AuditEvents, NewAuditEventResponse(event))
+	}
+
+	return res
+}
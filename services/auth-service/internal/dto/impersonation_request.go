@@ -0,0 +1,12 @@
+package dto
+
+type ImpersonationRequest struct {
+	// Reason is kept in the audit trail, typically a support ticket.
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type ImpersonationListQuery struct {
+	ActorID string `validate:"omitempty,uuid"`
+	UserID  string `validate:"omitempty,uuid"`
+	Limit   int    `validate:"min=1,max=100"`
+}
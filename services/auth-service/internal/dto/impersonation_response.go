@@ -0,0 +1,56 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+// ImpersonationTokenResponse carries no refresh token, the impersonation
+// ends when the access token expires.
+type ImpersonationTokenResponse struct {
+	ImpersonationID string       `json:"impersonation_id"`
+	AccessToken     string       `json:"access_token"`
+	ExpiresIn       int64        `json:"expires_in"`
+	User            UserResponse `json:"user"`
+}
+
+// ImpersonationInfo is part of the current user while an administrator is
+// impersonating them.
+type ImpersonationInfo struct {
+	ID        string    `json:"id"`
+	ActorID   string    `json:"actor_id"`
+	ActorName string    `json:"actor_name,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ImpersonationResponse struct {
+	ID          string     `json:"id"`
+	ActorID     string     `json:"actor_id,omitempty"`
+	UserID      string     `json:"user_id,omitempty"`
+	Reason      string     `json:"reason"`
+	IP          string     `json:"ip"`
+	UserAgent   string     `json:"user_agent"`
+	Permissions []string   `json:"permissions"`
+	StartedAt   time.Time  `json:"started_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+}
+
+func NewImpersonationResponse(impersonation *model.Impersonation) ImpersonationResponse {
+	res := ImpersonationResponse{
+		ID:          impersonation.ID,
+		ActorID:     impersonation.ActorID.String,
+		UserID:      impersonation.UserID.String,
+		Reason:      impersonation.Reason,
+		IP:          impersonation.IP,
+		UserAgent:   impersonation.UserAgent,
+		Permissions: impersonation.PermissionList(),
+		StartedAt:   impersonation.StartedAt,
+		ExpiresAt:   impersonation.ExpiresAt,
+	}
+	if impersonation.EndedAt.Valid {
+		res.EndedAt = &impersonation.EndedAt.Time
+	}
+	return res
+}
@@ -0,0 +1,9 @@
+package dto
+
+type LockoutResponse struct {
+	// Kind is either "account" or "ip".
+	Kind       string `json:"kind"`
+	Subject    string `json:"subject"`
+	Failures   int64  `json:"failures"`
+	RetryAfter int64  `json:"retry_after"`
+}
@@ -0,0 +1,45 @@
+package dto
+
+// OAuthClientRequest registers a client. Clients without a secret are public
+// and can only use the authorization code grant with PKCE.
+type OAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=255"`
+	RedirectURIs []string `json:"redirect_uris" validate:"dive,url"`
+	GrantTypes   []string `json:"grant_types" validate:"required,min=1,dive,oneof=authorization_code client_credentials"`
+	Scopes       []string `json:"scopes" validate:"dive,required"`
+	Confidential bool     `json:"confidential"`
+	FirstParty   bool     `json:"first_party"`
+}
+
+// AuthorizationRequest holds the parameters of an authorization code request
+// as defined in RFC 6749 and RFC 7636.
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type" validate:"required"`
+	ClientID            string `json:"client_id" validate:"required"`
+	RedirectURI         string `json:"redirect_uri" validate:"required"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+type AuthorizationDecisionRequest struct {
+	AuthorizationRequest
+	Approve bool `json:"approve"`
+}
+
+// ClientAuthentication carries the credentials a client sent to the token
+// or introspection endpoint.
+type ClientAuthentication struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// TokenRequest is the form posted to the token endpoint.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	Scope        string
+}
@@ -0,0 +1,82 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+type OAuthClientResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	FirstParty   bool      `json:"first_party"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthClientSecretResponse is only returned when a secret is generated, it
+// cannot be retrieved later.
+type OAuthClientSecretResponse struct {
+	OAuthClientResponse
+	Secret string `json:"secret,omitempty"`
+}
+
+func NewOAuthClientResponse(client *model.OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIList(),
+		GrantTypes:   client.GrantTypeList(),
+		Scopes:       client.ScopeList(),
+		Confidential: client.Confidential(),
+		FirstParty:   client.FirstParty,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// AuthorizationResponse describes an authorization request to the user.
+// When ConsentRequired is false the frontend can approve it right away.
+type AuthorizationResponse struct {
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	ConsentRequired bool     `json:"consent_required"`
+}
+
+type AuthorizationRedirectResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// TokenResponse follows RFC 6749 section 5.1.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// IntrospectionResponse follows RFC 7662 section 2.2. Inactive tokens only
+// carry Active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+type ConsentResponse struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package dto
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+	Slug string `json:"slug" validate:"required,min=2,max=64"`
+}
+
+// InvitationRequest and MemberRoleRequest name an organization role such as
+// owner, manager or staff.
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
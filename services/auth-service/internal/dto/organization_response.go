@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
+
+type OrganizationResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	// Role is the role of the current user when listing their organizations.
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewOrganizationResponse(organization *model.Organization) OrganizationResponse {
+	return OrganizationResponse{
+		ID:        organization.ID,
+		Name:      organization.Name,
+		Slug:      organization.Slug,
+		CreatedAt: organization.CreatedAt,
+		UpdatedAt: organization.UpdatedAt,
+	}
+}
+
+type OrganizationRoleResponse struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type MemberResponse struct {
+	UserID   string    `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func NewMemberResponse(member *model.OrganizationMember) MemberResponse {
+	return MemberResponse{
+		UserID:   member.UserID,
+		Name:     member.UserName,
+		Email:    member.UserEmail,
+		Role:     member.RoleName,
+		JoinedAt: member.CreatedAt,
+	}
+}
+
+type InvitationResponse struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
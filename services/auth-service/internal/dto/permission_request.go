@@ -0,0 +1,10 @@
+package dto
+
+type PermissionRequest struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+type RolePermissionsRequest struct {
+	PermissionIDs []int `json:"permission_ids" validate:"required,dive,gt=0"`
+}
@@ -0,0 +1,21 @@
+package dto
+
+import "github.com/ecomz/backend/auth-service/internal/model"
+
+type PermissionResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func NewPermissionResponses(permissions []*model.Permission) []PermissionResponse {
+	res := make([]PermissionResponse, 0, len(permissions))
+	for _, permission := range permissions {
+		res = append(res, PermissionResponse{
+			ID:          permission.ID,
+			Name:        permission.Name,
+			Description: permission.Description.String,
+		})
+	}
+	return res
+}
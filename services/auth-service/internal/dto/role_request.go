@@ -1,5 +1,6 @@
 package dto
 
 type RoleRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	MFARequired bool   `json:"mfa_required"`
 }
@@ -1,6 +1,7 @@
 package dto
 
 type RoleResponse struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	MFARequired bool   `json:"mfa_required"`
 }
@@ -9,5 +9,79 @@ type RegisterRequest struct {
 	Name     string `json:"name" validate:"required,min=3,max=50"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
-	RoleID   int    `json:"role_id" validate:"required,numeric"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+	// OrganizationID switches the organization the session acts for, an
+	// empty string switches to none.
+	OrganizationID *string `json:"organization_id,omitempty" validate:"omitempty,eq=|uuid"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ClientInfo describes the client a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type ChangeUserRoleRequest struct {
+	RoleID int `json:"role_id" validate:"required,gt=0"`
+}
+
+// UserListQuery holds the query parameters of the admin user listing.
+type UserListQuery struct {
+	Search string `validate:"max=255"`
+	RoleID int    `validate:"gte=0"`
+	Status string `validate:"omitempty,oneof=active deleted all"`
+	Page   int    `validate:"gte=1"`
+	Limit  int    `validate:"gte=1,lte=100"`
+}
+
+// UpdateProfileRequest changes only the fields that are set. Changing the
+// email requires the current password.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name" validate:"omitempty,min=3,max=50"`
+	Email           *string `json:"email" validate:"omitempty,email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// OIDCCallbackRequest carries the query parameters the provider redirected
+// the user back with.
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
 }
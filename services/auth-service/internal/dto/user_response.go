@@ -1,30 +1,43 @@
 package dto
 
-import "github.com/ecomz/backend/auth-service/internal/model"
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+)
 
 type UserResponse struct {
-	ID     string       `json:"id"`
-	Email  string       `json:"email"`
-	Name   string       `json:"name"`
-	RoleID int          `json:"role_id"`
-	Role   RoleResponse `json:"role"`
+	ID            string       `json:"id"`
+	Email         string       `json:"email"`
+	EmailVerified bool         `json:"email_verified"`
+	PendingEmail  string       `json:"pending_email,omitempty"`
+	Name          string       `json:"name"`
+	RoleID        int          `json:"role_id"`
+	Role          RoleResponse `json:"role"`
+	// Impersonation is set while an administrator acts as the user.
+	Impersonation *ImpersonationInfo `json:"impersonation,omitempty"`
 }
 
+// LoginAndRegisiterResponse carries no tokens after registration when login
+// requires a verified email.
 type LoginAndRegisiterResponse struct {
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
+	AccessToken  string       `json:"access_token,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
 	User         UserResponse `json:"user"`
 }
 
 func NewUserResponse(user *model.User, role *model.Role) UserResponse {
 	return UserResponse{
-		ID:     user.ID,
-		Email:  user.Email,
-		Name:   user.Name,
-		RoleID: user.RoleID,
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		Name:          user.Name,
+		RoleID:        user.RoleID,
 		Role: RoleResponse{
-			ID:   role.ID,
-			Name: role.Name,
+			ID:          role.ID,
+			Name:        role.Name,
+			MFARequired: role.MFARequired,
 		},
 	}
 }
@@ -36,3 +49,81 @@ func NewLoginResponse(user *model.User, role *model.Role, accessToken, refreshTo
 		User:         NewUserResponse(user, role),
 	}
 }
+
+// AdminUserResponse is the user as seen by administrators.
+type AdminUserResponse struct {
+	UserResponse
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+}
+
+type UserListResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Page  int                 `json:"page"`
+	Limit int                 `json:"limit"`
+	Total int                 `json:"total"`
+}
+
+func NewAdminUserResponse(user *model.User, role *model.Role) AdminUserResponse {
+	res := AdminUserResponse{
+		UserResponse:          NewUserResponse(user, role),
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+	}
+	if user.DeletedAt.Valid {
+		res.DeletedAt = &user.DeletedAt.Time
+	}
+	return res
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session of the token used for the request.
+	Current bool `json:"current"`
+}
+
+func NewSessionResponse(session *model.Session, lastSeenAt time.Time, current bool) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: lastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    current,
+	}
+}
+
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// IdentityResponse is a login provider account linked to the user.
+type IdentityResponse struct {
+	ID          int        `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func NewIdentityResponse(identity *model.UserIdentity) IdentityResponse {
+	res := IdentityResponse{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+	if identity.LastLoginAt.Valid {
+		res.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return res
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+const defaultUserListLimit = 20
+
+// AdminUserHandler serves the user management endpoints. Every route is
+// expected to be wrapped by Authenticator.RequirePermission.
+type AdminUserHandler struct {
+	userAdminService service.UserAdminService
+}
+
+func NewAdminUserHandler(userAdminService service.UserAdminService) *AdminUserHandler {
+	return &AdminUserHandler{userAdminService: userAdminService}
+}
+
+func (h *AdminUserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := dto.UserListQuery{
+		Search: params.Get("search"),
+		Status: params.Get("status"),
+		Page:   1,
+		Limit:  defaultUserListLimit,
+	}
+
+	for name, target := range map[string]*int{"role_id": &query.RoleID, "page": &query.Page, "limit": &query.Limit} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = n
+	}
+
+	validationErrors := utils.ValidateStruct(query)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.userAdminService.ListUsers(query)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Users retrieved successfully", res)
+}
+
+func (h *AdminUserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.userAdminService.GetUser(userID)
+	if err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "User retrieved successfully", res)
+}
+
+func (h *AdminUserHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var changeRoleRequest dto.ChangeUserRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&changeRoleRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(changeRoleRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	if err := h.userAdminService.ChangeUserRole(claims.ID, userID, changeRoleRequest.RoleID); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "User role changed successfully", nil)
+}
+
+func (h *AdminUserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	if err := h.userAdminService.DeleteUser(claims.ID, userID); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "User deleted successfully", nil)
+}
+
+func (h *AdminUserHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	res, err := h.userAdminService.EraseUser(claims.ID, userID)
+	if err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusAccepted, "User erasure queued successfully", res)
+}
+
+func (h *AdminUserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminService.RestoreUser(userID); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "User restored successfully", nil)
+}
+
+func (h *AdminUserHandler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminService.ForcePasswordReset(userID); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Password reset forced, the user has been emailed a reset link", nil)
+}
+
+func (h *AdminUserHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.userAdminService.GetUserSessions(userID)
+	if err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+func (h *AdminUserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminService.RevokeUserSession(userID, mux.Vars(r)["session_id"]); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Session revoked successfully", nil)
+}
+
+func (h *AdminUserHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminService.RevokeUserSessions(userID); err != nil {
+		adminUserErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Sessions revoked successfully", nil)
+}
+
+func adminUserErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrSessionNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrRoleNotFound):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrCannotModifySelf):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := mux.Vars(r)["id"]
+	if err := utils.ValidateVar(userID, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return "", false
+	}
+	return userID, true
+}
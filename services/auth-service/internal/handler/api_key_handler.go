@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHandler serves the personal API key endpoints of the logged in user
+// and the administration of service keys. Every route is expected to be
+// wrapped by Authenticator.AuthenticateUser, so keys cannot create keys.
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+func (h *APIKeyHandler) CreatePersonalKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	apiKeyRequest, ok := decodeAPIKeyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.CreatePersonalKey(claims, apiKeyRequest)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "API key created successfully", key)
+}
+
+func (h *APIKeyHandler) GetPersonalKeys(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	keys, err := h.apiKeyService.GetPersonalKeys(claims.ID)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "API keys retrieved successfully", keys)
+}
+
+func (h *APIKeyHandler) RevokePersonalKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	keyID, ok := apiKeyIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.apiKeyService.RevokePersonalKey(claims.ID, keyID); err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "API key revoked successfully", nil)
+}
+
+func (h *APIKeyHandler) CreateServiceKey(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	apiKeyRequest, ok := decodeAPIKeyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.CreateServiceKey(claims, apiKeyRequest)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "API key created successfully", key)
+}
+
+// GetKeys lists the service keys, or the personal keys of the user_id query
+// parameter.
+func (h *APIKeyHandler) GetKeys(w http.ResponseWriter, r *http.Request) {
+	var (
+		keys []dto.APIKeyResponse
+		err  error
+	)
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		if err := utils.ValidateVar(userID, "uuid"); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		keys, err = h.apiKeyService.GetUserKeys(userID)
+	} else {
+		keys, err = h.apiKeyService.GetServiceKeys()
+	}
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "API keys retrieved successfully", keys)
+}
+
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := apiKeyIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.apiKeyService.RevokeKey(keyID); err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "API key revoked successfully", nil)
+}
+
+func (h *APIKeyHandler) errorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrScopeNotGranted):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func decodeAPIKeyRequest(w http.ResponseWriter, r *http.Request) (dto.APIKeyRequest, bool) {
+	var apiKeyRequest dto.APIKeyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&apiKeyRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return apiKeyRequest, false
+	}
+
+	validationErrors := utils.ValidateStruct(apiKeyRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return apiKeyRequest, false
+	}
+
+	return apiKeyRequest, true
+}
+
+func apiKeyIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	keyID := mux.Vars(r)["id"]
+	if err := utils.ValidateVar(keyID, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return "", false
+	}
+	return keyID, true
+}
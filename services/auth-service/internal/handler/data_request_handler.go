@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+const defaultDataRequestListLimit = 50
+
+// DataRequestHandler serves personal data exports. The user endpoints must
+// be wrapped by Authenticator.AuthenticateUser.
+type DataRequestHandler struct {
+	dataRequestService service.DataRequestService
+}
+
+func NewDataRequestHandler(dataRequestService service.DataRequestService) *DataRequestHandler {
+	return &DataRequestHandler{dataRequestService: dataRequestService}
+}
+
+func (h *DataRequestHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	res, err := h.dataRequestService.RequestExport(claims.ID)
+	if err != nil {
+		dataRequestErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusAccepted, "Data export requested successfully", res)
+}
+
+func (h *DataRequestHandler) GetMyDataRequests(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	res, err := h.dataRequestService.GetUserDataRequests(claims.ID)
+	if err != nil {
+		dataRequestErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Data requests retrieved successfully", res)
+}
+
+func (h *DataRequestHandler) GetMyDataRequest(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	id, ok := dataRequestIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.dataRequestService.GetUserDataRequest(claims.ID, id)
+	if err != nil {
+		dataRequestErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Data request retrieved successfully", res)
+}
+
+// DownloadExport responds with the JSON archive itself rather than the usual
+// envelope.
+func (h *DataRequestHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	id, ok := dataRequestIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := h.dataRequestService.GetArchive(claims.ID, id)
+	if err != nil {
+		dataRequestErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="personal-data-`+id+`.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// GetDataRequests lists the requests of all users, filtered by the user_id
+// query parameter.
+func (h *DataRequestHandler) GetDataRequests(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := dto.DataRequestListQuery{
+		UserID: params.Get("user_id"),
+		Limit:  defaultDataRequestListLimit,
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		query.Limit = limit
+	}
+
+	validationErrors := utils.ValidateStruct(query)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.dataRequestService.GetDataRequests(query)
+	if err != nil {
+		dataRequestErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Data requests retrieved successfully", res)
+}
+
+func dataRequestIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+	if err := utils.ValidateVar(id, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return "", false
+	}
+	return id, true
+}
+
+func dataRequestErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDataRequestNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrArchiveNotAvailable):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
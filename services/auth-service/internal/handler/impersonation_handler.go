@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+const defaultImpersonationListLimit = 50
+
+// ImpersonationHandler serves the impersonation endpoints. Starting an
+// impersonation must be wrapped by Authenticator.AuthenticateUser so an
+// impersonation token cannot start another one.
+type ImpersonationHandler struct {
+	impersonationService service.ImpersonationService
+	trustProxyHeaders    bool
+}
+
+func NewImpersonationHandler(impersonationService service.ImpersonationService, trustProxyHeaders bool) *ImpersonationHandler {
+	return &ImpersonationHandler{impersonationService: impersonationService, trustProxyHeaders: trustProxyHeaders}
+}
+
+func (h *ImpersonationHandler) Start(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var impersonationRequest dto.ImpersonationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&impersonationRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(impersonationRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.impersonationService.Start(claims, userID, impersonationRequest, clientInfo(r, h.trustProxyHeaders))
+	if err != nil {
+		impersonationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Impersonation started successfully", res)
+}
+
+// GetImpersonations lists the audit trail, filtered by the actor_id and
+// user_id query parameters.
+func (h *ImpersonationHandler) GetImpersonations(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := dto.ImpersonationListQuery{
+		ActorID: params.Get("actor_id"),
+		UserID:  params.Get("user_id"),
+		Limit:   defaultImpersonationListLimit,
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		query.Limit = limit
+	}
+
+	validationErrors := utils.ValidateStruct(query)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.impersonationService.GetImpersonations(query)
+	if err != nil {
+		impersonationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Impersonations retrieved successfully", res)
+}
+
+func (h *ImpersonationHandler) End(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := utils.ValidateVar(id, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	if err := h.impersonationService.End(id); err != nil {
+		impersonationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Impersonation ended successfully", nil)
+}
+
+// EndCurrent is called with the impersonation token itself.
+func (h *ImpersonationHandler) EndCurrent(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	if err := h.impersonationService.EndCurrent(claims); err != nil {
+		impersonationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Impersonation ended successfully", nil)
+}
+
+func impersonationErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrImpersonationNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrCannotImpersonateSelf), errors.Is(err, service.ErrImpersonationNotAllowed):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrNotImpersonating):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ecomz/backend/auth-service/internal/service"
+)
+
+type KeyHandler struct {
+	keyService service.KeyService
+}
+
+func NewKeyHandler(keyService service.KeyService) *KeyHandler {
+	return &KeyHandler{keyService: keyService}
+}
+
+// JWKS publishes the public signing keys. The document is served as is, not
+// wrapped in utils.Response, since JWT libraries expect the RFC 7517 format.
+func (h *KeyHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.keyService.JWKS())
+}
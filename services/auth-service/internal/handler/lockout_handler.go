@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+type LockoutHandler struct {
+	loginThrottle service.LoginThrottle
+}
+
+func NewLockoutHandler(loginThrottle service.LoginThrottle) *LockoutHandler {
+	return &LockoutHandler{loginThrottle: loginThrottle}
+}
+
+func (h *LockoutHandler) GetLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := h.loginThrottle.GetLockouts()
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Lockouts retrieved successfully", lockouts)
+}
+
+func (h *LockoutHandler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.loginThrottle.ClearLockout(vars["kind"], vars["subject"]); err != nil {
+		if errors.Is(err, service.ErrInvalidLockoutKind) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Lockout cleared successfully", nil)
+}
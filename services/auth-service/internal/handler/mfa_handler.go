@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+)
+
+// MFAHandler serves the TOTP enrollment endpoints. Every route is expected
+// to be wrapped by Authenticator.AuthenticateUser.
+type MFAHandler struct {
+	mfaService service.MFAService
+}
+
+func NewMFAHandler(mfaService service.MFAService) *MFAHandler {
+	return &MFAHandler{mfaService: mfaService}
+}
+
+func (h *MFAHandler) Status(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	res, err := h.mfaService.Status(claims.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication status retrieved successfully", res)
+}
+
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	res, err := h.mfaService.Enroll(claims.ID, claims.Email)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Scan the secret with your authenticator app and activate it with a code", res)
+}
+
+func (h *MFAHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.mfaService.Activate(claims.ID, code)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication enabled, store the recovery codes safely", res)
+}
+
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.Disable(claims.ID, code); err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication disabled", nil)
+}
+
+func (h *MFAHandler) errorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrMFARequiredByRole):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var mfaCodeRequest dto.MFACodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&mfaCodeRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return "", false
+	}
+
+	validationErrors := utils.ValidateStruct(mfaCodeRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return "", false
+	}
+
+	return mfaCodeRequest.Code, true
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+// OAuthHandler serves the authorization server. The token and introspection
+// endpoints speak RFC 6749 and RFC 7662 and are not wrapped in
+// utils.Response; the authorization and consent endpoints are called by our
+// frontend on behalf of the logged in user.
+type OAuthHandler struct {
+	oauthService service.OAuthService
+}
+
+func NewOAuthHandler(oauthService service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{oauthService: oauthService}
+}
+
+func (h *OAuthHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var clientRequest dto.OAuthClientRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&clientRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(clientRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	client, err := h.oauthService.CreateClient(clientRequest)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "OAuth client created successfully", client)
+}
+
+func (h *OAuthHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.oauthService.GetClients()
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "OAuth clients retrieved successfully", clients)
+}
+
+func (h *OAuthHandler) GetClient(w http.ResponseWriter, r *http.Request) {
+	client, err := h.oauthService.GetClient(mux.Vars(r)["id"])
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "OAuth client retrieved successfully", client)
+}
+
+func (h *OAuthHandler) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	client, err := h.oauthService.RotateClientSecret(mux.Vars(r)["id"])
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "OAuth client secret rotated successfully", client)
+}
+
+func (h *OAuthHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	if err := h.oauthService.DeleteClient(mux.Vars(r)["id"]); err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "OAuth client deleted successfully", nil)
+}
+
+// GetAuthorization takes the authorization request parameters the client
+// sent the user to the frontend with.
+func (h *OAuthHandler) GetAuthorization(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	query := r.URL.Query()
+	authorizationRequest := dto.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	validationErrors := utils.ValidateStruct(authorizationRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	authorization, err := h.oauthService.GetAuthorization(claims.ID, authorizationRequest)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Authorization request retrieved successfully", authorization)
+}
+
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	var decisionRequest dto.AuthorizationDecisionRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&decisionRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(decisionRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	redirect, err := h.oauthService.Authorize(claims.ID, decisionRequest.AuthorizationRequest, decisionRequest.Approve)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Authorization completed", redirect)
+}
+
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthErrorResponse(w, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: "invalid form body"})
+		return
+	}
+
+	tokenRequest := dto.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+
+	token, err := h.oauthService.Token(clientAuthentication(r), tokenRequest)
+	if err != nil {
+		oauthErrorResponse(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, token)
+}
+
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthErrorResponse(w, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: "invalid form body"})
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthErrorResponse(w, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: "token is required"})
+		return
+	}
+
+	introspection, err := h.oauthService.Introspect(clientAuthentication(r), token)
+	if err != nil {
+		oauthErrorResponse(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, introspection)
+}
+
+func (h *OAuthHandler) GetConsents(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	consents, err := h.oauthService.GetConsents(claims.ID)
+	if err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Consents retrieved successfully", consents)
+}
+
+func (h *OAuthHandler) RevokeConsent(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	if err := h.oauthService.RevokeConsent(claims.ID, mux.Vars(r)["client_id"]); err != nil {
+		h.errorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Consent revoked successfully", nil)
+}
+
+func (h *OAuthHandler) errorResponse(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	switch {
+	case errors.As(err, &oauthErr):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrOAuthClientNotFound), errors.Is(err, service.ErrConsentNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrUnknownScope), errors.Is(err, service.ErrPublicClientGrant),
+		errors.Is(err, service.ErrPublicClientSecret), errors.Is(err, service.ErrRedirectURIRequired):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// clientAuthentication reads the client credentials from HTTP Basic
+// authentication, falling back to the form body as RFC 6749 allows.
+func clientAuthentication(r *http.Request) dto.ClientAuthentication {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// the credentials are form encoded before being put in the header
+		unescapedID, idErr := url.QueryUnescape(id)
+		unescapedSecret, secretErr := url.QueryUnescape(secret)
+		if idErr == nil && secretErr == nil {
+			return dto.ClientAuthentication{ClientID: unescapedID, ClientSecret: unescapedSecret}
+		}
+		return dto.ClientAuthentication{}
+	}
+
+	return dto.ClientAuthentication{
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+	}
+}
+
+func oauthErrorResponse(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		writeOAuthJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == service.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeOAuthJSON(w, status, map[string]string{
+		"error":             oauthErr.Code,
+		"error_description": oauthErr.Description,
+	})
+}
+
+func writeOAuthJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
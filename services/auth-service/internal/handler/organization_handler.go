@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+// OrganizationHandler serves the organization endpoints. Apart from the
+// administrator listing, the service decides who may do what, the routes
+// only need an authenticated user.
+type OrganizationHandler struct {
+	organizationService service.OrganizationService
+}
+
+func NewOrganizationHandler(organizationService service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{organizationService: organizationService}
+}
+
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	var organizationRequest dto.OrganizationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&organizationRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(organizationRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.organizationService.CreateOrganization(claims, organizationRequest)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Organization created successfully", res)
+}
+
+func (h *OrganizationHandler) GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	res, err := h.organizationService.GetOrganizations()
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organizations retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) GetMyOrganizations(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	res, err := h.organizationService.GetUserOrganizations(claims.ID)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organizations retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.organizationService.GetOrganization(claims, organizationID)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organization retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var organizationRequest dto.OrganizationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&organizationRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(organizationRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.organizationService.UpdateOrganization(claims, organizationID, organizationRequest)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organization updated successfully", res)
+}
+
+func (h *OrganizationHandler) DeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.organizationService.DeleteOrganization(claims, organizationID); err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organization deleted successfully", nil)
+}
+
+func (h *OrganizationHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	res, err := h.organizationService.GetRoles()
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Organization roles retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.organizationService.GetMembers(claims, organizationID)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Members retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := memberIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var roleRequest dto.MemberRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(roleRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.organizationService.ChangeMemberRole(claims, organizationID, userID, roleRequest.Role); err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Member role changed successfully", nil)
+}
+
+func (h *OrganizationHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := memberIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.organizationService.RemoveMember(claims, organizationID, userID); err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Member removed successfully", nil)
+}
+
+func (h *OrganizationHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var invitationRequest dto.InvitationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&invitationRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(invitationRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.organizationService.Invite(claims, organizationID, invitationRequest)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Invitation sent successfully", res)
+}
+
+func (h *OrganizationHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.organizationService.GetInvitations(claims, organizationID)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Invitations retrieved successfully", res)
+}
+
+func (h *OrganizationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.Atoi(mux.Vars(r)["invitation_id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid invitation id")
+		return
+	}
+
+	if err := h.organizationService.RevokeInvitation(claims, organizationID, invitationID); err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Invitation revoked successfully", nil)
+}
+
+func (h *OrganizationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
+	var acceptRequest dto.AcceptInvitationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&acceptRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(acceptRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.organizationService.AcceptInvitation(claims, acceptRequest.Token)
+	if err != nil {
+		organizationErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Invitation accepted successfully", res)
+}
+
+func organizationIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	organizationID := mux.Vars(r)["id"]
+	if err := utils.ValidateVar(organizationID, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return "", false
+	}
+	return organizationID, true
+}
+
+func memberIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := mux.Vars(r)["user_id"]
+	if err := utils.ValidateVar(userID, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid user id")
+		return "", false
+	}
+	return userID, true
+}
+
+func organizationErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrganizationNotFound),
+		errors.Is(err, service.ErrMemberNotFound),
+		errors.Is(err, service.ErrInvitationNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrOrganizationForbidden), errors.Is(err, service.ErrInvitationEmailMismatch):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrSlugTaken), errors.Is(err, service.ErrAlreadyMember), errors.Is(err, service.ErrLastOwner):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidSlug), errors.Is(err, service.ErrOrganizationRoleNotFound):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+type PermissionHandler struct {
+	permissionService service.PermissionService
+}
+
+func NewPermissionHandler(permissionService service.PermissionService) *PermissionHandler {
+	return &PermissionHandler{permissionService: permissionService}
+}
+
+func (h *PermissionHandler) GetAllPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.permissionService.GetAllPermissions()
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Permissions retrieved successfully", dto.NewPermissionResponses(permissions))
+}
+
+func (h *PermissionHandler) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	var permissionRequest dto.PermissionRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&permissionRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(permissionRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.permissionService.CreatePermission(permissionRequest.Name, permissionRequest.Description); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Permission created successfully", nil)
+}
+
+func (h *PermissionHandler) GetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	permissions, err := h.permissionService.GetPermissionsByRoleID(roleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "role not found")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Role permissions retrieved successfully", dto.NewPermissionResponses(permissions))
+}
+
+func (h *PermissionHandler) SetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	var permissionsRequest dto.RolePermissionsRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&permissionsRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(permissionsRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.permissionService.SetRolePermissions(roleID, permissionsRequest.PermissionIDs); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, http.StatusNotFound, "role not found")
+			return
+		}
+		if errors.Is(err, service.ErrUnknownPermission) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Role permissions updated successfully", nil)
+}
@@ -2,11 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/ecomz/backend/auth-service/internal/dto"
 	"github.com/ecomz/backend/auth-service/internal/service"
 	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
 )
 
 type RoleHandler struct {
@@ -41,10 +44,93 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.roleService.CreateRole(roleRequest.Name); err != nil {
+	if err := h.roleService.CreateRole(roleRequest.Name, roleRequest.MFARequired); err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	utils.SuccessResponse(w, http.StatusOK, "Role created successfully", nil)
 }
+
+func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(roleID)
+	if err != nil {
+		roleErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Role retrieved successfully", role)
+}
+
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	var roleRequest dto.RoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(roleRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.roleService.UpdateRole(roleID, roleRequest.Name, roleRequest.MFARequired); err != nil {
+		roleErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Role updated successfully", nil)
+}
+
+// DeleteRole soft-deletes the role. Users still holding it are moved to the
+// role given by the reassign_to query parameter.
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	var replacementRoleID int
+	if reassignTo := r.URL.Query().Get("reassign_to"); reassignTo != "" {
+		replacementRoleID, err = strconv.Atoi(reassignTo)
+		if err != nil || replacementRoleID <= 0 {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid reassign_to")
+			return
+		}
+	}
+
+	if err := h.roleService.DeleteRole(roleID, replacementRoleID); err != nil {
+		roleErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Role deleted successfully", nil)
+}
+
+func roleErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidReplacementRole):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrRoleInUse), errors.Is(err, service.ErrDefaultRoleNotRemovable):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
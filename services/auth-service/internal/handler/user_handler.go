@@ -2,21 +2,41 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/ecomz/backend/auth-service/internal/dto"
 	"github.com/ecomz/backend/auth-service/internal/model"
 	"github.com/ecomz/backend/auth-service/internal/service"
 	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
-	userService service.UserService
+	userService       service.UserService
+	profileService    service.ProfileService
+	oidcService       service.OIDCService
+	magicLinkService  service.MagicLinkService
+	trustProxyHeaders bool
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(
+	userService service.UserService,
+	profileService service.ProfileService,
+	oidcService service.OIDCService,
+	magicLinkService service.MagicLinkService,
+	trustProxyHeaders bool,
+) *UserHandler {
+	return &UserHandler{
+		userService:       userService,
+		profileService:    profileService,
+		oidcService:       oidcService,
+		magicLinkService:  magicLinkService,
+		trustProxyHeaders: trustProxyHeaders,
+	}
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -34,8 +54,50 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.userService.Login(loginRequest.Email, loginRequest.Password)
+	result, challenge, err := h.userService.Login(loginRequest.Email, loginRequest.Password, h.clientInfo(r))
+	if err != nil {
+		var lockedErr *service.LoginLockedError
+		switch {
+		case errors.As(err, &lockedErr):
+			lockedResponse(w, lockedErr)
+		case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrPasswordResetRequired):
+			utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		}
+		return
+	}
+
+	if challenge != nil {
+		utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication required", challenge)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Login successful", result)
+}
+
+func (h *UserHandler) VerifyMFALogin(w http.ResponseWriter, r *http.Request) {
+	var mfaLoginRequest dto.MFALoginRequest
+
+	err := json.NewDecoder(r.Body).Decode(&mfaLoginRequest)
 	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(mfaLoginRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	result, err := h.userService.VerifyMFALogin(mfaLoginRequest.MFAToken, mfaLoginRequest.Code, h.clientInfo(r))
+	if err != nil {
+		var lockedErr *service.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			lockedResponse(w, lockedErr)
+			return
+		}
 		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
@@ -62,10 +124,13 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Name:     registerRequest.Name,
 		Email:    registerRequest.Email,
 		Password: registerRequest.Password,
-		RoleID:   registerRequest.RoleID,
 	}
-	res, err := h.userService.Register(&user)
+	res, err := h.userService.Register(&user, h.clientInfo(r))
 	if err != nil {
+		if errors.Is(err, utils.ErrPasswordPolicy) {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -73,17 +138,44 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "User registered successfully", res)
 }
 
+func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshRequest dto.RefreshTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&refreshRequest)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(refreshRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	result, err := h.userService.RefreshToken(refreshRequest.RefreshToken, refreshRequest.OrganizationID, h.clientInfo(r))
+	if err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) || errors.Is(err, service.ErrNotOrganizationMember) {
+			utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Token refreshed successfully", result)
+}
+
 func (h *UserHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 	// get token from header
-	authHeader := r.Header.Get("Authorization")
-	accessToken := strings.Split(authHeader, "Bearer ")
-	if len(accessToken) != 2 {
+	accessToken, ok := bearerToken(r)
+	if !ok {
 		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
 		return
 	}
 
 	// get user from token
-	user, err := h.userService.CurrentUser(accessToken[1])
+	user, err := h.userService.CurrentUser(accessToken)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
 		return
@@ -92,3 +184,333 @@ func (h *UserHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 	// return
 	utils.SuccessResponse(w, http.StatusOK, "User retrieved successfully", user)
 }
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	if err := h.userService.Logout(accessToken, h.clientInfo(r)); err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Logout successful", nil)
+}
+
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	if err := h.userService.LogoutAll(accessToken, h.clientInfo(r)); err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Logged out from all sessions", nil)
+}
+
+func (h *UserHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var resetRequest dto.PasswordResetRequest
+
+	err := json.NewDecoder(r.Body).Decode(&resetRequest)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(resetRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.userService.RequestPasswordReset(resetRequest.Email); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "If the email is registered, a password reset link has been sent", nil)
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var confirmRequest dto.PasswordResetConfirmRequest
+
+	err := json.NewDecoder(r.Body).Decode(&confirmRequest)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(confirmRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.userService.ResetPassword(confirmRequest.Token, confirmRequest.Password); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Password reset successfully", nil)
+}
+
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verifyRequest dto.VerifyEmailRequest
+
+	err := json.NewDecoder(r.Body).Decode(&verifyRequest)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(verifyRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.userService.VerifyEmail(verifyRequest.Token); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Email verified successfully", nil)
+}
+
+func (h *UserHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var resendRequest dto.ResendVerificationEmailRequest
+
+	err := json.NewDecoder(r.Body).Decode(&resendRequest)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(resendRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.userService.ResendVerificationEmail(resendRequest.Email); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "If the email is registered and not verified yet, a verification link has been sent", nil)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	accessToken := strings.Split(authHeader, "Bearer ")
+	if len(accessToken) != 2 || accessToken[1] == "" {
+		return "", false
+	}
+	return accessToken[1], true
+}
+
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var updateProfileRequest dto.UpdateProfileRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&updateProfileRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(updateProfileRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	user, err := h.profileService.UpdateProfile(accessToken, updateProfileRequest)
+	if err != nil {
+		profileErrorResponse(w, err)
+		return
+	}
+
+	message := "Profile updated successfully"
+	if updateProfileRequest.Email != nil && user.PendingEmail == *updateProfileRequest.Email {
+		message = "Profile updated successfully, confirm the new email address with the link sent to it"
+	}
+	utils.SuccessResponse(w, http.StatusOK, message, user)
+}
+
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var changePasswordRequest dto.ChangePasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&changePasswordRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(changePasswordRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	err := h.profileService.ChangePassword(accessToken, changePasswordRequest.CurrentPassword, changePasswordRequest.NewPassword)
+	if err != nil {
+		profileErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Password changed successfully, other sessions have been signed out", nil)
+}
+
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var deleteAccountRequest dto.DeleteAccountRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&deleteAccountRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(deleteAccountRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.profileService.DeleteAccount(accessToken, deleteAccountRequest.Password); err != nil {
+		profileErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Account closed successfully", nil)
+}
+
+// RequestErasure responds with the queued erasure, whose status can no
+// longer be polled since the account is closed.
+func (h *UserHandler) RequestErasure(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var erasureRequest dto.DataErasureRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&erasureRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(erasureRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	res, err := h.profileService.RequestErasure(accessToken, erasureRequest.Password)
+	if err != nil {
+		profileErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusAccepted, "Account closed, your personal data will be erased", res)
+}
+
+func (h *UserHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	sessions, err := h.profileService.GetSessions(accessToken)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+func (h *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	if err := h.profileService.RevokeSession(accessToken, mux.Vars(r)["session_id"], h.clientInfo(r)); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Session revoked successfully", nil)
+}
+
+func profileErrorResponse(w http.ResponseWriter, err error) {
+	var lockedErr *service.LoginLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		lockedResponse(w, lockedErr)
+	case errors.Is(err, service.ErrIncorrectPassword), errors.Is(err, service.ErrImpersonationSession):
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, utils.ErrPasswordPolicy):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNameTaken), errors.Is(err, service.ErrEmailTaken):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+	}
+}
+
+func (h *UserHandler) clientInfo(r *http.Request) dto.ClientInfo {
+	return clientInfo(r, h.trustProxyHeaders)
+}
+
+// clientInfo describes the caller, taking the IP from the reverse proxy's
+// X-Real-IP header when it is trusted.
+func clientInfo(r *http.Request, trustProxyHeaders bool) dto.ClientInfo {
+	ip := r.Header.Get("X-Real-IP")
+	if !trustProxyHeaders || ip == "" {
+		ip = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = host
+		}
+	}
+
+	return dto.ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+func lockedResponse(w http.ResponseWriter, err *service.LoginLockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(err.RetryAfter.Seconds())))
+	utils.ErrorResponse(w, http.StatusTooManyRequests, err.Error())
+}
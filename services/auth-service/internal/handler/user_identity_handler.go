@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gorilla/mux"
+)
+
+func (h *UserHandler) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	utils.SuccessResponse(w, http.StatusOK, "Login providers retrieved successfully", h.oidcService.OIDCProviders())
+}
+
+func (h *UserHandler) OIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.oidcService.OIDCAuthorizationURL(mux.Vars(r)["provider"])
+	if err != nil {
+		identityErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Authorization url created successfully", dto.AuthorizationURLResponse{AuthorizationURL: authURL})
+}
+
+func (h *UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var callbackRequest dto.OIDCCallbackRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&callbackRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(callbackRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	result, challenge, err := h.oidcService.OIDCLogin(callbackRequest.Code, callbackRequest.State, h.clientInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrPasswordResetRequired):
+			utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			identityErrorResponse(w, err)
+		}
+		return
+	}
+
+	if challenge != nil {
+		utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication required", challenge)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Login successful", result)
+}
+
+func (h *UserHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	identities, err := h.oidcService.GetIdentities(accessToken)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Identities retrieved successfully", identities)
+}
+
+func (h *UserHandler) LinkIdentityAuthorize(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	authURL, err := h.oidcService.LinkIdentityURL(accessToken, mux.Vars(r)["provider"])
+	if err != nil {
+		identityErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Authorization url created successfully", dto.AuthorizationURLResponse{AuthorizationURL: authURL})
+}
+
+func (h *UserHandler) LinkIdentityCallback(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var callbackRequest dto.OIDCCallbackRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&callbackRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(callbackRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	identity, err := h.oidcService.LinkIdentity(accessToken, callbackRequest.Code, callbackRequest.State)
+	if err != nil {
+		identityErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Identity linked successfully", identity)
+}
+
+func (h *UserHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	identityID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	if err := h.oidcService.UnlinkIdentity(accessToken, identityID); err != nil {
+		identityErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Identity unlinked successfully", nil)
+}
+
+func identityErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownProvider), errors.Is(err, service.ErrIdentityNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrIdentityInUse), errors.Is(err, service.ErrIdentityNotLinked):
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+	}
+}
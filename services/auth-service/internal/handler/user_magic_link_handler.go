@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/service"
+	"github.com/ecomz/backend/libs/utils"
+)
+
+func (h *UserHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var magicLinkRequest dto.MagicLinkRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&magicLinkRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(magicLinkRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	if err := h.magicLinkService.RequestMagicLink(magicLinkRequest.Email); err != nil {
+		magicLinkErrorResponse(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "If the email is registered, a login link has been sent", nil)
+}
+
+func (h *UserHandler) MagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	var loginRequest dto.MagicLinkLoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	validationErrors := utils.ValidateStruct(loginRequest)
+	if validationErrors != nil {
+		utils.ValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	result, challenge, err := h.magicLinkService.MagicLinkLogin(loginRequest.Token, h.clientInfo(r))
+	if err != nil {
+		magicLinkErrorResponse(w, err)
+		return
+	}
+
+	if challenge != nil {
+		utils.SuccessResponse(w, http.StatusOK, "Multi-factor authentication required", challenge)
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Login successful", result)
+}
+
+func magicLinkErrorResponse(w http.ResponseWriter, err error) {
+	var lockedErr *service.LoginLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		lockedResponse(w, lockedErr)
+	case errors.Is(err, service.ErrMagicLinkDisabled):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrMagicLinkThrottled):
+		utils.ErrorResponse(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, service.ErrInvalidMagicLink):
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
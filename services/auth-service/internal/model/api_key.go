@@ -0,0 +1,28 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// APIKey is a long lived credential sent in the X-API-Key header. Personal
+// keys belong to a user, service keys have no UserID. Only the SHA-256 of
+// the key is stored.
+type APIKey struct {
+	ID         string         `db:"id"`
+	UserID     sql.NullString `db:"user_id"`
+	Name       string         `db:"name"`
+	Prefix     string         `db:"prefix"`
+	KeyHash    string         `db:"key_hash"`
+	Scopes     string         `db:"scopes"`
+	CreatedBy  sql.NullString `db:"created_by"`
+	ExpiresAt  sql.NullTime   `db:"expires_at"`
+	LastUsedAt sql.NullTime   `db:"last_used_at"`
+	CreatedAt  time.Time      `db:"created_at"`
+	RevokedAt  sql.NullTime   `db:"revoked_at"`
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
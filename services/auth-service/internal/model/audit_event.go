@@ -0,0 +1,84 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// events of the security audit log, named <target type>.<what happened>
+const (
+	AuditLoginSucceeded    = "user.login_succeeded"
+	AuditLoginFailed       = "user.login_failed"
+	AuditRegistered        = "user.registered"
+	AuditLoggedOut         = "session.logged_out"
+	AuditLoggedOutAll      = "user.logged_out_all"
+	AuditSessionRevoked    = "session.revoked"
+	AuditRefreshTokenReuse = "session.refresh_token_reused"
+)
+
+// AuditEvent is an entry of the append-only audit log. Hash covers the
+// entry and PrevHash, the hash of the entry before it.
+//
+// IP, UserAgent and Details are personal data. Hash covers them through
+// PIIDigest, so that erasing them along with PIISalt keeps the chain intact.
+type AuditEvent struct {
+	ID         int64     `db:"id"`
+	Event      string    `db:"event"`
+	ActorID    string    `db:"actor_id"`
+	TargetType string    `db:"target_type"`
+	TargetID   string    `db:"target_id"`
+	IP         string    `db:"ip"`
+	UserAgent  string    `db:"user_agent"`
+	Details    string    `db:"details"`
+	PIISalt    string    `db:"pii_salt"`
+	PIIDigest  string    `db:"pii_digest"`
+	CreatedAt  time.Time `db:"created_at"`
+	PrevHash   string    `db:"prev_hash"`
+	Hash       string    `db:"hash"`
+}
+
+// Erased reports whether the personal data of the entry was erased.
+func (e *AuditEvent) Erased() bool {
+	return e.PIISalt == ""
+}
+
+// ComputePIIDigest returns the digest the personal data of the entry must
+// have. It is keyed with PIISalt so that it cannot be matched against
+// guessed values once the salt is erased.
+func (e *AuditEvent) ComputePIIDigest() string {
+	data, _ := json.Marshal([]string{e.IP, e.UserAgent, e.Details})
+	mac := hmac.New(sha256.New, []byte(e.PIISalt))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ComputeHash returns the hash the entry must have. CreatedAt is hashed in
+// UTC with microsecond precision, as stored by Postgres.
+func (e *AuditEvent) ComputeHash() string {
+	// encoding a list keeps the fields apart whatever they contain
+	data, _ := json.Marshal([]string{
+		e.PrevHash,
+		e.Event,
+		e.ActorID,
+		e.TargetType,
+		e.TargetID,
+		e.PIIDigest,
+		e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditEventFilter narrows down the events returned by
+// AuditRepository.GetEvents. Empty fields match everything.
+type AuditEventFilter struct {
+	Event    string
+	ActorID  string
+	TargetID string
+	IP       string
+	From     time.Time
+	To       time.Time
+}
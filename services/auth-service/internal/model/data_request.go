@@ -0,0 +1,51 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+
+	DataRequestPending   = "pending"
+	DataRequestRunning   = "running"
+	DataRequestCompleted = "completed"
+	DataRequestFailed    = "failed"
+)
+
+// DataRequest is a personal data export or erasure, processed in the
+// background. The archive of a completed export is only loaded for download.
+type DataRequest struct {
+	ID          string         `db:"id"`
+	UserID      sql.NullString `db:"user_id"`
+	Kind        string         `db:"kind"`
+	Status      string         `db:"status"`
+	RequestedBy sql.NullString `db:"requested_by"`
+	Error       string         `db:"error"`
+	Archive     []byte         `db:"archive"`
+	CreatedAt   time.Time      `db:"created_at"`
+	StartedAt   sql.NullTime   `db:"started_at"`
+	CompletedAt sql.NullTime   `db:"completed_at"`
+	ExpiresAt   sql.NullTime   `db:"expires_at"`
+}
+
+// PersonalData is everything auth-service stores about a user.
+type PersonalData struct {
+	User          *User
+	Sessions      []*Session
+	Identities    []*UserIdentity
+	MFA           *UserMFA
+	APIKeys       []*APIKey
+	OAuthConsents []*OAuthConsent
+	// OAuthClientNames maps the client IDs of OAuthConsents to their names.
+	OAuthClientNames map[string]string
+	Organizations    []*UserOrganization
+	// Impersonations are the times an administrator acted as the user.
+	Impersonations []*Impersonation
+	DataRequests   []*DataRequest
+	// AuditEvents are the audit log entries the user is the actor or the
+	// target of.
+	AuditEvents []*AuditEvent
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Impersonation records an administrator (the actor) acting as a user. Its
+// ID is the family ID of the issued token, so ending the impersonation
+// revokes the token.
+type Impersonation struct {
+	ID          string         `db:"id"`
+	ActorID     sql.NullString `db:"actor_id"`
+	UserID      sql.NullString `db:"user_id"`
+	Reason      string         `db:"reason"`
+	IP          string         `db:"ip"`
+	UserAgent   string         `db:"user_agent"`
+	Permissions string         `db:"permissions"`
+	StartedAt   time.Time      `db:"started_at"`
+	ExpiresAt   time.Time      `db:"expires_at"`
+	EndedAt     sql.NullTime   `db:"ended_at"`
+}
+
+func (i *Impersonation) PermissionList() []string {
+	return strings.Fields(i.Permissions)
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuthClient is an application allowed to request tokens. Its scopes are
+// permission names, the list fields are space separated.
+type OAuthClient struct {
+	ID           string         `db:"id"`
+	Name         string         `db:"name"`
+	SecretHash   sql.NullString `db:"secret_hash"`
+	RedirectURIs string         `db:"redirect_uris"`
+	GrantTypes   string         `db:"grant_types"`
+	Scopes       string         `db:"scopes"`
+	FirstParty   bool           `db:"first_party"`
+	CreatedAt    time.Time      `db:"created_at"`
+	UpdatedAt    time.Time      `db:"updated_at"`
+}
+
+// Confidential reports whether the client authenticates with a secret.
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash.Valid
+}
+
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+func (c *OAuthClient) GrantTypeList() []string {
+	return strings.Fields(c.GrantTypes)
+}
+
+func (c *OAuthClient) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+// OAuthConsent records the scopes a user granted to a client.
+type OAuthConsent struct {
+	UserID      string    `db:"user_id"`
+	ClientID    string    `db:"client_id"`
+	Scopes      string    `db:"scopes"`
+	TokenFamily string    `db:"token_family"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+func (c *OAuthConsent) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// OrganizationRoleOwner is given to the creator of an organization, which
+	// must always keep at least one owner.
+	OrganizationRoleOwner = "owner"
+)
+
+// Organization is a merchant selling on the marketplace.
+type Organization struct {
+	ID        string    `db:"id"`
+	Name      string    `db:"name"`
+	Slug      string    `db:"slug"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// OrganizationRole is a role within an organization. Its permissions only
+// apply to the resources of the organization.
+type OrganizationRole struct {
+	ID          int    `db:"id"`
+	Name        string `db:"name"`
+	Description string `db:"description"`
+}
+
+// OrganizationMember is a membership joined with the member's user and role.
+type OrganizationMember struct {
+	OrganizationID string    `db:"organization_id"`
+	UserID         string    `db:"user_id"`
+	RoleID         int       `db:"organization_role_id"`
+	RoleName       string    `db:"role_name"`
+	UserName       string    `db:"user_name"`
+	UserEmail      string    `db:"user_email"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// UserOrganization is an organization the user is a member of.
+type UserOrganization struct {
+	Organization
+	RoleName string `db:"role_name"`
+}
+
+// OrganizationInvitation is mailed to an address and accepted by the user
+// logged in with that address. Only the SHA-256 of its token is stored.
+type OrganizationInvitation struct {
+	ID             int            `db:"id"`
+	OrganizationID string         `db:"organization_id"`
+	Email          string         `db:"email"`
+	RoleID         int            `db:"organization_role_id"`
+	TokenHash      string         `db:"token_hash"`
+	InvitedBy      sql.NullString `db:"invited_by"`
+	ExpiresAt      time.Time      `db:"expires_at"`
+	AcceptedAt     sql.NullTime   `db:"accepted_at"`
+	CreatedAt      time.Time      `db:"created_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// RefreshFamily tracks the refresh tokens issued from a single login. Only the
+// token carrying the current generation may be exchanged; presenting an older
+// one means it was replayed and the whole family is revoked.
+type RefreshFamily struct {
+	ID         string `redis:"-"`
+	UserID     string `redis:"user_id"`
+	Generation int    `redis:"generation"`
+}
@@ -13,4 +13,8 @@ type Role struct {
 	CreatedAt time.Time    `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
 	DeleteAt  sql.NullTime `json:"deleted_at" db:"deleted_at"`
+
+	// MFARequired withholds the role's permissions from users that have not
+	// enrolled in multi-factor authentication.
+	MFARequired bool `json:"mfa_required" db:"mfa_required"`
 }
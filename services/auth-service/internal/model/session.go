@@ -0,0 +1,21 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session describes a single login. Its ID is the refresh token family ID,
+// so revoking the session revokes every token issued for it.
+type Session struct {
+	ID         string       `json:"id" db:"id"`
+	UserID     string       `json:"user_id" db:"user_id"`
+	UserAgent  string       `json:"user_agent" db:"user_agent"`
+	IP         string       `json:"ip" db:"ip"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time    `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time    `json:"expires_at" db:"expires_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at" db:"revoked_at"`
+	// OrganizationID is the organization the session acts for.
+	OrganizationID sql.NullString `json:"organization_id" db:"organization_id"`
+}
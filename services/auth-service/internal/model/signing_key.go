@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// SigningKey is an asymmetric key used to sign JWTs. A key signs new tokens
+// between ActivatesAt and RetiresAt, and stays published in the JWKS until
+// ExpiresAt so tokens it signed can still be verified.
+type SigningKey struct {
+	ID          string    `db:"id"`
+	Algorithm   string    `db:"algorithm"`
+	PrivateKey  string    `db:"private_key"`
+	ActivatesAt time.Time `db:"activates_at"`
+	RetiresAt   time.Time `db:"retires_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	CreatedAt   time.Time `db:"created_at"`
+}
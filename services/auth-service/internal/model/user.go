@@ -16,4 +16,27 @@ type User struct {
 	CreatedAt time.Time    `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
 	DeletedAt sql.NullTime `json:"deleted_at" db:"deleted_at"`
+
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at" db:"email_verified_at"`
+	// PasswordResetRequired blocks login until the password is reset.
+	PasswordResetRequired bool `json:"password_reset_required" db:"password_reset_required"`
+	// PendingEmail replaces Email once the user follows the link mailed to it.
+	PendingEmail sql.NullString `json:"pending_email" db:"pending_email"`
+	// ErasedAt is set once the personal data of the user was anonymized.
+	ErasedAt sql.NullTime `json:"erased_at" db:"erased_at"`
+}
+
+// UserFilter narrows down the users returned by UserRepository.GetUsers.
+type UserFilter struct {
+	// Search matches a part of the name or email, case-insensitively.
+	Search string
+	RoleID int
+	// Status is one of UserStatusActive, UserStatusDeleted or UserStatusAll.
+	Status string
 }
+
+const (
+	UserStatusActive  = "active"
+	UserStatusDeleted = "deleted"
+	UserStatusAll     = "all"
+)
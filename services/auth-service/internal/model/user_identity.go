@@ -0,0 +1,17 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserIdentity links an account at an external login provider to a user.
+type UserIdentity struct {
+	ID          int          `json:"id" db:"id"`
+	UserID      string       `json:"user_id" db:"user_id"`
+	Provider    string       `json:"provider" db:"provider"`
+	Subject     string       `json:"subject" db:"subject"`
+	Email       string       `json:"email" db:"email"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	LastLoginAt sql.NullTime `json:"last_login_at" db:"last_login_at"`
+}
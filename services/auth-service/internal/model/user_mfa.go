@@ -0,0 +1,17 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserMFA holds the TOTP secret of a user, encrypted at rest. The secret is
+// pending until EnabledAt is set by a first successful verification.
+type UserMFA struct {
+	UserID       string       `db:"user_id"`
+	Secret       string       `db:"secret"`
+	EnabledAt    sql.NullTime `db:"enabled_at"`
+	LastUsedStep int64        `db:"last_used_step"`
+	CreatedAt    time.Time    `db:"created_at"`
+	UpdatedAt    time.Time    `db:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+// UserToken is a single use token mailed to a user. Only the SHA-256 of the
+// token is stored.
+type UserToken struct {
+	ID        int          `db:"id"`
+	UserID    string       `db:"user_id"`
+	Purpose   string       `db:"purpose"`
+	TokenHash string       `db:"token_hash"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    sql.NullTime `db:"used_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
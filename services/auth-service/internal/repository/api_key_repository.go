@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// APIKeyRepository manages API keys. Keys are verified by
+// utils.APIKeyVerifier, which every service shares.
+type APIKeyRepository interface {
+	CreateAPIKey(key *model.APIKey) error
+	// GetAPIKeysByUserID returns the keys of the user that are not revoked.
+	GetAPIKeysByUserID(userID string) ([]*model.APIKey, error)
+	// GetServiceAPIKeys returns the service keys that are not revoked.
+	GetServiceAPIKeys() ([]*model.APIKey, error)
+	// RevokeUserAPIKey returns sql.ErrNoRows unless the key is active and
+	// belongs to the user.
+	RevokeUserAPIKey(userID, keyID string, now time.Time) error
+	RevokeAPIKey(keyID string, now time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) CreateAPIKey(key *model.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	return r.db.QueryRow(query,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.CreatedBy, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *apiKeyRepository) GetAPIKeysByUserID(userID string) ([]*model.APIKey, error) {
+	keys := []*model.APIKey{}
+	err := r.db.Select(&keys, "SELECT * FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) GetServiceAPIKeys() ([]*model.APIKey, error) {
+	keys := []*model.APIKey{}
+	err := r.db.Select(&keys, "SELECT * FROM api_keys WHERE user_id IS NULL AND revoked_at IS NULL ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) RevokeUserAPIKey(userID, keyID string, now time.Time) error {
+	return execAffectingRow(r.db,
+		"UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL",
+		now, keyID, userID,
+	)
+}
+
+func (r *apiKeyRepository) RevokeAPIKey(keyID string, now time.Time) error {
+	return execAffectingRow(r.db, "UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", now, keyID)
+}
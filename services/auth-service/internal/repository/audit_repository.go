@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// auditChainLock is the advisory lock serializing appends, so every event
+// chains to the one committed before it.
+const auditChainLock = 0x61756469
+
+type AuditRepository interface {
+	// AppendEvent sets the ID, creation time and hashes of the event.
+	AppendEvent(event *model.AuditEvent) error
+	// GetEvents returns the newest events first.
+	GetEvents(filter model.AuditEventFilter, limit, offset int) ([]*model.AuditEvent, error)
+	CountEvents(filter model.AuditEventFilter) (int, error)
+	// EachEvent calls fn with the matching events, oldest first, without
+	// loading them all. It stops at the first error of fn.
+	EachEvent(filter model.AuditEventFilter, fn func(*model.AuditEvent) error) error
+}
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) AppendEvent(event *model.AuditEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.Get(&prevHash, "SELECT COALESCE((SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1), '')")
+	if err != nil {
+		return err
+	}
+
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.PIISalt = rand.Text()
+	event.PIIDigest = event.ComputePIIDigest()
+	event.PrevHash = prevHash
+	event.Hash = event.ComputeHash()
+
+	err = tx.QueryRow(`
+		INSERT INTO audit_events (event, actor_id, target_type, target_id, ip, user_agent, details, pii_salt, pii_digest, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`,
+		event.Event, event.ActorID, event.TargetType, event.TargetID, event.IP, event.UserAgent,
+		event.Details, event.PIISalt, event.PIIDigest, event.CreatedAt, event.PrevHash, event.Hash,
+	).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *auditRepository) GetEvents(filter model.AuditEventFilter, limit, offset int) ([]*model.AuditEvent, error) {
+	where, args := auditFilterClause(filter)
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(
+		"SELECT * FROM audit_events %s ORDER BY id DESC LIMIT $%d OFFSET $%d",
+		where, len(args)-1, len(args),
+	)
+
+	events := []*model.AuditEvent{}
+	if err := r.db.Select(&events, query, args...); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *auditRepository) CountEvents(filter model.AuditEventFilter) (int, error) {
+	where, args := auditFilterClause(filter)
+
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM audit_events "+where, args...)
+	return count, err
+}
+
+func (r *auditRepository) EachEvent(filter model.AuditEventFilter, fn func(*model.AuditEvent) error) error {
+	where, args := auditFilterClause(filter)
+
+	rows, err := r.db.Queryx("SELECT * FROM audit_events "+where+" ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event model.AuditEvent
+		if err := rows.StructScan(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func auditFilterClause(filter model.AuditEventFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	for _, f := range []struct{ column, value string }{
+		{"event", filter.Event},
+		{"actor_id", filter.ActorID},
+		{"target_id", filter.TargetID},
+		{"ip", filter.IP},
+	} {
+		if f.value == "" {
+			continue
+		}
+		args = append(args, f.value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", f.column, len(args)))
+	}
+
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// dataRequestColumns leaves out the archive, which is only read for
+// download.
+const dataRequestColumns = `
+	id, user_id, kind, status, requested_by, error,
+	created_at, started_at, completed_at, expires_at`
+
+// DataRequestRepository stores personal data requests and reads and erases
+// the personal data they are about. Tables holding personal data must be
+// covered by GetPersonalData and ErasePersonalData.
+type DataRequestRepository interface {
+	CreateDataRequest(request *model.DataRequest) error
+	GetDataRequest(id string) (*model.DataRequest, error)
+	// GetDataRequests returns the newest requests first, those of userID
+	// when it is not empty.
+	GetDataRequests(userID string, limit int) ([]*model.DataRequest, error)
+	// GetOpenDataRequest returns the pending or running request of the user
+	// of the kind, or sql.ErrNoRows.
+	GetOpenDataRequest(userID, kind string) (*model.DataRequest, error)
+	// GetArchive returns sql.ErrNoRows unless the export is completed and
+	// has not expired.
+	GetArchive(id string, now time.Time) ([]byte, error)
+	// ClaimDataRequest marks the oldest pending request as running and
+	// returns it. Requests started before staleBefore are claimed again. It
+	// returns sql.ErrNoRows when there is nothing to do.
+	ClaimDataRequest(now, staleBefore time.Time) (*model.DataRequest, error)
+	CompleteDataRequest(id string, archive []byte, now time.Time, expiresAt sql.NullTime) error
+	FailDataRequest(id, message string, now time.Time) error
+	// DeleteExpiredArchives drops the archives of expired exports.
+	DeleteExpiredArchives(now time.Time) error
+
+	GetPersonalData(userID string) (*model.PersonalData, error)
+	// ErasePersonalData deletes what only describes the user and anonymizes
+	// the user row, which other records keep referencing.
+	ErasePersonalData(userID string, now time.Time) error
+}
+
+type dataRequestRepository struct {
+	db *sqlx.DB
+}
+
+func NewDataRequestRepository(db *sqlx.DB) DataRequestRepository {
+	return &dataRequestRepository{db: db}
+}
+
+func (r *dataRequestRepository) CreateDataRequest(request *model.DataRequest) error {
+	return r.db.QueryRow(
+		"INSERT INTO data_requests (user_id, kind, requested_by) VALUES ($1, $2, $3) RETURNING id, status, created_at",
+		request.UserID, request.Kind, request.RequestedBy,
+	).Scan(&request.ID, &request.Status, &request.CreatedAt)
+}
+
+func (r *dataRequestRepository) GetDataRequest(id string) (*model.DataRequest, error) {
+	var request model.DataRequest
+	err := r.db.Get(&request, "SELECT"+dataRequestColumns+" FROM data_requests WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *dataRequestRepository) GetDataRequests(userID string, limit int) ([]*model.DataRequest, error) {
+	requests := []*model.DataRequest{}
+	err := r.db.Select(&requests, `
+		SELECT`+dataRequestColumns+` FROM data_requests
+		WHERE $1 = '' OR user_id = NULLIF($1, '')::uuid
+		ORDER BY created_at DESC LIMIT $2`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *dataRequestRepository) GetOpenDataRequest(userID, kind string) (*model.DataRequest, error) {
+	var request model.DataRequest
+	err := r.db.Get(&request, `
+		SELECT`+dataRequestColumns+` FROM data_requests
+		WHERE user_id = $1 AND kind = $2 AND status IN ('pending', 'running')
+		ORDER BY created_at DESC LIMIT 1`,
+		userID, kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *dataRequestRepository) GetArchive(id string, now time.Time) ([]byte, error) {
+	var archive []byte
+	err := r.db.Get(&archive, `
+		SELECT archive FROM data_requests
+		WHERE id = $1 AND status = 'completed' AND archive IS NOT NULL AND expires_at > $2`,
+		id, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (r *dataRequestRepository) ClaimDataRequest(now, staleBefore time.Time) (*model.DataRequest, error) {
+	var request model.DataRequest
+	err := r.db.Get(&request, `
+		UPDATE data_requests SET status = 'running', started_at = $1, error = ''
+		WHERE id = (
+			SELECT id FROM data_requests
+			WHERE status = 'pending' OR (status = 'running' AND started_at < $2)
+			ORDER BY created_at LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING`+dataRequestColumns,
+		now, staleBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *dataRequestRepository) CompleteDataRequest(id string, archive []byte, now time.Time, expiresAt sql.NullTime) error {
+	return execAffectingRow(r.db,
+		"UPDATE data_requests SET status = 'completed', archive = $1, completed_at = $2, expires_at = $3 WHERE id = $4",
+		archive, now, expiresAt, id,
+	)
+}
+
+func (r *dataRequestRepository) FailDataRequest(id, message string, now time.Time) error {
+	return execAffectingRow(r.db,
+		"UPDATE data_requests SET status = 'failed', error = $1, completed_at = $2 WHERE id = $3",
+		message, now, id,
+	)
+}
+
+func (r *dataRequestRepository) DeleteExpiredArchives(now time.Time) error {
+	_, err := r.db.Exec(
+		"UPDATE data_requests SET archive = NULL WHERE archive IS NOT NULL AND expires_at <= $1",
+		now,
+	)
+	return err
+}
+
+// userAuditEventsCondition matches the audit events of the user given as $1.
+const userAuditEventsCondition = "(actor_id = $1 OR target_id = $1)"
+
+func (r *dataRequestRepository) GetPersonalData(userID string) (*model.PersonalData, error) {
+	data := &model.PersonalData{
+		User:             &model.User{},
+		Sessions:         []*model.Session{},
+		Identities:       []*model.UserIdentity{},
+		APIKeys:          []*model.APIKey{},
+		OAuthConsents:    []*model.OAuthConsent{},
+		OAuthClientNames: map[string]string{},
+		Organizations:    []*model.UserOrganization{},
+		Impersonations:   []*model.Impersonation{},
+		DataRequests:     []*model.DataRequest{},
+		AuditEvents:      []*model.AuditEvent{},
+	}
+
+	if err := r.db.Get(data.User, "SELECT * FROM users WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	queries := []struct {
+		dest  any
+		query string
+	}{
+		{&data.Sessions, "SELECT * FROM sessions WHERE user_id = $1 ORDER BY created_at"},
+		{&data.Identities, "SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at"},
+		{&data.APIKeys, "SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at"},
+		{&data.OAuthConsents, "SELECT * FROM oauth_consents WHERE user_id = $1 ORDER BY created_at"},
+		{&data.Organizations, `
+			SELECT o.*, r.name AS role_name FROM organizations o
+			JOIN organization_members m ON m.organization_id = o.id
+			JOIN organization_roles r ON r.id = m.organization_role_id
+			WHERE m.user_id = $1
+			ORDER BY o.name`},
+		{&data.Impersonations, "SELECT * FROM impersonations WHERE user_id = $1 ORDER BY started_at"},
+		{&data.DataRequests, "SELECT" + dataRequestColumns + " FROM data_requests WHERE user_id = $1 ORDER BY created_at"},
+		{&data.AuditEvents, "SELECT * FROM audit_events WHERE " + userAuditEventsCondition + " ORDER BY id"},
+	}
+	for _, q := range queries {
+		if err := r.db.Select(q.dest, q.query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var mfa model.UserMFA
+	err := r.db.Get(&mfa, "SELECT * FROM user_mfa WHERE user_id = $1", userID)
+	switch {
+	case err == nil:
+		data.MFA = &mfa
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	var clients []struct {
+		ID   string `db:"id"`
+		Name string `db:"name"`
+	}
+	err = r.db.Select(&clients, `
+		SELECT c.id, c.name FROM oauth_clients c
+		JOIN oauth_consents oc ON oc.client_id = c.id
+		WHERE oc.user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		data.OAuthClientNames[client.ID] = client.Name
+	}
+
+	return data, nil
+}
+
+func (r *dataRequestRepository) ErasePersonalData(userID string, now time.Time) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.Get(&email, "SELECT email FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return err
+	}
+
+	deletes := []string{
+		"DELETE FROM sessions WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM user_mfa WHERE user_id = $1",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_tokens WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM oauth_consents WHERE user_id = $1",
+		"DELETE FROM organization_members WHERE user_id = $1",
+	}
+	for _, query := range deletes {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM organization_invitations WHERE lower(email) = lower($1)", email); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE data_requests SET archive = NULL WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	// the events stay in the chain, their erased salt makes the digest of
+	// the personal data useless
+	_, err = tx.Exec(`
+		UPDATE audit_events SET ip = '', user_agent = '', details = '{}', pii_salt = ''
+		WHERE pii_salt <> '' AND (`+userAuditEventsCondition+`
+			OR details::jsonb ->> 'user_id' = $1
+			OR lower(details::jsonb ->> 'email') = lower($2))`,
+		userID, email,
+	)
+	if err != nil {
+		return err
+	}
+
+	// name and email are unique, the user ID keeps them so
+	_, err = tx.Exec(`
+		UPDATE users SET
+			name = 'erased-' || id,
+			email = 'erased-' || id || '@erased.invalid',
+			password = '',
+			pending_email = NULL,
+			email_verified_at = NULL,
+			password_reset_required = FALSE,
+			deleted_at = COALESCE(deleted_at, $2),
+			erased_at = $2,
+			updated_at = $2
+		WHERE id = $1`,
+		userID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrDuplicateIdentity = errors.New("identity is already linked")
+
+type IdentityRepository interface {
+	GetIdentity(provider, subject string) (*model.UserIdentity, error)
+	GetIdentitiesByUserID(userID string) ([]*model.UserIdentity, error)
+	// CreateIdentity returns ErrDuplicateIdentity when the provider account
+	// is already linked to a user.
+	CreateIdentity(identity *model.UserIdentity) error
+	// CreateUserWithIdentity creates a user for a provider account seen for
+	// the first time together with its identity, so that a failed link does
+	// not leave an account behind that the provider login cannot reach.
+	CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error
+	TouchIdentity(id int, email string, now time.Time) error
+	// DeleteIdentity returns sql.ErrNoRows unless the identity belongs to the
+	// user.
+	DeleteIdentity(userID string, id int) error
+}
+
+type identityRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdentityRepository(db *sqlx.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) GetIdentity(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Get(&identity, "SELECT * FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) GetIdentitiesByUserID(userID string) ([]*model.UserIdentity, error) {
+	identities := []*model.UserIdentity{}
+	err := r.db.Select(&identities, "SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *identityRepository) CreateIdentity(identity *model.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	err := r.db.QueryRow(query,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt, identity.LastLoginAt,
+	).Scan(&identity.ID)
+	if isUniqueViolation(err) {
+		return ErrDuplicateIdentity
+	}
+	return err
+}
+
+func (r *identityRepository) CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO users (name, email, password, role_id, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		user.Name, user.Email, user.Password, user.RoleID, user.EmailVerifiedAt,
+	).Scan(&user.ID)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	err = tx.QueryRow(`
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt, identity.LastLoginAt,
+	).Scan(&identity.ID)
+	if isUniqueViolation(err) {
+		return ErrDuplicateIdentity
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *identityRepository) TouchIdentity(id int, email string, now time.Time) error {
+	_, err := r.db.Exec("UPDATE user_identities SET email = $1, last_login_at = $2 WHERE id = $3", email, now, id)
+	return err
+}
+
+func (r *identityRepository) DeleteIdentity(userID string, id int) error {
+	return execAffectingRow(r.db, "DELETE FROM user_identities WHERE id = $1 AND user_id = $2", id, userID)
+}
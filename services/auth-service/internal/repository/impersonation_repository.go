@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type ImpersonationRepository interface {
+	CreateImpersonation(impersonation *model.Impersonation) error
+	GetImpersonation(id string) (*model.Impersonation, error)
+	// GetImpersonations returns the newest records first, filtered by
+	// the actor and impersonated user when they are not empty.
+	GetImpersonations(actorID, userID string, limit int) ([]*model.Impersonation, error)
+	// EndImpersonation returns sql.ErrNoRows unless the impersonation is
+	// still running.
+	EndImpersonation(id string, now time.Time) error
+}
+
+type impersonationRepository struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationRepository(db *sqlx.DB) ImpersonationRepository {
+	return &impersonationRepository{db: db}
+}
+
+func (r *impersonationRepository) CreateImpersonation(impersonation *model.Impersonation) error {
+	query := `
+		INSERT INTO impersonations (actor_id, user_id, reason, ip, user_agent, permissions, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, started_at`
+
+	return r.db.QueryRow(query,
+		impersonation.ActorID, impersonation.UserID, impersonation.Reason, impersonation.IP,
+		impersonation.UserAgent, impersonation.Permissions, impersonation.ExpiresAt,
+	).Scan(&impersonation.ID, &impersonation.StartedAt)
+}
+
+func (r *impersonationRepository) GetImpersonation(id string) (*model.Impersonation, error) {
+	var impersonation model.Impersonation
+	if err := r.db.Get(&impersonation, "SELECT * FROM impersonations WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *impersonationRepository) GetImpersonations(actorID, userID string, limit int) ([]*model.Impersonation, error) {
+	impersonations := []*model.Impersonation{}
+	err := r.db.Select(&impersonations, `
+		SELECT * FROM impersonations
+		WHERE ($1 = '' OR actor_id = NULLIF($1, '')::uuid) AND ($2 = '' OR user_id = NULLIF($2, '')::uuid)
+		ORDER BY started_at DESC LIMIT $3`,
+		actorID, userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return impersonations, nil
+}
+
+func (r *impersonationRepository) EndImpersonation(id string, now time.Time) error {
+	return execAffectingRow(r.db,
+		"UPDATE impersonations SET ended_at = $1 WHERE id = $2 AND ended_at IS NULL AND expires_at > $1",
+		now, id,
+	)
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type MFARepository interface {
+	GetMFA(userID string) (*model.UserMFA, error)
+	// SavePendingMFA stores a new secret that is not enabled yet, replacing
+	// any previous pending secret.
+	SavePendingMFA(userID, secret string) error
+	EnableMFA(userID string, step int64, recoveryCodeHashes []string) error
+	DeleteMFA(userID string) error
+	// UseStep records a successfully verified TOTP step. It reports false
+	// when the step, or a later one, was already used.
+	UseStep(userID string, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code as used and reports
+	// whether one matched.
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	CountRecoveryCodes(userID string) (int, error)
+}
+
+type mfaRepository struct {
+	db *sqlx.DB
+}
+
+func NewMFARepository(db *sqlx.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) GetMFA(userID string) (*model.UserMFA, error) {
+	var mfa model.UserMFA
+	err := r.db.Get(&mfa, "SELECT * FROM user_mfa WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (r *mfaRepository) SavePendingMFA(userID, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, updated_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL`
+
+	_, err := r.db.Exec(query, userID, secret)
+	return err
+}
+
+func (r *mfaRepository) EnableMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE user_mfa SET enabled_at = NOW(), last_used_step = $1, updated_at = NOW() WHERE user_id = $2",
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *mfaRepository) DeleteMFA(userID string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *mfaRepository) UseStep(userID string, step int64) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE user_mfa SET last_used_step = $1, updated_at = NOW() WHERE user_id = $2 AND last_used_step < $1",
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *mfaRepository) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *mfaRepository) CountRecoveryCodes(userID string) (int, error) {
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID)
+	return count, err
+}
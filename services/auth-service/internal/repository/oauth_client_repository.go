@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type OAuthClientRepository interface {
+	CreateClient(client *model.OAuthClient) error
+	GetClientByID(id string) (*model.OAuthClient, error)
+	GetAllClients() ([]*model.OAuthClient, error)
+	UpdateClientSecret(id, secretHash string) error
+	DeleteClient(id string) error
+}
+
+type oauthClientRepository struct {
+	db *sqlx.DB
+}
+
+func NewOAuthClientRepository(db *sqlx.DB) OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) CreateClient(client *model.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, grant_types, scopes, first_party)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at`
+
+	return r.db.QueryRow(query,
+		client.ID, client.Name, client.SecretHash, client.RedirectURIs, client.GrantTypes, client.Scopes, client.FirstParty,
+	).Scan(&client.CreatedAt, &client.UpdatedAt)
+}
+
+func (r *oauthClientRepository) GetClientByID(id string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	err := r.db.Get(&client, "SELECT * FROM oauth_clients WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthClientRepository) GetAllClients() ([]*model.OAuthClient, error) {
+	clients := []*model.OAuthClient{}
+	err := r.db.Select(&clients, "SELECT * FROM oauth_clients ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *oauthClientRepository) UpdateClientSecret(id, secretHash string) error {
+	return execAffectingRow(r.db,
+		"UPDATE oauth_clients SET secret_hash = $1, updated_at = NOW() WHERE id = $2 AND secret_hash IS NOT NULL",
+		secretHash, id,
+	)
+}
+
+func (r *oauthClientRepository) DeleteClient(id string) error {
+	return execAffectingRow(r.db, "DELETE FROM oauth_clients WHERE id = $1", id)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type OAuthConsentRepository interface {
+	GetConsent(userID, clientID string) (*model.OAuthConsent, error)
+	GetConsentsByUserID(userID string) ([]*model.OAuthConsent, error)
+	GetConsentsByClientID(clientID string) ([]*model.OAuthConsent, error)
+	// SaveConsent creates the consent or replaces its scopes, keeping the
+	// token family of an existing consent.
+	SaveConsent(consent *model.OAuthConsent) error
+	DeleteConsent(userID, clientID string) error
+}
+
+type oauthConsentRepository struct {
+	db *sqlx.DB
+}
+
+func NewOAuthConsentRepository(db *sqlx.DB) OAuthConsentRepository {
+	return &oauthConsentRepository{db: db}
+}
+
+func (r *oauthConsentRepository) GetConsent(userID, clientID string) (*model.OAuthConsent, error) {
+	var consent model.OAuthConsent
+	err := r.db.Get(&consent, "SELECT * FROM oauth_consents WHERE user_id = $1 AND client_id = $2", userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *oauthConsentRepository) GetConsentsByUserID(userID string) ([]*model.OAuthConsent, error) {
+	consents := []*model.OAuthConsent{}
+	err := r.db.Select(&consents, "SELECT * FROM oauth_consents WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (r *oauthConsentRepository) GetConsentsByClientID(clientID string) ([]*model.OAuthConsent, error) {
+	consents := []*model.OAuthConsent{}
+	err := r.db.Select(&consents, "SELECT * FROM oauth_consents WHERE client_id = $1", clientID)
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (r *oauthConsentRepository) SaveConsent(consent *model.OAuthConsent) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, token_family)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id)
+		DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = NOW()
+		RETURNING token_family, created_at, updated_at`
+
+	return r.db.QueryRow(query, consent.UserID, consent.ClientID, consent.Scopes, consent.TokenFamily).
+		Scan(&consent.TokenFamily, &consent.CreatedAt, &consent.UpdatedAt)
+}
+
+func (r *oauthConsentRepository) DeleteConsent(userID, clientID string) error {
+	return execAffectingRow(r.db, "DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2", userID, clientID)
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrDuplicateSlug       = errors.New("duplicate organization slug")
+	ErrDuplicateMembership = errors.New("user is already a member")
+)
+
+type OrganizationRepository interface {
+	// CreateOrganization returns ErrDuplicateSlug when the slug is taken. The
+	// owner is added as a member with ownerRoleID.
+	CreateOrganization(organization *model.Organization, ownerID string, ownerRoleID int) error
+	GetOrganization(id string) (*model.Organization, error)
+	GetOrganizations() ([]*model.Organization, error)
+	GetOrganizationsByUserID(userID string) ([]*model.UserOrganization, error)
+	// UpdateOrganization returns ErrDuplicateSlug when the slug is taken.
+	UpdateOrganization(organization *model.Organization) error
+	DeleteOrganization(id string) error
+
+	GetOrganizationRoles() ([]*model.OrganizationRole, error)
+	GetOrganizationRoleByName(name string) (*model.OrganizationRole, error)
+	GetOrganizationRolePermissions(roleID int) ([]string, error)
+
+	GetMember(organizationID, userID string) (*model.OrganizationMember, error)
+	GetMembers(organizationID string) ([]*model.OrganizationMember, error)
+	// AddMember returns ErrDuplicateMembership when the user is a member
+	// already.
+	AddMember(organizationID, userID string, roleID int) error
+	UpdateMemberRole(organizationID, userID string, roleID int) error
+	RemoveMember(organizationID, userID string) error
+	CountMembersWithRole(organizationID string, roleID int) (int, error)
+
+	CreateInvitation(invitation *model.OrganizationInvitation) error
+	// GetPendingInvitations returns the invitations that are neither
+	// accepted nor expired at now.
+	GetPendingInvitations(organizationID string, now time.Time) ([]*model.OrganizationInvitation, error)
+	// GetPendingInvitationByToken returns sql.ErrNoRows for unknown,
+	// accepted or expired tokens.
+	GetPendingInvitationByToken(tokenHash string, now time.Time) (*model.OrganizationInvitation, error)
+	// AcceptInvitation returns sql.ErrNoRows when the invitation was
+	// accepted already.
+	AcceptInvitation(id int, now time.Time) error
+	DeleteInvitation(organizationID string, id int) error
+}
+
+type organizationRepository struct {
+	db *sqlx.DB
+}
+
+func NewOrganizationRepository(db *sqlx.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+const memberColumns = `
+	m.organization_id, m.user_id, m.organization_role_id, m.created_at,
+	r.name AS role_name, u.name AS user_name, u.email AS user_email`
+
+func (r *organizationRepository) CreateOrganization(organization *model.Organization, ownerID string, ownerRoleID int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"INSERT INTO organizations (name, slug) VALUES ($1, $2) RETURNING id, created_at, updated_at",
+		organization.Name, organization.Slug,
+	).Scan(&organization.ID, &organization.CreatedAt, &organization.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateSlug
+		}
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO organization_members (organization_id, user_id, organization_role_id) VALUES ($1, $2, $3)",
+		organization.ID, ownerID, ownerRoleID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *organizationRepository) GetOrganization(id string) (*model.Organization, error) {
+	var organization model.Organization
+	if err := r.db.Get(&organization, "SELECT * FROM organizations WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (r *organizationRepository) GetOrganizations() ([]*model.Organization, error) {
+	organizations := []*model.Organization{}
+	if err := r.db.Select(&organizations, "SELECT * FROM organizations ORDER BY name"); err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+func (r *organizationRepository) GetOrganizationsByUserID(userID string) ([]*model.UserOrganization, error) {
+	organizations := []*model.UserOrganization{}
+	err := r.db.Select(&organizations, `
+		SELECT o.*, r.name AS role_name FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		JOIN organization_roles r ON r.id = m.organization_role_id
+		WHERE m.user_id = $1
+		ORDER BY o.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+func (r *organizationRepository) UpdateOrganization(organization *model.Organization) error {
+	err := r.db.QueryRow(
+		"UPDATE organizations SET name = $1, slug = $2, updated_at = NOW() WHERE id = $3 RETURNING updated_at",
+		organization.Name, organization.Slug, organization.ID,
+	).Scan(&organization.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateSlug
+	}
+	return err
+}
+
+func (r *organizationRepository) DeleteOrganization(id string) error {
+	return execAffectingRow(r.db, "DELETE FROM organizations WHERE id = $1", id)
+}
+
+func (r *organizationRepository) GetOrganizationRoles() ([]*model.OrganizationRole, error) {
+	roles := []*model.OrganizationRole{}
+	if err := r.db.Select(&roles, "SELECT * FROM organization_roles ORDER BY id"); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *organizationRepository) GetOrganizationRoleByName(name string) (*model.OrganizationRole, error) {
+	var role model.OrganizationRole
+	if err := r.db.Get(&role, "SELECT * FROM organization_roles WHERE name = $1", name); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *organizationRepository) GetOrganizationRolePermissions(roleID int) ([]string, error) {
+	permissions := []string{}
+	err := r.db.Select(&permissions, `
+		SELECT p.name FROM permissions p
+		JOIN organization_role_permissions rp ON rp.permission_id = p.id
+		WHERE rp.organization_role_id = $1
+		ORDER BY p.name`,
+		roleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *organizationRepository) GetMember(organizationID, userID string) (*model.OrganizationMember, error) {
+	var member model.OrganizationMember
+	err := r.db.Get(&member, `
+		SELECT `+memberColumns+` FROM organization_members m
+		JOIN organization_roles r ON r.id = m.organization_role_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2 AND u.deleted_at IS NULL`,
+		organizationID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *organizationRepository) GetMembers(organizationID string) ([]*model.OrganizationMember, error) {
+	members := []*model.OrganizationMember{}
+	err := r.db.Select(&members, `
+		SELECT `+memberColumns+` FROM organization_members m
+		JOIN organization_roles r ON r.id = m.organization_role_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND u.deleted_at IS NULL
+		ORDER BY m.created_at`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *organizationRepository) AddMember(organizationID, userID string, roleID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO organization_members (organization_id, user_id, organization_role_id) VALUES ($1, $2, $3)",
+		organizationID, userID, roleID,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicateMembership
+	}
+	return err
+}
+
+func (r *organizationRepository) UpdateMemberRole(organizationID, userID string, roleID int) error {
+	return execAffectingRow(r.db,
+		"UPDATE organization_members SET organization_role_id = $1 WHERE organization_id = $2 AND user_id = $3",
+		roleID, organizationID, userID,
+	)
+}
+
+func (r *organizationRepository) RemoveMember(organizationID, userID string) error {
+	return execAffectingRow(r.db,
+		"DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2",
+		organizationID, userID,
+	)
+}
+
+func (r *organizationRepository) CountMembersWithRole(organizationID string, roleID int) (int, error) {
+	var count int
+	err := r.db.Get(&count, `
+		SELECT COUNT(*) FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.organization_role_id = $2 AND u.deleted_at IS NULL`,
+		organizationID, roleID,
+	)
+	return count, err
+}
+
+func (r *organizationRepository) CreateInvitation(invitation *model.OrganizationInvitation) error {
+	query := `
+		INSERT INTO organization_invitations (organization_id, email, organization_role_id, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+
+	return r.db.QueryRow(query,
+		invitation.OrganizationID, invitation.Email, invitation.RoleID,
+		invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+}
+
+func (r *organizationRepository) GetPendingInvitations(organizationID string, now time.Time) ([]*model.OrganizationInvitation, error) {
+	invitations := []*model.OrganizationInvitation{}
+	err := r.db.Select(&invitations, `
+		SELECT * FROM organization_invitations
+		WHERE organization_id = $1 AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY created_at`,
+		organizationID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *organizationRepository) GetPendingInvitationByToken(tokenHash string, now time.Time) (*model.OrganizationInvitation, error) {
+	var invitation model.OrganizationInvitation
+	err := r.db.Get(&invitation, `
+		SELECT * FROM organization_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2`,
+		tokenHash, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *organizationRepository) AcceptInvitation(id int, now time.Time) error {
+	return execAffectingRow(r.db,
+		"UPDATE organization_invitations SET accepted_at = $1 WHERE id = $2 AND accepted_at IS NULL",
+		now, id,
+	)
+}
+
+func (r *organizationRepository) DeleteInvitation(organizationID string, id int) error {
+	return execAffectingRow(r.db,
+		"DELETE FROM organization_invitations WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL",
+		id, organizationID,
+	)
+}
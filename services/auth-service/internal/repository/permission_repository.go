@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
+type PermissionRepository interface {
+	GetAllPermissions() ([]*model.Permission, error)
+	GetPermissionsByRoleID(roleID int) ([]*model.Permission, error)
+	CreatePermission(name, description string) error
+	// SetRolePermissions returns ErrUnknownPermission when one of
+	// permissionIDs does not exist.
+	SetRolePermissions(roleID int, permissionIDs []int) error
+}
+
+type permissionRepository struct {
+	db *sqlx.DB
+}
+
+func NewPermissionRepository(db *sqlx.DB) PermissionRepository {
+	return &permissionRepository{db: db}
+}
+
+func (r *permissionRepository) GetAllPermissions() ([]*model.Permission, error) {
+	var permissions []*model.Permission
+	if err := r.db.Select(&permissions, "SELECT * FROM permissions ORDER BY name ASC"); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *permissionRepository) GetPermissionsByRoleID(roleID int) ([]*model.Permission, error) {
+	query := `
+		SELECT p.* FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		WHERE rp.role_id = $1
+		ORDER BY p.name ASC`
+
+	var permissions []*model.Permission
+	if err := r.db.Select(&permissions, query, roleID); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *permissionRepository) CreatePermission(name, description string) error {
+	_, err := r.db.Exec("INSERT INTO permissions (name, description) VALUES ($1, NULLIF($2, ''))", name, description)
+	return err
+}
+
+func (r *permissionRepository) SetRolePermissions(roleID int, permissionIDs []int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = $1", roleID); err != nil {
+		return err
+	}
+
+	for _, permissionID := range permissionIDs {
+		_, err := tx.Exec(
+			"INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			roleID, permissionID,
+		)
+		if isForeignKeyViolation(err) {
+			return ErrUnknownPermission
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
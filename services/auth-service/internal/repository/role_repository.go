@@ -1,15 +1,30 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
+
 	"github.com/ecomz/backend/auth-service/internal/model"
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	ErrRoleInUse               = errors.New("role is still assigned to users")
+	ErrReplacementRoleNotFound = errors.New("replacement role not found")
+)
+
+// RoleRepository ignores soft-deleted roles.
 type RoleRepository interface {
 	GetRoleByID(roleID int) (*model.Role, error)
+	GetRoleByName(name string) (*model.Role, error)
 	GetAllRoles() ([]*model.Role, error)
-	CreateRole(name string) error
-	DeleteRole(roleID int) error
+	CreateRole(name string, mfaRequired bool) error
+	UpdateRole(role *model.Role) error
+	// DeleteRole soft-deletes the role after moving its users to
+	// replacementRoleID and returns the IDs of the moved users. With a zero
+	// replacementRoleID it returns ErrRoleInUse while users still hold the
+	// role.
+	DeleteRole(roleID, replacementRoleID int) ([]string, error)
 }
 
 type roleRepository struct {
@@ -22,7 +37,16 @@ func NewRoleRepository(db *sqlx.DB) RoleRepository {
 
 func (r *roleRepository) GetRoleByID(roleID int) (*model.Role, error) {
 	var role model.Role
-	err := r.db.Get(&role, "SELECT * FROM roles WHERE id = $1", roleID)
+	err := r.db.Get(&role, "SELECT * FROM roles WHERE id = $1 AND deleted_at IS NULL", roleID)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) GetRoleByName(name string) (*model.Role, error) {
+	var role model.Role
+	err := r.db.Get(&role, "SELECT * FROM roles WHERE name = $1 AND deleted_at IS NULL", name)
 	if err != nil {
 		return nil, err
 	}
@@ -31,18 +55,71 @@ func (r *roleRepository) GetRoleByID(roleID int) (*model.Role, error) {
 
 func (r *roleRepository) GetAllRoles() ([]*model.Role, error) {
 	var roles []*model.Role
-	if err := r.db.Select(&roles, "SELECT * FROM roles ORDER BY name ASC"); err != nil {
+	if err := r.db.Select(&roles, "SELECT * FROM roles WHERE deleted_at IS NULL ORDER BY name ASC"); err != nil {
 		return nil, err
 	}
 	return roles, nil
 }
 
-func (r *roleRepository) CreateRole(name string) error {
-	_, err := r.db.Exec("INSERT INTO roles (name) VALUES ($1)", name)
+func (r *roleRepository) CreateRole(name string, mfaRequired bool) error {
+	_, err := r.db.Exec("INSERT INTO roles (name, mfa_required) VALUES ($1, $2)", name, mfaRequired)
 	return err
 }
 
-func (r *roleRepository) DeleteRole(roleID int) error {
-	_, err := r.db.Exec("DELETE FROM roles WHERE role_id = ?", roleID)
-	return err
+func (r *roleRepository) UpdateRole(role *model.Role) error {
+	return execAffectingRow(r.db,
+		"UPDATE roles SET name = $1, mfa_required = $2, updated_at = NOW() WHERE id = $3 AND deleted_at IS NULL",
+		role.Name, role.MFARequired, role.ID,
+	)
+}
+
+func (r *roleRepository) DeleteRole(roleID, replacementRoleID int) ([]string, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// locking the role blocks users from being assigned to it meanwhile
+	var id int
+	err = tx.Get(&id, "SELECT id FROM roles WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	movedUserIDs := []string{}
+	if replacementRoleID > 0 {
+		err = tx.Get(&id, "SELECT id FROM roles WHERE id = $1 AND deleted_at IS NULL FOR SHARE", replacementRoleID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReplacementRoleNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// soft-deleted users are moved as well, they still reference the role
+		err = tx.Select(&movedUserIDs,
+			"UPDATE users SET role_id = $1, updated_at = NOW() WHERE role_id = $2 RETURNING id",
+			replacementRoleID, roleID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var inUse bool
+		err = tx.Get(&inUse, "SELECT EXISTS (SELECT 1 FROM users WHERE role_id = $1)", roleID)
+		if err != nil {
+			return nil, err
+		}
+		if inUse {
+			return nil, ErrRoleInUse
+		}
+	}
+
+	_, err = tx.Exec("UPDATE roles SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1", roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return movedUserIDs, tx.Commit()
 }
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type SessionRepository interface {
+	CreateSession(session *model.Session) error
+	// GetActiveSessions returns the sessions of the user that are neither
+	// revoked nor expired at now, most recently used first.
+	GetActiveSessions(userID string, now time.Time) ([]*model.Session, error)
+	// GetActiveSession returns sql.ErrNoRows unless the session is active and
+	// belongs to the user.
+	GetActiveSession(userID, sessionID string, now time.Time) (*model.Session, error)
+	// TouchSession records a token refresh from ip and extends the session.
+	TouchSession(sessionID, ip string, now, expiresAt time.Time) error
+	RevokeSession(sessionID string, now time.Time) error
+	// SetSessionOrganization switches the organization the session acts
+	// for, organizationID is empty to act for none.
+	SetSessionOrganization(sessionID, organizationID string) error
+}
+
+type sessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(db *sqlx.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateSession(session *model.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $5, $6)`
+
+	_, err := r.db.Exec(query, session.ID, session.UserID, session.UserAgent, session.IP, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+func (r *sessionRepository) GetActiveSessions(userID string, now time.Time) ([]*model.Session, error) {
+	sessions := []*model.Session{}
+	err := r.db.Select(&sessions, `
+		SELECT * FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC`,
+		userID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) GetActiveSession(userID, sessionID string, now time.Time) (*model.Session, error) {
+	var session model.Session
+	err := r.db.Get(&session, `
+		SELECT * FROM sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3`,
+		sessionID, userID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) TouchSession(sessionID, ip string, now, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"UPDATE sessions SET ip = $1, last_seen_at = $2, expires_at = $3 WHERE id = $4 AND revoked_at IS NULL",
+		ip, now, expiresAt, sessionID,
+	)
+	return err
+}
+
+func (r *sessionRepository) RevokeSession(sessionID string, now time.Time) error {
+	_, err := r.db.Exec("UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", now, sessionID)
+	return err
+}
+
+func (r *sessionRepository) SetSessionOrganization(sessionID, organizationID string) error {
+	_, err := r.db.Exec(
+		"UPDATE sessions SET organization_id = $1 WHERE id = $2",
+		sql.NullString{String: organizationID, Valid: organizationID != ""}, sessionID,
+	)
+	return err
+}
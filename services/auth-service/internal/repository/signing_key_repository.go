@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// signingKeyLockID is the advisory lock taken while rotating keys so that
+// several auth-service instances do not create keys at the same time.
+const signingKeyLockID = 7321004
+
+type SigningKeyRepository interface {
+	GetValidKeys(now time.Time) ([]*model.SigningKey, error)
+	// RotateKeys runs fn while holding the rotation lock. fn receives the
+	// keys that are still valid and returns the keys to add, if any.
+	RotateKeys(now time.Time, fn func(keys []*model.SigningKey) ([]*model.SigningKey, error)) error
+	// ReplacePrivateKey swaps the stored private key of a key, unless another
+	// instance replaced it first.
+	ReplacePrivateKey(id, old, new string) error
+}
+
+type signingKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewSigningKeyRepository(db *sqlx.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+func (r *signingKeyRepository) GetValidKeys(now time.Time) ([]*model.SigningKey, error) {
+	var keys []*model.SigningKey
+	err := r.db.Select(&keys, "SELECT * FROM signing_keys WHERE expires_at > $1 ORDER BY activates_at ASC", now)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *signingKeyRepository) RotateKeys(now time.Time, fn func(keys []*model.SigningKey) ([]*model.SigningKey, error)) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", signingKeyLockID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM signing_keys WHERE expires_at <= $1", now); err != nil {
+		return err
+	}
+
+	var keys []*model.SigningKey
+	if err := tx.Select(&keys, "SELECT * FROM signing_keys ORDER BY activates_at ASC"); err != nil {
+		return err
+	}
+
+	newKeys, err := fn(keys)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range newKeys {
+		_, err := tx.NamedExec(`
+			INSERT INTO signing_keys (id, algorithm, private_key, activates_at, retires_at, expires_at)
+			VALUES (:id, :algorithm, :private_key, :activates_at, :retires_at, :expires_at)`, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *signingKeyRepository) ReplacePrivateKey(id, old, new string) error {
+	_, err := r.db.Exec("UPDATE signing_keys SET private_key = $1 WHERE id = $2 AND private_key = $3", new, id, old)
+	return err
+}
@@ -1,15 +1,74 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/ecomz/backend/auth-service/internal/model"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	ErrDuplicateName         = errors.New("name is already taken")
+	ErrDuplicateEmail        = errors.New("email is already taken")
+	ErrRefreshFamilyNotFound = errors.New("refresh token family not found")
+	ErrRefreshTokenReused    = errors.New("refresh token reuse detected")
+)
+
+// rotateRefreshScript advances the generation of a refresh family when the
+// presented generation is the current one, and deletes the family otherwise.
+// Returns 1 on rotation, 0 when the family does not exist and -1 on reuse.
+var rotateRefreshScript = redis.NewScript(1, `
+local current = redis.call('HGET', KEYS[1], 'generation')
+if not current then
+	return 0
+end
+if tonumber(current) ~= tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+	return -1
+end
+redis.call('HINCRBY', KEYS[1], 'generation', 1)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
 type UserRepository interface {
 	GetUserByEmail(email string) (*model.User, error)
 	GetUserByID(id string) (*model.User, error)
 	CreateUser(user *model.User) error
+	UpdatePassword(userID, password string) error
+	// RehashPassword replaces the stored hash with an upgraded hash of the
+	// same password, unless the password was changed in the meantime. It
+	// leaves a forced password reset pending.
+	RehashPassword(userID, oldHash, newHash string) error
+	MarkEmailVerified(userID string) error
+	// UpdateName returns ErrDuplicateName when another user has the name.
+	UpdateName(userID, name string) error
+	// NameExists also considers soft-deleted users, whose names stay
+	// reserved.
+	NameExists(name string) (bool, error)
+	SetPendingEmail(userID, email string) error
+	// ConfirmPendingEmail replaces the email with the pending one and marks it
+	// verified. It returns ErrDuplicateEmail when the address was taken in
+	// the meantime.
+	ConfirmPendingEmail(userID string) error
+
+	// GetUserByIDIncludingDeleted also returns soft-deleted users, the other
+	// lookups ignore them.
+	GetUserByIDIncludingDeleted(id string) (*model.User, error)
+	GetUsers(filter model.UserFilter, limit, offset int) ([]*model.User, error)
+	CountUsers(filter model.UserFilter) (int, error)
+	UpdateRole(userID string, roleID int) error
+	RequirePasswordReset(userID string) error
+	SoftDeleteUser(userID string) error
+	RestoreUser(userID string) error
+
+	CreateRefreshFamily(family *model.RefreshFamily, ttl time.Duration) error
+	RotateRefreshFamily(familyID string, generation int, ttl time.Duration) error
+	DeleteRefreshFamily(familyID string) error
 }
 
 type userRepository struct {
@@ -24,9 +83,13 @@ func NewUserRepository(db *sqlx.DB, redis *redis.Pool) UserRepository {
 	}
 }
 
+func refreshFamilyKey(familyID string) string {
+	return "refresh_family:" + familyID
+}
+
 func (r *userRepository) GetUserByEmail(email string) (*model.User, error) {
 	var user model.User
-	err := r.db.Get(&user, "SELECT * FROM users WHERE email = $1", email)
+	err := r.db.Get(&user, "SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL", email)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +97,51 @@ func (r *userRepository) GetUserByEmail(email string) (*model.User, error) {
 }
 
 func (r *userRepository) GetUserByID(id string) (*model.User, error) {
+	var user model.User
+	err := r.db.Get(&user, "SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) UpdateName(userID, name string) error {
+	err := execAffectingRow(r.db,
+		"UPDATE users SET name = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL",
+		name, userID,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicateName
+	}
+	return err
+}
+
+func (r *userRepository) NameExists(name string) (bool, error) {
+	var exists bool
+	err := r.db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE name = $1)", name)
+	return exists, err
+}
+
+func (r *userRepository) SetPendingEmail(userID, email string) error {
+	return execAffectingRow(r.db,
+		"UPDATE users SET pending_email = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL",
+		email, userID,
+	)
+}
+
+func (r *userRepository) ConfirmPendingEmail(userID string) error {
+	err := execAffectingRow(r.db, `
+		UPDATE users SET email = pending_email, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND pending_email IS NOT NULL AND deleted_at IS NULL`,
+		userID,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+func (r *userRepository) GetUserByIDIncludingDeleted(id string) (*model.User, error) {
 	var user model.User
 	err := r.db.Get(&user, "SELECT * FROM users WHERE id = $1", id)
 	if err != nil {
@@ -42,6 +150,86 @@ func (r *userRepository) GetUserByID(id string) (*model.User, error) {
 	return &user, nil
 }
 
+func (r *userRepository) GetUsers(filter model.UserFilter, limit, offset int) ([]*model.User, error) {
+	where, args := userFilterClause(filter)
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(
+		"SELECT * FROM users %s ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d",
+		where, len(args)-1, len(args),
+	)
+
+	users := []*model.User{}
+	if err := r.db.Select(&users, query, args...); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepository) CountUsers(filter model.UserFilter) (int, error) {
+	where, args := userFilterClause(filter)
+
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM users "+where, args...)
+	return count, err
+}
+
+func (r *userRepository) UpdateRole(userID string, roleID int) error {
+	return execAffectingRow(r.db,
+		"UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL",
+		roleID, userID,
+	)
+}
+
+func (r *userRepository) RequirePasswordReset(userID string) error {
+	return execAffectingRow(r.db,
+		"UPDATE users SET password_reset_required = TRUE, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL",
+		userID,
+	)
+}
+
+func (r *userRepository) SoftDeleteUser(userID string) error {
+	return execAffectingRow(r.db,
+		"UPDATE users SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL",
+		userID,
+	)
+}
+
+func (r *userRepository) RestoreUser(userID string) error {
+	return execAffectingRow(r.db,
+		"UPDATE users SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL AND erased_at IS NULL",
+		userID,
+	)
+}
+
+func userFilterClause(filter model.UserFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	switch filter.Status {
+	case model.UserStatusDeleted:
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	case model.UserStatusAll:
+	default:
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if filter.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Search)+"%")
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%d OR email ILIKE $%d)", len(args), len(args)))
+	}
+
+	if filter.RoleID > 0 {
+		args = append(args, filter.RoleID)
+		conditions = append(conditions, fmt.Sprintf("role_id = $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
 func (r *userRepository) CreateUser(user *model.User) error {
 	query := `
 		INSERT INTO users (name, email, password, role_id)
@@ -53,3 +241,60 @@ func (r *userRepository) CreateUser(user *model.User) error {
 	}
 	return nil
 }
+
+func (r *userRepository) UpdatePassword(userID, password string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1, password_reset_required = FALSE, updated_at = NOW() WHERE id = $2", password, userID)
+	return err
+}
+
+func (r *userRepository) RehashPassword(userID, oldHash, newHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1 WHERE id = $2 AND password = $3", newHash, userID, oldHash)
+	return err
+}
+
+func (r *userRepository) MarkEmailVerified(userID string) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email_verified_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+func (r *userRepository) CreateRefreshFamily(family *model.RefreshFamily, ttl time.Duration) error {
+	conn := r.redis.Get()
+	defer conn.Close()
+
+	key := refreshFamilyKey(family.ID)
+
+	conn.Send("MULTI")
+	conn.Send("HSET", redis.Args{}.Add(key).AddFlat(family)...)
+	conn.Send("EXPIRE", key, int64(ttl.Seconds()))
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+func (r *userRepository) RotateRefreshFamily(familyID string, generation int, ttl time.Duration) error {
+	conn := r.redis.Get()
+	defer conn.Close()
+
+	result, err := redis.Int(rotateRefreshScript.Do(conn, refreshFamilyKey(familyID), generation, int64(ttl.Seconds())))
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case 0:
+		return ErrRefreshFamilyNotFound
+	case -1:
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (r *userRepository) DeleteRefreshFamily(familyID string) error {
+	conn := r.redis.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", refreshFamilyKey(familyID))
+	return err
+}
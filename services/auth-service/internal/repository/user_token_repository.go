@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type UserTokenRepository interface {
+	CreateToken(token *model.UserToken) error
+	// ConsumeToken marks an unused, unexpired token as used and returns it.
+	// sql.ErrNoRows is returned when no such token exists.
+	ConsumeToken(purpose, tokenHash string) (*model.UserToken, error)
+	InvalidateTokens(userID, purpose string) error
+}
+
+type userTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserTokenRepository(db *sqlx.DB) UserTokenRepository {
+	return &userTokenRepository{db: db}
+}
+
+func (r *userTokenRepository) CreateToken(token *model.UserToken) error {
+	query := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	return r.db.QueryRow(query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *userTokenRepository) ConsumeToken(purpose, tokenHash string) (*model.UserToken, error) {
+	query := `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING *`
+
+	var token model.UserToken
+	if err := r.db.Get(&token, query, tokenHash, purpose, time.Now()); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *userTokenRepository) InvalidateTokens(userID, purpose string) error {
+	_, err := r.db.Exec(
+		"UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	)
+	return err
+}
@@ -4,21 +4,153 @@ import (
 	"net/http"
 
 	"github.com/ecomz/backend/auth-service/internal/handler"
+	"github.com/ecomz/backend/libs/middleware"
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(userHandler *handler.UserHandler, roleHandler *handler.RoleHandler) *mux.Router {
+func NewRouter(
+	authenticator *middleware.Authenticator,
+	userHandler *handler.UserHandler,
+	roleHandler *handler.RoleHandler,
+	permissionHandler *handler.PermissionHandler,
+	keyHandler *handler.KeyHandler,
+	mfaHandler *handler.MFAHandler,
+	lockoutHandler *handler.LockoutHandler,
+	adminUserHandler *handler.AdminUserHandler,
+	oauthHandler *handler.OAuthHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	impersonationHandler *handler.ImpersonationHandler,
+	organizationHandler *handler.OrganizationHandler,
+	dataRequestHandler *handler.DataRequestHandler,
+	auditHandler *handler.AuditHandler,
+) *mux.Router {
 	r := mux.NewRouter()
 
+	r.HandleFunc("/.well-known/jwks.json", keyHandler.JWKS).Methods(http.MethodGet)
+
 	api := r.PathPrefix("/api").Subrouter()
 	auth := api.PathPrefix("/auth").Subrouter()
 
-	auth.HandleFunc("/role", roleHandler.GetAllRoles).Methods(http.MethodGet)
-	auth.HandleFunc("/role", roleHandler.CreateRole).Methods(http.MethodPost)
+	requirePermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return authenticator.RequirePermission(permission)(h)
+	}
+	authenticate := func(h http.HandlerFunc) http.Handler {
+		return authenticator.Authenticate(h)
+	}
+	authenticateUser := func(h http.HandlerFunc) http.Handler {
+		return authenticator.AuthenticateUser(h)
+	}
+	requireUserPermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return authenticator.AuthenticateUser(requirePermission(permission, h))
+	}
+	// audit records successful administrative actions in the audit log
+	audit := auditHandler.Audit
+
+	auth.Handle("/role", requirePermission("role:read", roleHandler.GetAllRoles)).Methods(http.MethodGet)
+	auth.Handle("/role", requirePermission("role:write", audit("role.created", roleHandler.CreateRole))).Methods(http.MethodPost)
+	auth.Handle("/role/{id}", requirePermission("role:read", roleHandler.GetRole)).Methods(http.MethodGet)
+	auth.Handle("/role/{id}", requirePermission("role:write", audit("role.updated", roleHandler.UpdateRole))).Methods(http.MethodPut)
+	auth.Handle("/role/{id}", requirePermission("role:write", audit("role.deleted", roleHandler.DeleteRole))).Methods(http.MethodDelete)
+	auth.Handle("/role/{id}/permissions", requirePermission("role:read", permissionHandler.GetRolePermissions)).Methods(http.MethodGet)
+	auth.Handle("/role/{id}/permissions", requirePermission("role:write", audit("role.permissions_changed", permissionHandler.SetRolePermissions))).Methods(http.MethodPut)
+
+	auth.Handle("/permission", requirePermission("permission:read", permissionHandler.GetAllPermissions)).Methods(http.MethodGet)
+	auth.Handle("/permission", requirePermission("permission:write", audit("permission.created", permissionHandler.CreatePermission))).Methods(http.MethodPost)
+
+	auth.Handle("/users", requirePermission("user:read", adminUserHandler.ListUsers)).Methods(http.MethodGet)
+	auth.Handle("/users/{id}", requirePermission("user:read", adminUserHandler.GetUser)).Methods(http.MethodGet)
+	auth.Handle("/users/{id}", requirePermission("user:write", audit("user.deleted", adminUserHandler.DeleteUser))).Methods(http.MethodDelete)
+	auth.Handle("/users/{id}/role", requirePermission("user:write", audit("user.role_changed", adminUserHandler.ChangeRole))).Methods(http.MethodPut)
+	auth.Handle("/users/{id}/restore", requirePermission("user:write", audit("user.restored", adminUserHandler.RestoreUser))).Methods(http.MethodPost)
+	auth.Handle("/users/{id}/password-reset", requirePermission("user:write", audit("user.password_reset_forced", adminUserHandler.ForcePasswordReset))).Methods(http.MethodPost)
+	auth.Handle("/users/{id}/sessions", requirePermission("user:read", adminUserHandler.GetSessions)).Methods(http.MethodGet)
+	auth.Handle("/users/{id}/sessions", requirePermission("user:write", audit("user.sessions_revoked", adminUserHandler.RevokeSessions))).Methods(http.MethodDelete)
+	auth.Handle("/users/{id}/sessions/{session_id}", requirePermission("user:write", audit("user.session_revoked", adminUserHandler.RevokeSession))).Methods(http.MethodDelete)
+	auth.Handle("/users/{id}/erasure", requirePermission("user:write", audit("user.erasure_requested", adminUserHandler.EraseUser))).Methods(http.MethodPost)
+	auth.Handle("/users/{id}/impersonate", requireUserPermission("user:impersonate", audit("user.impersonation_started", impersonationHandler.Start))).Methods(http.MethodPost)
+
+	auth.Handle("/audit-events", requirePermission("audit:read", auditHandler.GetEvents)).Methods(http.MethodGet)
+	auth.Handle("/audit-events/export", requirePermission("audit:read", auditHandler.ExportEvents)).Methods(http.MethodGet)
+	auth.Handle("/audit-events/verify", requirePermission("audit:read", auditHandler.Verify)).Methods(http.MethodGet)
+
+	auth.Handle("/data-requests", requirePermission("user:read", dataRequestHandler.GetDataRequests)).Methods(http.MethodGet)
+
+	auth.Handle("/impersonations", requirePermission("user:read", impersonationHandler.GetImpersonations)).Methods(http.MethodGet)
+	auth.Handle("/impersonations/{id}", requirePermission("user:impersonate", audit("impersonation.ended", impersonationHandler.End))).Methods(http.MethodDelete)
+	auth.Handle("/impersonation", authenticate(audit("impersonation.ended", impersonationHandler.EndCurrent))).Methods(http.MethodDelete)
+
+	auth.Handle("/organizations", requireUserPermission("organization:read", organizationHandler.GetOrganizations)).Methods(http.MethodGet)
+	auth.Handle("/organizations", authenticateUser(organizationHandler.CreateOrganization)).Methods(http.MethodPost)
+	auth.Handle("/organizations/roles", authenticateUser(organizationHandler.GetRoles)).Methods(http.MethodGet)
+	auth.Handle("/organizations/invitations/accept", authenticateUser(organizationHandler.AcceptInvitation)).Methods(http.MethodPost)
+	auth.Handle("/organizations/{id}", authenticateUser(organizationHandler.GetOrganization)).Methods(http.MethodGet)
+	auth.Handle("/organizations/{id}", authenticateUser(organizationHandler.UpdateOrganization)).Methods(http.MethodPut)
+	auth.Handle("/organizations/{id}", authenticateUser(organizationHandler.DeleteOrganization)).Methods(http.MethodDelete)
+	auth.Handle("/organizations/{id}/members", authenticateUser(organizationHandler.GetMembers)).Methods(http.MethodGet)
+	auth.Handle("/organizations/{id}/members/{user_id}", authenticateUser(organizationHandler.ChangeMemberRole)).Methods(http.MethodPut)
+	auth.Handle("/organizations/{id}/members/{user_id}", authenticateUser(organizationHandler.RemoveMember)).Methods(http.MethodDelete)
+	auth.Handle("/organizations/{id}/invitations", authenticateUser(organizationHandler.GetInvitations)).Methods(http.MethodGet)
+	auth.Handle("/organizations/{id}/invitations", authenticateUser(organizationHandler.Invite)).Methods(http.MethodPost)
+	auth.Handle("/organizations/{id}/invitations/{invitation_id:[0-9]+}", authenticateUser(organizationHandler.RevokeInvitation)).Methods(http.MethodDelete)
+
+	auth.Handle("/lockouts", requirePermission("user:read", lockoutHandler.GetLockouts)).Methods(http.MethodGet)
+	auth.Handle("/lockouts/{kind}/{subject}", requirePermission("user:write", audit("lockout.cleared", lockoutHandler.ClearLockout))).Methods(http.MethodDelete)
+
+	auth.Handle("/api-keys", requireUserPermission("api_key:read", apiKeyHandler.GetKeys)).Methods(http.MethodGet)
+	auth.Handle("/api-keys", requireUserPermission("api_key:write", audit("api_key.created", apiKeyHandler.CreateServiceKey))).Methods(http.MethodPost)
+	auth.Handle("/api-keys/{id}", requireUserPermission("api_key:write", audit("api_key.revoked", apiKeyHandler.RevokeKey))).Methods(http.MethodDelete)
+
+	auth.Handle("/mfa", authenticateUser(mfaHandler.Status)).Methods(http.MethodGet)
+	auth.Handle("/mfa/enroll", authenticateUser(mfaHandler.Enroll)).Methods(http.MethodPost)
+	auth.Handle("/mfa/activate", authenticateUser(mfaHandler.Activate)).Methods(http.MethodPost)
+	auth.Handle("/mfa/disable", authenticateUser(mfaHandler.Disable)).Methods(http.MethodPost)
+
+	auth.Handle("/oauth/clients", requirePermission("client:read", oauthHandler.GetClients)).Methods(http.MethodGet)
+	auth.Handle("/oauth/clients", requirePermission("client:write", audit("client.created", oauthHandler.CreateClient))).Methods(http.MethodPost)
+	auth.Handle("/oauth/clients/{id}", requirePermission("client:read", oauthHandler.GetClient)).Methods(http.MethodGet)
+	auth.Handle("/oauth/clients/{id}", requirePermission("client:write", audit("client.deleted", oauthHandler.DeleteClient))).Methods(http.MethodDelete)
+	auth.Handle("/oauth/clients/{id}/secret", requirePermission("client:write", audit("client.secret_rotated", oauthHandler.RotateClientSecret))).Methods(http.MethodPost)
+	auth.Handle("/oauth/authorize", authenticateUser(oauthHandler.GetAuthorization)).Methods(http.MethodGet)
+	auth.Handle("/oauth/authorize", authenticateUser(oauthHandler.Authorize)).Methods(http.MethodPost)
+	auth.Handle("/oauth/consents", authenticateUser(oauthHandler.GetConsents)).Methods(http.MethodGet)
+	auth.Handle("/oauth/consents/{client_id}", authenticateUser(oauthHandler.RevokeConsent)).Methods(http.MethodDelete)
+	auth.HandleFunc("/oauth/token", oauthHandler.Token).Methods(http.MethodPost)
+	auth.HandleFunc("/oauth/introspect", oauthHandler.Introspect).Methods(http.MethodPost)
 
 	auth.HandleFunc("/login", userHandler.Login).Methods(http.MethodPost)
+	auth.HandleFunc("/login/mfa", userHandler.VerifyMFALogin).Methods(http.MethodPost)
+	auth.HandleFunc("/login/magic-link", userHandler.RequestMagicLink).Methods(http.MethodPost)
+	auth.HandleFunc("/login/magic-link/verify", userHandler.MagicLinkLogin).Methods(http.MethodPost)
+	auth.HandleFunc("/oidc/providers", userHandler.GetOIDCProviders).Methods(http.MethodGet)
+	auth.HandleFunc("/oidc/{provider}/authorize", userHandler.OIDCAuthorize).Methods(http.MethodGet)
+	auth.HandleFunc("/oidc/callback", userHandler.OIDCCallback).Methods(http.MethodPost)
 	auth.HandleFunc("/register", userHandler.Register).Methods(http.MethodPost)
+	auth.HandleFunc("/refresh", userHandler.RefreshToken).Methods(http.MethodPost)
+	auth.HandleFunc("/logout", userHandler.Logout).Methods(http.MethodPost)
+	auth.HandleFunc("/logout-all", userHandler.LogoutAll).Methods(http.MethodPost)
 	auth.HandleFunc("/current-user", userHandler.CurrentUser).Methods(http.MethodGet)
+	auth.HandleFunc("/me", userHandler.UpdateProfile).Methods(http.MethodPatch)
+	auth.HandleFunc("/me", userHandler.DeleteAccount).Methods(http.MethodDelete)
+	auth.HandleFunc("/me/password", userHandler.ChangePassword).Methods(http.MethodPost)
+	auth.HandleFunc("/me/sessions", userHandler.GetSessions).Methods(http.MethodGet)
+	auth.HandleFunc("/me/sessions/{session_id}", userHandler.RevokeSession).Methods(http.MethodDelete)
+	auth.HandleFunc("/me/erasure", userHandler.RequestErasure).Methods(http.MethodPost)
+	auth.Handle("/me/data-export", authenticateUser(dataRequestHandler.RequestExport)).Methods(http.MethodPost)
+	auth.Handle("/me/data-requests", authenticateUser(dataRequestHandler.GetMyDataRequests)).Methods(http.MethodGet)
+	auth.Handle("/me/data-requests/{id}", authenticateUser(dataRequestHandler.GetMyDataRequest)).Methods(http.MethodGet)
+	auth.Handle("/me/data-requests/{id}/download", authenticateUser(dataRequestHandler.DownloadExport)).Methods(http.MethodGet)
+	auth.Handle("/me/organizations", authenticateUser(organizationHandler.GetMyOrganizations)).Methods(http.MethodGet)
+	auth.Handle("/me/api-keys", authenticateUser(apiKeyHandler.GetPersonalKeys)).Methods(http.MethodGet)
+	auth.Handle("/me/api-keys", authenticateUser(apiKeyHandler.CreatePersonalKey)).Methods(http.MethodPost)
+	auth.Handle("/me/api-keys/{id}", authenticateUser(audit("api_key.revoked", apiKeyHandler.RevokePersonalKey))).Methods(http.MethodDelete)
+	auth.HandleFunc("/me/identities", userHandler.GetIdentities).Methods(http.MethodGet)
+	auth.HandleFunc("/me/identities/callback", userHandler.LinkIdentityCallback).Methods(http.MethodPost)
+	auth.HandleFunc("/me/identities/{provider}", userHandler.LinkIdentityAuthorize).Methods(http.MethodPost)
+	auth.HandleFunc("/me/identities/{id:[0-9]+}", userHandler.UnlinkIdentity).Methods(http.MethodDelete)
+	auth.HandleFunc("/password-reset/request", userHandler.RequestPasswordReset).Methods(http.MethodPost)
+	auth.HandleFunc("/password-reset/confirm", userHandler.ResetPassword).Methods(http.MethodPost)
+	auth.HandleFunc("/verify-email", userHandler.VerifyEmail).Methods(http.MethodPost)
+	auth.HandleFunc("/verify-email/resend", userHandler.ResendVerificationEmail).Methods(http.MethodPost)
 
 	return r
 }
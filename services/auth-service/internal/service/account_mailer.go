@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+// AccountMailer mails users about their account and creates the single use
+// tokens of the mailed links.
+type AccountMailer interface {
+	// Send delivers msg in the background so that response times do not
+	// depend on the mail server, and do not reveal whether a mail was sent.
+	Send(msg mailer.Message)
+	// CreateToken stores the hash of a new single use token and returns the
+	// token itself, which is only ever sent to the user.
+	CreateToken(userID, purpose string, ttl time.Duration) (string, error)
+	// SendVerificationEmail replaces any pending verification link of the
+	// user with a new one.
+	SendVerificationEmail(user *model.User) error
+	// SendPasswordResetEmail replaces any pending reset link of the user
+	// with a new one, mailed between intro and outro.
+	SendPasswordResetEmail(user *model.User, intro, outro string) error
+}
+
+type accountMailer struct {
+	logger        *zap.Logger
+	cfg           *config.Config
+	userTokenRepo repository.UserTokenRepository
+	mailer        mailer.Mailer
+}
+
+func NewAccountMailer(logger *zap.Logger, cfg *config.Config, userTokenRepo repository.UserTokenRepository, mailer mailer.Mailer) AccountMailer {
+	return &accountMailer{
+		logger:        logger,
+		cfg:           cfg,
+		userTokenRepo: userTokenRepo,
+		mailer:        mailer,
+	}
+}
+
+func (m *accountMailer) Send(msg mailer.Message) {
+	go func() {
+		if err := m.mailer.Send(msg); err != nil {
+			m.logger.Error("error sending mail", zap.Error(err), zap.String("subject", msg.Subject))
+		}
+	}()
+}
+
+func (m *accountMailer) CreateToken(userID, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.userTokenRepo.CreateToken(&model.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (m *accountMailer) SendVerificationEmail(user *model.User) error {
+	if err := m.userTokenRepo.InvalidateTokens(user.ID, model.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := m.CreateToken(user.ID, model.TokenPurposeEmailVerification, m.cfg.Auth.EmailVerificationExp)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", m.cfg.Auth.EmailVerificationURL, url.QueryEscape(token))
+	m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, link, m.cfg.Auth.EmailVerificationExp,
+		),
+	})
+
+	return nil
+}
+
+func (m *accountMailer) SendPasswordResetEmail(user *model.User, intro, outro string) error {
+	// only the most recently mailed link stays valid
+	if err := m.userTokenRepo.InvalidateTokens(user.ID, model.TokenPurposePasswordReset); err != nil {
+		m.logger.Error("error invalidating password reset tokens", zap.Error(err))
+		return err
+	}
+
+	token, err := m.CreateToken(user.ID, model.TokenPurposePasswordReset, m.cfg.Auth.PasswordResetExp)
+	if err != nil {
+		m.logger.Error("error creating password reset token", zap.Error(err))
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", m.cfg.Auth.PasswordResetURL, url.QueryEscape(token))
+	m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\n%s\n\n%s\n\nThe link expires in %s. %s\n",
+			user.Name, intro, link, m.cfg.Auth.PasswordResetExp, outro,
+		),
+	})
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrScopeNotGranted keeps users from creating keys more powerful than
+	// their own login.
+	ErrScopeNotGranted = errors.New("api key scopes must be permissions you have")
+)
+
+// APIKeyService manages personal API keys, owned by the user creating them,
+// and service keys, which administrators create for integrations that do
+// not act as a user.
+type APIKeyService interface {
+	CreatePersonalKey(claims *utils.MyClaims, req dto.APIKeyRequest) (dto.APIKeySecretResponse, error)
+	GetPersonalKeys(userID string) ([]dto.APIKeyResponse, error)
+	RevokePersonalKey(userID, keyID string) error
+
+	CreateServiceKey(claims *utils.MyClaims, req dto.APIKeyRequest) (dto.APIKeySecretResponse, error)
+	GetServiceKeys() ([]dto.APIKeyResponse, error)
+	// GetUserKeys lists the personal keys of any user.
+	GetUserKeys(userID string) ([]dto.APIKeyResponse, error)
+	// RevokeKey revokes any key, personal or service.
+	RevokeKey(keyID string) error
+}
+
+type apiKeyService struct {
+	logger     *zap.Logger
+	apiKeyRepo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(logger *zap.Logger, apiKeyRepo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{
+		logger:     logger,
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+func (s *apiKeyService) CreatePersonalKey(claims *utils.MyClaims, req dto.APIKeyRequest) (dto.APIKeySecretResponse, error) {
+	s.logger.Info("Create Personal API Key",
+		zap.String("user_id", claims.ID),
+		zap.String("name", req.Name),
+	)
+
+	return s.createKey(claims, claims.ID, req)
+}
+
+func (s *apiKeyService) GetPersonalKeys(userID string) ([]dto.APIKeyResponse, error) {
+	keys, err := s.apiKeyRepo.GetAPIKeysByUserID(userID)
+	if err != nil {
+		s.logger.Error("error getting api keys", zap.Error(err))
+		return nil, err
+	}
+	return apiKeyResponses(keys), nil
+}
+
+func (s *apiKeyService) RevokePersonalKey(userID, keyID string) error {
+	s.logger.Info("Revoke Personal API Key",
+		zap.String("user_id", userID),
+		zap.String("key_id", keyID),
+	)
+
+	if err := s.apiKeyRepo.RevokeUserAPIKey(userID, keyID, time.Now()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAPIKeyNotFound
+		}
+		s.logger.Error("error revoking api key", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *apiKeyService) CreateServiceKey(claims *utils.MyClaims, req dto.APIKeyRequest) (dto.APIKeySecretResponse, error) {
+	s.logger.Info("Create Service API Key",
+		zap.String("actor_id", claims.ID),
+		zap.String("name", req.Name),
+	)
+
+	return s.createKey(claims, "", req)
+}
+
+func (s *apiKeyService) GetServiceKeys() ([]dto.APIKeyResponse, error) {
+	keys, err := s.apiKeyRepo.GetServiceAPIKeys()
+	if err != nil {
+		s.logger.Error("error getting api keys", zap.Error(err))
+		return nil, err
+	}
+	return apiKeyResponses(keys), nil
+}
+
+func (s *apiKeyService) GetUserKeys(userID string) ([]dto.APIKeyResponse, error) {
+	return s.GetPersonalKeys(userID)
+}
+
+func (s *apiKeyService) RevokeKey(keyID string) error {
+	s.logger.Info("Revoke API Key",
+		zap.String("key_id", keyID),
+	)
+
+	if err := s.apiKeyRepo.RevokeAPIKey(keyID, time.Now()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAPIKeyNotFound
+		}
+		s.logger.Error("error revoking api key", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// createKey stores a key for userID, or a service key when userID is empty.
+// The scopes are limited to the creator's permissions.
+func (s *apiKeyService) createKey(claims *utils.MyClaims, userID string, req dto.APIKeyRequest) (res dto.APIKeySecretResponse, err error) {
+	for _, scope := range req.Scopes {
+		if !claims.HasPermission(scope) {
+			return res, ErrScopeNotGranted
+		}
+	}
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		return res, err
+	}
+
+	scopes := slices.Clone(req.Scopes)
+	slices.Sort(scopes)
+
+	apiKey := &model.APIKey{
+		UserID:    sql.NullString{String: userID, Valid: userID != ""},
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(slices.Compact(scopes), " "),
+		CreatedBy: sql.NullString{String: claims.ID, Valid: true},
+	}
+	if req.ExpiresInDays > 0 {
+		apiKey.ExpiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	if err := s.apiKeyRepo.CreateAPIKey(apiKey); err != nil {
+		s.logger.Error("error creating api key", zap.Error(err))
+		return res, err
+	}
+
+	return dto.APIKeySecretResponse{
+		APIKeyResponse: dto.NewAPIKeyResponse(apiKey),
+		Key:            key,
+	}, nil
+}
+
+func apiKeyResponses(keys []*model.APIKey) []dto.APIKeyResponse {
+	res := make([]dto.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, dto.NewAPIKeyResponse(key))
+	}
+	return res
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"go.uber.org/zap"
+)
+
+const dataRequestListLimit = 50
+
+var (
+	ErrDataRequestNotFound = errors.New("data request not found")
+	// ErrArchiveNotAvailable is returned until the export is completed and
+	// after it expired.
+	ErrArchiveNotAvailable = errors.New("the export is not available for download")
+)
+
+// DataRequestService exports and erases the personal data of users.
+// Requests are queued and handled by Run, users poll their status.
+type DataRequestService interface {
+	// RequestExport returns the export already in progress if there is one.
+	RequestExport(userID string) (dto.DataRequestResponse, error)
+	// RequestErasure closes the account of the user right away and queues
+	// the anonymization of their personal data, which cannot be undone.
+	RequestErasure(user *model.User, requestedBy string) (dto.DataRequestResponse, error)
+	GetUserDataRequests(userID string) ([]dto.DataRequestResponse, error)
+	GetUserDataRequest(userID, id string) (dto.DataRequestResponse, error)
+	// GetArchive returns the JSON archive of a completed export of the user.
+	GetArchive(userID, id string) ([]byte, error)
+	GetDataRequests(query dto.DataRequestListQuery) ([]dto.DataRequestResponse, error)
+	// Run processes queued requests until ctx is done. Several instances
+	// may run it concurrently.
+	Run(ctx context.Context)
+}
+
+type dataRequestService struct {
+	logger          *zap.Logger
+	cfg             *config.Config
+	dataRequestRepo repository.DataRequestRepository
+	userRepo        repository.UserRepository
+	roleRepo        repository.RoleRepository
+	sessions        SessionService
+	mail            AccountMailer
+}
+
+func NewDataRequestService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	dataRequestRepo repository.DataRequestRepository,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	sessions SessionService,
+	mail AccountMailer,
+) DataRequestService {
+	return &dataRequestService{
+		logger:          logger,
+		cfg:             cfg,
+		dataRequestRepo: dataRequestRepo,
+		userRepo:        userRepo,
+		roleRepo:        roleRepo,
+		sessions:        sessions,
+		mail:            mail,
+	}
+}
+
+func (s *dataRequestService) RequestExport(userID string) (res dto.DataRequestResponse, err error) {
+	s.logger.Info("Request Data Export",
+		zap.String("user_id", userID),
+	)
+
+	request, err := queueDataRequest(s.dataRequestRepo, userID, userID, model.DataRequestExport)
+	if err != nil {
+		s.logger.Error("error creating data request", zap.Error(err))
+		return res, err
+	}
+	return dto.NewDataRequestResponse(request), nil
+}
+
+// RequestErasure soft-deletes the user, ends their sessions and queues the
+// erasure. The user is told while the address is still known.
+func (s *dataRequestService) RequestErasure(user *model.User, requestedBy string) (res dto.DataRequestResponse, err error) {
+	s.logger.Info("Request Erasure",
+		zap.String("user_id", user.ID),
+		zap.String("requested_by", requestedBy),
+	)
+
+	if err := s.userRepo.SoftDeleteUser(user.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error deleting user", zap.Error(err))
+		return res, err
+	}
+
+	if err := s.sessions.RevokeAllSessions(user.ID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return res, err
+	}
+
+	request, err := queueDataRequest(s.dataRequestRepo, user.ID, requestedBy, model.DataRequestErasure)
+	if err != nil {
+		s.logger.Error("error creating data request", zap.Error(err))
+		return res, err
+	}
+
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account is being erased",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account has been closed and your personal data will be erased shortly. This cannot be undone.\n",
+			user.Name,
+		),
+	})
+
+	return dto.NewDataRequestResponse(request), nil
+}
+
+func (s *dataRequestService) GetUserDataRequests(userID string) ([]dto.DataRequestResponse, error) {
+	return s.GetDataRequests(dto.DataRequestListQuery{UserID: userID, Limit: dataRequestListLimit})
+}
+
+func (s *dataRequestService) GetUserDataRequest(userID, id string) (res dto.DataRequestResponse, err error) {
+	request, err := s.userDataRequest(userID, id)
+	if err != nil {
+		return res, err
+	}
+	return dto.NewDataRequestResponse(request), nil
+}
+
+func (s *dataRequestService) GetArchive(userID, id string) ([]byte, error) {
+	request, err := s.userDataRequest(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Kind != model.DataRequestExport {
+		return nil, ErrArchiveNotAvailable
+	}
+
+	archive, err := s.dataRequestRepo.GetArchive(request.ID, time.Now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrArchiveNotAvailable
+		}
+		s.logger.Error("error getting archive", zap.Error(err))
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (s *dataRequestService) GetDataRequests(query dto.DataRequestListQuery) ([]dto.DataRequestResponse, error) {
+	requests, err := s.dataRequestRepo.GetDataRequests(query.UserID, query.Limit)
+	if err != nil {
+		s.logger.Error("error getting data requests", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.DataRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		res = append(res, dto.NewDataRequestResponse(request))
+	}
+	return res, nil
+}
+
+func (s *dataRequestService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Auth.DataRequestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.dataRequestRepo.DeleteExpiredArchives(time.Now()); err != nil {
+				s.logger.Error("error deleting expired archives", zap.Error(err))
+			}
+			s.processQueue(ctx)
+		}
+	}
+}
+
+// processQueue handles requests until none is left.
+func (s *dataRequestService) processQueue(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := time.Now()
+		request, err := s.dataRequestRepo.ClaimDataRequest(now, now.Add(-s.cfg.Auth.DataRequestTimeout))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				s.logger.Error("error claiming data request", zap.Error(err))
+			}
+			return
+		}
+
+		s.logger.Info("Process Data Request",
+			zap.String("id", request.ID),
+			zap.String("kind", request.Kind),
+			zap.String("user_id", request.UserID.String),
+		)
+
+		if err := s.process(request); err != nil {
+			s.logger.Error("error processing data request", zap.Error(err), zap.String("id", request.ID))
+			if err := s.dataRequestRepo.FailDataRequest(request.ID, "the request could not be processed", time.Now()); err != nil {
+				s.logger.Error("error failing data request", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *dataRequestService) process(request *model.DataRequest) error {
+	if !request.UserID.Valid {
+		return errors.New("the user no longer exists")
+	}
+
+	switch request.Kind {
+	case model.DataRequestExport:
+		return s.export(request)
+	case model.DataRequestErasure:
+		return s.erase(request)
+	default:
+		return fmt.Errorf("unknown data request kind %q", request.Kind)
+	}
+}
+
+func (s *dataRequestService) export(request *model.DataRequest) error {
+	data, err := s.dataRequestRepo.GetPersonalData(request.UserID.String)
+	if err != nil {
+		return fmt.Errorf("failed to read personal data: %w", err)
+	}
+
+	role, err := s.roleRepo.GetRoleByID(data.User.RoleID)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	now := time.Now()
+	archive, err := json.MarshalIndent(dto.NewPersonalDataExport(data, role, now), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive: %w", err)
+	}
+
+	expiresAt := now.Add(s.cfg.Auth.DataExportExp)
+	err = s.dataRequestRepo.CompleteDataRequest(request.ID, archive, now, sql.NullTime{Time: expiresAt, Valid: true})
+	if err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	s.mail.Send(mailer.Message{
+		To:      data.User.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe export of your personal data is ready. Log in to download it before %s.\n",
+			data.User.Name, expiresAt.Format(time.RFC1123),
+		),
+	})
+
+	return nil
+}
+
+func (s *dataRequestService) erase(request *model.DataRequest) error {
+	now := time.Now()
+	if err := s.dataRequestRepo.ErasePersonalData(request.UserID.String, now); err != nil {
+		return fmt.Errorf("failed to erase personal data: %w", err)
+	}
+	return s.dataRequestRepo.CompleteDataRequest(request.ID, nil, now, sql.NullTime{})
+}
+
+// userDataRequest hides the requests of other users.
+func (s *dataRequestService) userDataRequest(userID, id string) (*model.DataRequest, error) {
+	request, err := s.dataRequestRepo.GetDataRequest(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDataRequestNotFound
+		}
+		s.logger.Error("error getting data request", zap.Error(err))
+		return nil, err
+	}
+	if request.UserID.String != userID {
+		return nil, ErrDataRequestNotFound
+	}
+	return request, nil
+}
+
+// queueDataRequest creates a request unless one of the kind is already
+// pending or running for the user.
+func queueDataRequest(dataRequestRepo repository.DataRequestRepository, userID, requestedBy, kind string) (*model.DataRequest, error) {
+	request, err := dataRequestRepo.GetOpenDataRequest(userID, kind)
+	if err == nil {
+		return request, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	request = &model.DataRequest{
+		UserID:      sql.NullString{String: userID, Valid: true},
+		Kind:        kind,
+		RequestedBy: sql.NullString{String: requestedBy, Valid: requestedBy != ""},
+	}
+	if err := dataRequestRepo.CreateDataRequest(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
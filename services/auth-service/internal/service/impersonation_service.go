@@ -0,0 +1,200 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+const impersonatePermission = "user:impersonate"
+
+var (
+	ErrImpersonationNotFound = errors.New("impersonation not found or already ended")
+	ErrCannotImpersonateSelf = errors.New("administrators cannot impersonate themselves")
+	// ErrImpersonationNotAllowed keeps administrators from acting as each
+	// other.
+	ErrImpersonationNotAllowed = errors.New("users who may impersonate cannot be impersonated")
+	ErrNotImpersonating        = errors.New("the session is not an impersonation")
+)
+
+// ImpersonationService lets support staff act as a customer with a short
+// lived access token that carries the administrator in its act claim and
+// only the permissions in config.AuthConfig.ImpersonationPermissions. Every
+// impersonation is recorded.
+type ImpersonationService interface {
+	Start(actor *utils.MyClaims, userID string, req dto.ImpersonationRequest, client dto.ClientInfo) (dto.ImpersonationTokenResponse, error)
+	GetImpersonations(query dto.ImpersonationListQuery) ([]dto.ImpersonationResponse, error)
+	// End stops any running impersonation, EndCurrent the one claims were
+	// issued for.
+	End(id string) error
+	EndCurrent(claims *utils.MyClaims) error
+}
+
+type impersonationService struct {
+	logger            *zap.Logger
+	cfg               *config.Config
+	impersonationRepo repository.ImpersonationRepository
+	userRepo          repository.UserRepository
+	roleRepo          repository.RoleRepository
+	permissionRepo    repository.PermissionRepository
+	mfaService        MFAService
+	keyService        KeyService
+	denylist          utils.TokenDenylist
+}
+
+func NewImpersonationService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	impersonationRepo repository.ImpersonationRepository,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	mfaService MFAService,
+	keyService KeyService,
+	denylist utils.TokenDenylist,
+) ImpersonationService {
+	return &impersonationService{
+		logger:            logger,
+		cfg:               cfg,
+		impersonationRepo: impersonationRepo,
+		userRepo:          userRepo,
+		roleRepo:          roleRepo,
+		permissionRepo:    permissionRepo,
+		mfaService:        mfaService,
+		keyService:        keyService,
+		denylist:          denylist,
+	}
+}
+
+func (s *impersonationService) Start(actor *utils.MyClaims, userID string, req dto.ImpersonationRequest, client dto.ClientInfo) (res dto.ImpersonationTokenResponse, err error) {
+	s.logger.Info("Start Impersonation",
+		zap.String("actor_id", actor.ID),
+		zap.String("user_id", userID),
+		zap.String("reason", req.Reason),
+	)
+
+	if actor.ID == userID {
+		return res, ErrCannotImpersonateSelf
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, ErrUserNotFound
+		}
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return res, err
+	}
+
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+
+	granted, err := grantedPermissions(s.cfg, s.permissionRepo, s.mfaService, user, role)
+	if err != nil {
+		s.logger.Error("error getting granted permissions", zap.Error(err))
+		return res, err
+	}
+	if slices.Contains(granted, impersonatePermission) {
+		return res, ErrImpersonationNotAllowed
+	}
+
+	// never more than the administrator could do themselves
+	permissions := slices.DeleteFunc(granted, func(permission string) bool {
+		return !slices.Contains(s.cfg.Auth.ImpersonationPermissions, permission) || !actor.HasPermission(permission)
+	})
+
+	impersonation := &model.Impersonation{
+		ActorID:     sql.NullString{String: actor.ID, Valid: true},
+		UserID:      sql.NullString{String: user.ID, Valid: true},
+		Reason:      req.Reason,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		Permissions: strings.Join(permissions, " "),
+		ExpiresAt:   time.Now().Add(s.cfg.Auth.ImpersonationExp),
+	}
+	if err := s.impersonationRepo.CreateImpersonation(impersonation); err != nil {
+		s.logger.Error("error creating impersonation", zap.Error(err))
+		return res, err
+	}
+
+	claims := utils.NewClaims(
+		user.ID,
+		user.Name,
+		user.Email,
+		s.cfg.App.Name,
+		utils.AccessToken,
+		impersonation.ExpiresAt,
+	)
+	claims.FamilyID = impersonation.ID
+	claims.Role = role.Name
+	claims.EmailVerified = user.EmailVerifiedAt.Valid
+	claims.Permissions = permissions
+	claims.Act = &utils.ActorClaim{ID: actor.ID}
+
+	accessToken, err := s.keyService.Sign(claims)
+	if err != nil {
+		s.logger.Error("error generating impersonation token", zap.Error(err))
+		return res, err
+	}
+
+	return dto.ImpersonationTokenResponse{
+		ImpersonationID: impersonation.ID,
+		AccessToken:     accessToken,
+		ExpiresIn:       int64(s.cfg.Auth.ImpersonationExp.Seconds()),
+		User:            dto.NewUserResponse(user, role),
+	}, nil
+}
+
+func (s *impersonationService) GetImpersonations(query dto.ImpersonationListQuery) ([]dto.ImpersonationResponse, error) {
+	impersonations, err := s.impersonationRepo.GetImpersonations(query.ActorID, query.UserID, query.Limit)
+	if err != nil {
+		s.logger.Error("error getting impersonations", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.ImpersonationResponse, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		res = append(res, dto.NewImpersonationResponse(impersonation))
+	}
+	return res, nil
+}
+
+func (s *impersonationService) End(id string) error {
+	s.logger.Info("End Impersonation",
+		zap.String("impersonation_id", id),
+	)
+
+	if err := s.impersonationRepo.EndImpersonation(id, time.Now()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrImpersonationNotFound
+		}
+		s.logger.Error("error ending impersonation", zap.Error(err))
+		return err
+	}
+
+	if err := s.denylist.RevokeFamily(id, s.cfg.Auth.ImpersonationExp); err != nil {
+		s.logger.Error("error revoking impersonation token", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *impersonationService) EndCurrent(claims *utils.MyClaims) error {
+	if !claims.IsImpersonated() {
+		return ErrNotImpersonating
+	}
+	return s.End(claims.FamilyID)
+}
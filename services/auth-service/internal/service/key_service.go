@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/jwks"
+	"github.com/ecomz/backend/libs/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// minKeyReloadInterval limits how often an unknown kid may force a reload of
+// the signing keys from the database.
+const minKeyReloadInterval = 30 * time.Second
+
+// KeyService signs and verifies the tokens issued by auth-service and
+// publishes the public keys as a JWKS document.
+type KeyService interface {
+	utils.TokenSigner
+	utils.TokenVerifier
+	JWKS() jwks.JWKS
+	// Run rotates the signing keys on schedule until ctx is cancelled.
+	Run(ctx context.Context)
+}
+
+// NewKeyService returns a KeyService for the configured signing algorithm.
+// HS256 keeps using the shared secret and publishes no keys.
+func NewKeyService(logger *zap.Logger, cfg *config.Config, keyRepo repository.SigningKeyRepository) (KeyService, error) {
+	switch cfg.JWT.SigningAlg {
+	case jwt.SigningMethodHS256.Alg():
+		if cfg.JWT.SecretKey == "" {
+			return nil, errors.New("JWT_SECRET_KEY is required for HS256")
+		}
+		return &hmacKeyService{
+			TokenSigner:   utils.NewHMACSigner(cfg.JWT.SecretKey),
+			TokenVerifier: utils.NewHMACVerifier(cfg.JWT.SecretKey),
+		}, nil
+	case jwks.AlgRS256, jwks.AlgEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", cfg.JWT.SigningAlg)
+	}
+
+	s := &keyService{
+		logger:  logger,
+		cfg:     cfg,
+		keyRepo: keyRepo,
+		// new keys are published this long before they start signing, so
+		// verifiers caching the JWKS know them before they see a token
+		lead: 2 * cfg.JWT.JWKSCacheTTL,
+	}
+	if cfg.JWT.KeyRotation <= s.lead {
+		return nil, fmt.Errorf("JWT_KEY_ROTATION must be longer than %s", s.lead)
+	}
+	if cfg.JWT.KeyEncryptionKey == "" {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY is required for %s", cfg.JWT.SigningAlg)
+	}
+
+	if err := s.rotate(); err != nil {
+		return nil, fmt.Errorf("failed to rotate signing keys: %w", err)
+	}
+	if err := s.encryptPlaintextKeys(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing keys: %w", err)
+	}
+	if err := s.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	return s, nil
+}
+
+type hmacKeyService struct {
+	utils.TokenSigner
+	utils.TokenVerifier
+}
+
+func (s *hmacKeyService) JWKS() jwks.JWKS {
+	return jwks.JWKS{Keys: []jwks.JWK{}}
+}
+
+func (s *hmacKeyService) Run(ctx context.Context) {}
+
+type signingKey struct {
+	id          string
+	alg         string
+	private     crypto.Signer
+	activatesAt time.Time
+}
+
+type keyService struct {
+	logger  *zap.Logger
+	cfg     *config.Config
+	keyRepo repository.SigningKeyRepository
+	lead    time.Duration
+
+	mu       sync.RWMutex
+	keys     []*signingKey
+	loadedAt time.Time
+}
+
+func (s *keyService) Sign(claims utils.MyClaims) (string, error) {
+	key := s.currentKey()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.alg), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+func (s *keyService) Verify(token string) (*utils.MyClaims, error) {
+	return utils.ParseTokenWithKeyFunc(token, s.keyfunc, jwks.AlgRS256, jwks.AlgEdDSA)
+}
+
+func (s *keyService) JWKS() jwks.JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := jwks.JWKS{Keys: make([]jwks.JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		jwk, err := jwks.NewJWK(key.id, key.alg, key.private.Public())
+		if err != nil {
+			s.logger.Error("error encoding signing key", zap.Error(err), zap.String("kid", key.id))
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (s *keyService) Run(ctx context.Context) {
+	interval := max(s.cfg.JWT.JWKSCacheTTL/2, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.rotate(); err != nil {
+				s.logger.Error("error rotating signing keys", zap.Error(err))
+			}
+			if err := s.reload(); err != nil {
+				s.logger.Error("error loading signing keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// currentKey returns the most recently activated key.
+func (s *keyService) currentKey() *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var current *signingKey
+	for _, key := range s.keys {
+		if key.activatesAt.After(now) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+	return current
+}
+
+func (s *keyService) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	if key := s.findKey(kid); key != nil {
+		return key.private.Public(), nil
+	}
+
+	// the key may have been created by another instance since the last reload
+	s.mu.RLock()
+	loadedAt := s.loadedAt
+	s.mu.RUnlock()
+	if time.Since(loadedAt) >= minKeyReloadInterval {
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+		if key := s.findKey(kid); key != nil {
+			return key.private.Public(), nil
+		}
+	}
+
+	return nil, jwks.ErrUnknownKey
+}
+
+func (s *keyService) findKey(kid string) *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (s *keyService) reload() error {
+	records, err := s.keyRepo.GetValidKeys(time.Now())
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(records))
+	for _, record := range records {
+		private, err := s.decodePrivateKey(record.PrivateKey)
+		if err != nil {
+			s.logger.Error("error decoding signing key", zap.Error(err), zap.String("kid", record.ID))
+			continue
+		}
+		keys = append(keys, &signingKey{
+			id:          record.ID,
+			alg:         record.Algorithm,
+			private:     private,
+			activatesAt: record.ActivatesAt,
+		})
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// rotate makes sure the next signing key is published before the current one
+// retires. Keys that no longer verify any live token are removed.
+func (s *keyService) rotate() error {
+	now := time.Now()
+
+	return s.keyRepo.RotateKeys(now, func(keys []*model.SigningKey) ([]*model.SigningKey, error) {
+		activatesAt := now
+		if len(keys) > 0 {
+			latest := keys[len(keys)-1]
+			if latest.RetiresAt.Sub(now) > s.lead {
+				return nil, nil
+			}
+			if latest.RetiresAt.After(now) {
+				activatesAt = latest.RetiresAt
+			}
+		}
+
+		key, err := s.generateKey(activatesAt)
+		if err != nil {
+			return nil, err
+		}
+
+		s.logger.Info("Created signing key",
+			zap.String("kid", key.ID),
+			zap.String("algorithm", key.Algorithm),
+			zap.Time("activates_at", key.ActivatesAt),
+		)
+		return []*model.SigningKey{key}, nil
+	})
+}
+
+func (s *keyService) generateKey(activatesAt time.Time) (*model.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch s.cfg.JWT.SigningAlg {
+	case jwks.AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwks.AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.Encrypt(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), s.cfg.JWT.KeyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := utils.RandomString(8)
+	if err != nil {
+		return nil, err
+	}
+
+	retiresAt := activatesAt.Add(s.cfg.JWT.KeyRotation)
+	return &model.SigningKey{
+		ID:          kid,
+		Algorithm:   s.cfg.JWT.SigningAlg,
+		PrivateKey:  encrypted,
+		ActivatesAt: activatesAt,
+		RetiresAt:   retiresAt,
+		// refresh tokens are the longest lived tokens signed with the key
+		ExpiresAt: retiresAt.Add(s.cfg.JWT.RefreshExp),
+	}, nil
+}
+
+// encryptPlaintextKeys encrypts the keys stored before private keys were
+// encrypted at rest.
+func (s *keyService) encryptPlaintextKeys() error {
+	records, err := s.keyRepo.GetValidKeys(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if !isPlaintextKey(record.PrivateKey) {
+			continue
+		}
+
+		encrypted, err := utils.Encrypt(record.PrivateKey, s.cfg.JWT.KeyEncryptionKey)
+		if err != nil {
+			return err
+		}
+		if err := s.keyRepo.ReplacePrivateKey(record.ID, record.PrivateKey, encrypted); err != nil {
+			return err
+		}
+		s.logger.Info("Encrypted signing key", zap.String("kid", record.ID))
+	}
+	return nil
+}
+
+// decodePrivateKey decrypts a stored key. Plaintext keys are still read in
+// case another instance has not encrypted them yet.
+func (s *keyService) decodePrivateKey(stored string) (crypto.Signer, error) {
+	encoded := stored
+	if !isPlaintextKey(stored) {
+		decrypted, err := utils.Decrypt(stored, s.cfg.JWT.KeyEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt key: %w", err)
+		}
+		encoded = decrypted
+	}
+
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("invalid PEM block")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+func isPlaintextKey(stored string) bool {
+	return strings.HasPrefix(stored, "-----BEGIN ")
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	LockoutKindAccount = "account"
+	LockoutKindIP      = "ip"
+)
+
+var ErrInvalidLockoutKind = errors.New("lockout kind must be account or ip")
+
+// LoginLockedError is returned while an account or client IP is locked out
+// after too many failed logins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// LoginThrottle counts failed logins per account and per client IP. Accounts
+// are delayed progressively and both are locked out once they reach their
+// limit.
+//
+// Every guess is counted by Attempt before it is checked, so parallel
+// guesses cannot all get in before the first failure is recorded. Guesses
+// that turn out right are given back with Release.
+type LoginThrottle interface {
+	// Check returns a *LoginLockedError when the account or IP is locked.
+	Check(email, ip string) error
+	// Attempt is Check for a password or code about to be verified. It
+	// counts the attempt and returns a *LoginLockedError once the account or
+	// IP has used up its attempts.
+	Attempt(email, ip string) error
+	// Release uncounts an attempt whose guess was right.
+	Release(email, ip string) error
+	// RecordFailure locks the account or IP according to the counted
+	// attempts after a wrong guess.
+	RecordFailure(email, ip string) error
+	RecordSuccess(email string) error
+	GetLockouts() ([]dto.LockoutResponse, error)
+	ClearLockout(kind, subject string) error
+}
+
+type loginThrottle struct {
+	logger *zap.Logger
+	cfg    *config.Config
+	cache  utils.CacheService
+}
+
+func NewLoginThrottle(logger *zap.Logger, cfg *config.Config, cache utils.CacheService) LoginThrottle {
+	return &loginThrottle{
+		logger: logger,
+		cfg:    cfg,
+		cache:  cache,
+	}
+}
+
+func (t *loginThrottle) Check(email, ip string) error {
+	var retryAfter int64
+	for _, key := range []string{lockKey(LockoutKindAccount, email), lockKey(LockoutKindIP, ip)} {
+		ttl, err := t.cache.TTL(key)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, ttl)
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+	return nil
+}
+
+func (t *loginThrottle) Attempt(email, ip string) error {
+	if err := t.Check(email, ip); err != nil {
+		return err
+	}
+
+	// the counter is incremented and compared in one step, attempts in
+	// flight at the same time each get their own count. A rejected attempt
+	// gives back the counts it already took.
+	window := int64(t.cfg.Auth.LoginFailureWindow.Seconds())
+	var counted []string
+	for _, limit := range []struct {
+		kind, subject string
+		max           int
+	}{
+		{LockoutKindAccount, email, t.cfg.Auth.LoginMaxFailures},
+		{LockoutKindIP, ip, t.cfg.Auth.LoginIPMaxFailures},
+	} {
+		if limit.subject == "" {
+			continue
+		}
+
+		key := failureKey(limit.kind, limit.subject)
+		attempts, err := t.cache.Incr(key, window)
+		if err != nil {
+			return err
+		}
+		if attempts > int64(limit.max) {
+			for _, key := range counted {
+				if _, err := t.cache.Decr(key); err != nil {
+					return err
+				}
+			}
+			if err := t.lock(limit.kind, limit.subject, t.cfg.Auth.LoginLockoutDuration); err != nil {
+				return err
+			}
+			return &LoginLockedError{RetryAfter: t.cfg.Auth.LoginLockoutDuration}
+		}
+		counted = append(counted, key)
+	}
+	return nil
+}
+
+func (t *loginThrottle) Release(email, ip string) error {
+	if _, err := t.cache.Decr(failureKey(LockoutKindAccount, email)); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	_, err := t.cache.Decr(failureKey(LockoutKindIP, ip))
+	return err
+}
+
+func (t *loginThrottle) RecordFailure(email, ip string) error {
+	failures, err := t.failures(LockoutKindAccount, email)
+	if err != nil {
+		return err
+	}
+	if err := t.lock(LockoutKindAccount, email, t.accountLockDuration(failures)); err != nil {
+		return err
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	failures, err = t.failures(LockoutKindIP, ip)
+	if err != nil {
+		return err
+	}
+	if failures >= int64(t.cfg.Auth.LoginIPMaxFailures) {
+		return t.lock(LockoutKindIP, ip, t.cfg.Auth.LoginLockoutDuration)
+	}
+	return nil
+}
+
+func (t *loginThrottle) RecordSuccess(email string) error {
+	return t.cache.Delete(failureKey(LockoutKindAccount, email))
+}
+
+func (t *loginThrottle) GetLockouts() ([]dto.LockoutResponse, error) {
+	keys, err := t.cache.Keys("login_lock:*")
+	if err != nil {
+		return nil, err
+	}
+
+	lockouts := make([]dto.LockoutResponse, 0, len(keys))
+	for _, key := range keys {
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		kind, subject := parts[1], parts[2]
+
+		ttl, err := t.cache.TTL(key)
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			continue
+		}
+
+		failures, err := t.failures(kind, subject)
+		if err != nil {
+			return nil, err
+		}
+
+		lockouts = append(lockouts, dto.LockoutResponse{
+			Kind:       kind,
+			Subject:    subject,
+			Failures:   failures,
+			RetryAfter: ttl,
+		})
+	}
+
+	return lockouts, nil
+}
+
+func (t *loginThrottle) ClearLockout(kind, subject string) error {
+	if kind != LockoutKindAccount && kind != LockoutKindIP {
+		return ErrInvalidLockoutKind
+	}
+
+	t.logger.Info("Clear Login Lockout",
+		zap.String("kind", kind),
+		zap.String("subject", subject),
+	)
+
+	if err := t.cache.Delete(lockKey(kind, subject)); err != nil {
+		return err
+	}
+	return t.cache.Delete(failureKey(kind, subject))
+}
+
+// accountLockDuration doubles the delay for every failure past
+// LoginDelayAfter until the account reaches LoginMaxFailures.
+func (t *loginThrottle) accountLockDuration(failures int64) time.Duration {
+	auth := t.cfg.Auth
+	if failures >= int64(auth.LoginMaxFailures) {
+		return auth.LoginLockoutDuration
+	}
+	if failures < int64(auth.LoginDelayAfter) {
+		return 0
+	}
+
+	exp := failures - int64(auth.LoginDelayAfter)
+	delay := time.Duration(float64(auth.LoginDelayBase) * math.Pow(2, float64(exp)))
+	return min(delay, auth.LoginLockoutDuration)
+}
+
+func (t *loginThrottle) lock(kind, subject string, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	if d >= t.cfg.Auth.LoginLockoutDuration {
+		t.logger.Warn("login locked out",
+			zap.String("kind", kind),
+			zap.String("subject", subject),
+			zap.Duration("duration", d),
+		)
+	}
+
+	seconds := int64(math.Ceil(d.Seconds()))
+	return t.cache.Set(lockKey(kind, subject), []byte("1"), seconds)
+}
+
+func (t *loginThrottle) failures(kind, subject string) (int64, error) {
+	value, err := t.cache.Get(failureKey(kind, subject))
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+func failureKey(kind, subject string) string {
+	return fmt.Sprintf("login_failures:%s:%s", kind, normalizeSubject(kind, subject))
+}
+
+func lockKey(kind, subject string) string {
+	return fmt.Sprintf("login_lock:%s:%s", kind, normalizeSubject(kind, subject))
+}
+
+func normalizeSubject(kind, subject string) string {
+	if kind == LockoutKindAccount {
+		return strings.ToLower(strings.TrimSpace(subject))
+	}
+	return subject
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMagicLinkDisabled = errors.New("magic link login is disabled")
+	// ErrMagicLinkThrottled is returned for known and unknown addresses alike.
+	ErrMagicLinkThrottled = errors.New("too many login links requested, try again later")
+	ErrInvalidMagicLink   = errors.New("invalid or expired login link")
+)
+
+// MagicLinkService logs users in with single use links mailed to them,
+// MagicLinkLogin behaves like UserService.Login.
+type MagicLinkService interface {
+	// RequestMagicLink mails a login link when the email belongs to a user.
+	// Like RequestPasswordReset it reports nothing about whether the email
+	// exists.
+	RequestMagicLink(email string) error
+	// MagicLinkLogin exchanges a token from RequestMagicLink for a session.
+	// The link replaces the password only, users with MFA still get a
+	// challenge.
+	MagicLinkLogin(token string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error)
+}
+
+type magicLinkService struct {
+	logger        *zap.Logger
+	cfg           *config.Config
+	userRepo      repository.UserRepository
+	userTokenRepo repository.UserTokenRepository
+	cache         utils.CacheService
+	loginThrottle LoginThrottle
+	mfaService    MFAService
+	sessions      SessionService
+	mail          AccountMailer
+	audit         AuditService
+}
+
+func NewMagicLinkService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	userRepo repository.UserRepository,
+	userTokenRepo repository.UserTokenRepository,
+	cache utils.CacheService,
+	loginThrottle LoginThrottle,
+	mfaService MFAService,
+	sessions SessionService,
+	mail AccountMailer,
+	audit AuditService,
+) MagicLinkService {
+	return &magicLinkService{
+		logger:        logger,
+		cfg:           cfg,
+		userRepo:      userRepo,
+		userTokenRepo: userTokenRepo,
+		cache:         cache,
+		loginThrottle: loginThrottle,
+		mfaService:    mfaService,
+		sessions:      sessions,
+		mail:          mail,
+		audit:         audit,
+	}
+}
+
+func (s *magicLinkService) RequestMagicLink(email string) error {
+	if !s.cfg.Auth.MagicLinkEnabled {
+		return ErrMagicLinkDisabled
+	}
+
+	s.logger.Info("Request Magic Link",
+		zap.String("email", email),
+	)
+
+	// counted before the lookup so unknown addresses are throttled the same
+	requests, err := s.cache.Incr(
+		"magic_link_requests:"+strings.ToLower(email),
+		int64(s.cfg.Auth.MagicLinkWindow.Seconds()),
+	)
+	if err != nil {
+		s.logger.Error("error throttling magic link", zap.Error(err))
+		return err
+	}
+	if requests > int64(s.cfg.Auth.MagicLinkMaxRequests) {
+		s.logger.Warn("magic link throttled", zap.String("email", email))
+		return ErrMagicLinkThrottled
+	}
+
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("magic link requested for unknown email", zap.String("email", email))
+			return nil
+		}
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return err
+	}
+
+	// only the most recently mailed link stays valid
+	if err := s.userTokenRepo.InvalidateTokens(user.ID, model.TokenPurposeMagicLink); err != nil {
+		s.logger.Error("error invalidating magic link tokens", zap.Error(err))
+		return err
+	}
+
+	token, err := s.mail.CreateToken(user.ID, model.TokenPurposeMagicLink, s.cfg.Auth.MagicLinkExp)
+	if err != nil {
+		s.logger.Error("error creating magic link token", zap.Error(err))
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", s.cfg.Auth.MagicLinkURL, url.QueryEscape(token))
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to log in:\n\n%s\n\nThe link expires in %s and works once. If you did not request it you can ignore this email.\n",
+			user.Name, link, s.cfg.Auth.MagicLinkExp,
+		),
+	})
+
+	return nil
+}
+
+func (s *magicLinkService) MagicLinkLogin(token string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error) {
+	if !s.cfg.Auth.MagicLinkEnabled {
+		return res, nil, ErrMagicLinkDisabled
+	}
+
+	magicToken, err := s.userTokenRepo.ConsumeToken(model.TokenPurposeMagicLink, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("invalid or expired magic link token")
+			return res, nil, ErrInvalidMagicLink
+		}
+		s.logger.Error("error consuming magic link token", zap.Error(err))
+		return res, nil, err
+	}
+
+	s.logger.Info("Magic Link Login",
+		zap.String("user_id", magicToken.UserID),
+		zap.String("ip", client.IP),
+	)
+
+	user, err := s.userRepo.GetUserByID(magicToken.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, nil, ErrInvalidMagicLink
+		}
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return res, nil, err
+	}
+
+	if err := s.loginThrottle.Check(user.Email, ""); err != nil {
+		s.logger.Warn("magic link login rejected while locked out", zap.String("user_id", user.ID))
+		recordLoginFailure(s.audit, user.ID, user.Email, "locked_out", client)
+		return res, nil, err
+	}
+
+	// following the mailed link proves the user owns the address
+	if !user.EmailVerifiedAt.Valid {
+		if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+			s.logger.Error("error marking email verified", zap.Error(err))
+			return res, nil, err
+		}
+		user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	if user.PasswordResetRequired {
+		s.logger.Error("login while password reset is required", zap.String("user_id", user.ID))
+		recordLoginFailure(s.audit, user.ID, user.Email, "password_reset_required", client)
+		return res, nil, ErrPasswordResetRequired
+	}
+
+	mfaEnabled, err := s.mfaService.IsEnabled(user.ID)
+	if err != nil {
+		return res, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := s.sessions.MFAChallenge(user)
+		if err != nil {
+			s.logger.Error("error creating mfa challenge", zap.Error(err))
+			return res, nil, err
+		}
+		return res, challenge, nil
+	}
+
+	res, err = s.sessions.CompleteLogin(user, "magic_link", client)
+	return res, nil, err
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrMFANotConfigured  = errors.New("multi-factor authentication is not configured")
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("multi-factor authentication is not enabled")
+	ErrMFARequiredByRole = errors.New("multi-factor authentication is required for your role")
+	ErrInvalidMFACode    = errors.New("invalid verification code")
+)
+
+type MFAService interface {
+	Status(userID string) (dto.MFAStatusResponse, error)
+	Enroll(userID, email string) (dto.MFAEnrollResponse, error)
+	Activate(userID, code string) (dto.MFARecoveryCodesResponse, error)
+	Disable(userID, code string) error
+	IsEnabled(userID string) (bool, error)
+	// Verify accepts either a current TOTP code or an unused recovery code.
+	Verify(userID, code string) error
+}
+
+type mfaService struct {
+	logger   *zap.Logger
+	cfg      *config.Config
+	mfaRepo  repository.MFARepository
+	userRepo repository.UserRepository
+	roleRepo repository.RoleRepository
+}
+
+func NewMFAService(logger *zap.Logger, cfg *config.Config, mfaRepo repository.MFARepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository) MFAService {
+	return &mfaService{
+		logger:   logger,
+		cfg:      cfg,
+		mfaRepo:  mfaRepo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+	}
+}
+
+func (s *mfaService) Status(userID string) (res dto.MFAStatusResponse, err error) {
+	enabled, err := s.IsEnabled(userID)
+	if err != nil || !enabled {
+		return res, err
+	}
+
+	remaining, err := s.mfaRepo.CountRecoveryCodes(userID)
+	if err != nil {
+		s.logger.Error("error counting recovery codes", zap.Error(err))
+		return res, err
+	}
+
+	return dto.MFAStatusResponse{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+func (s *mfaService) Enroll(userID, email string) (res dto.MFAEnrollResponse, err error) {
+	s.logger.Info("Enroll MFA",
+		zap.String("user_id", userID),
+	)
+
+	if s.cfg.Auth.MFAEncryptionKey == "" {
+		s.logger.Error("MFA_ENCRYPTION_KEY is not set")
+		return res, ErrMFANotConfigured
+	}
+
+	enabled, err := s.IsEnabled(userID)
+	if err != nil {
+		return res, err
+	}
+	if enabled {
+		return res, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		s.logger.Error("error generating totp secret", zap.Error(err))
+		return res, err
+	}
+
+	encrypted, err := utils.Encrypt(secret, s.cfg.Auth.MFAEncryptionKey)
+	if err != nil {
+		s.logger.Error("error encrypting totp secret", zap.Error(err))
+		return res, err
+	}
+
+	if err := s.mfaRepo.SavePendingMFA(userID, encrypted); err != nil {
+		s.logger.Error("error saving totp secret", zap.Error(err))
+		return res, err
+	}
+
+	return dto.MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(s.cfg.Auth.MFAIssuer, email, secret),
+	}, nil
+}
+
+// Activate enables a pending secret once the user proves their authenticator
+// app produces valid codes, and hands out a fresh set of recovery codes.
+func (s *mfaService) Activate(userID, code string) (res dto.MFARecoveryCodesResponse, err error) {
+	s.logger.Info("Activate MFA",
+		zap.String("user_id", userID),
+	)
+
+	mfa, err := s.mfaRepo.GetMFA(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, ErrMFANotEnabled
+		}
+		s.logger.Error("error getting mfa", zap.Error(err))
+		return res, err
+	}
+	if mfa.EnabledAt.Valid {
+		return res, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.Decrypt(mfa.Secret, s.cfg.Auth.MFAEncryptionKey)
+	if err != nil {
+		s.logger.Error("error decrypting totp secret", zap.Error(err))
+		return res, err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), s.cfg.Auth.MFASkew)
+	if !ok {
+		s.logger.Error("invalid totp code on activation", zap.String("user_id", userID))
+		return res, ErrInvalidMFACode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw, err := utils.RandomString(5)
+		if err != nil {
+			return res, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+
+	if err := s.mfaRepo.EnableMFA(userID, step, hashes); err != nil {
+		s.logger.Error("error enabling mfa", zap.Error(err))
+		return res, err
+	}
+
+	return dto.MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *mfaService) Disable(userID, code string) error {
+	s.logger.Info("Disable MFA",
+		zap.String("user_id", userID),
+	)
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return err
+	}
+
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return err
+	}
+	if role.MFARequired {
+		return ErrMFARequiredByRole
+	}
+
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.DeleteMFA(userID); err != nil {
+		s.logger.Error("error deleting mfa", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *mfaService) IsEnabled(userID string) (bool, error) {
+	mfa, err := s.mfaRepo.GetMFA(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		s.logger.Error("error getting mfa", zap.Error(err))
+		return false, err
+	}
+	return mfa.EnabledAt.Valid, nil
+}
+
+func (s *mfaService) Verify(userID, code string) error {
+	mfa, err := s.mfaRepo.GetMFA(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMFANotEnabled
+		}
+		s.logger.Error("error getting mfa", zap.Error(err))
+		return err
+	}
+	if !mfa.EnabledAt.Valid {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	secret, err := utils.Decrypt(mfa.Secret, s.cfg.Auth.MFAEncryptionKey)
+	if err != nil {
+		s.logger.Error("error decrypting totp secret", zap.Error(err))
+		return err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now(), s.cfg.Auth.MFASkew); ok {
+		// a code is only accepted once, even within its validity window
+		used, err := s.mfaRepo.UseStep(userID, step)
+		if err != nil {
+			s.logger.Error("error recording totp step", zap.Error(err))
+			return err
+		}
+		if !used {
+			s.logger.Warn("totp code replayed", zap.String("user_id", userID))
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(userID, utils.HashToken(code))
+	if err != nil {
+		s.logger.Error("error using recovery code", zap.Error(err))
+		return err
+	}
+	if !used {
+		s.logger.Error("invalid mfa code", zap.String("user_id", userID))
+		return ErrInvalidMFACode
+	}
+
+	s.logger.Info("recovery code used", zap.String("user_id", userID))
+	return nil
+}
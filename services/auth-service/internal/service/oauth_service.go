@@ -0,0 +1,766 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/oidc"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// OAuth error codes from RFC 6749 section 5.2.
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthInvalidGrant         = "invalid_grant"
+	OAuthUnauthorizedClient   = "unauthorized_client"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthAccessDenied         = "access_denied"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrConsentNotFound     = errors.New("consent not found")
+	ErrUnknownScope        = errors.New("scopes must be existing permissions")
+	ErrPublicClientGrant   = errors.New("public clients can only use the authorization_code grant")
+	ErrPublicClientSecret  = errors.New("public clients have no secret")
+	ErrRedirectURIRequired = errors.New("the authorization_code grant needs at least one redirect uri")
+)
+
+// OAuthError is returned by the authorization server endpoints and rendered
+// as described in RFC 6749.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// authorizationCode is what an issued code stands for until it is redeemed.
+type authorizationCode struct {
+	ClientID      string `json:"client_id"`
+	UserID        string `json:"user_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scopes        string `json:"scopes"`
+	CodeChallenge string `json:"code_challenge"`
+	TokenFamily   string `json:"token_family"`
+}
+
+func authorizationCodeKey(code string) string {
+	return "oauth_code:" + utils.HashToken(code)
+}
+
+// clientTokenFamily is the family of the tokens a client obtains for itself
+// and of the user tokens of first party clients, which have no consent. It is
+// revoked when the client is deleted.
+func clientTokenFamily(clientID string) string {
+	return "oauth_client:" + clientID
+}
+
+// OAuthService lets registered clients obtain access tokens, either for
+// themselves through the client credentials grant or on behalf of a user
+// through the authorization code grant. Scopes are permission names.
+type OAuthService interface {
+	CreateClient(req dto.OAuthClientRequest) (dto.OAuthClientSecretResponse, error)
+	GetClients() ([]dto.OAuthClientResponse, error)
+	GetClient(clientID string) (dto.OAuthClientResponse, error)
+	// RotateClientSecret replaces the secret of a confidential client.
+	// Tokens issued with the old secret stay valid until they expire.
+	RotateClientSecret(clientID string) (dto.OAuthClientSecretResponse, error)
+	// DeleteClient also revokes every token issued to the client.
+	DeleteClient(clientID string) error
+
+	// GetAuthorization validates an authorization request of the user and
+	// tells whether it needs their consent.
+	GetAuthorization(userID string, req dto.AuthorizationRequest) (dto.AuthorizationResponse, error)
+	// Authorize records the user's decision and returns the client redirect
+	// carrying either a code or the access_denied error.
+	Authorize(userID string, req dto.AuthorizationRequest, approve bool) (dto.AuthorizationRedirectResponse, error)
+	Token(auth dto.ClientAuthentication, req dto.TokenRequest) (dto.TokenResponse, error)
+	// Introspect describes a token to an authenticated confidential client.
+	Introspect(auth dto.ClientAuthentication, token string) (dto.IntrospectionResponse, error)
+
+	GetConsents(userID string) ([]dto.ConsentResponse, error)
+	// RevokeConsent also revokes the tokens issued under the consent.
+	RevokeConsent(userID, clientID string) error
+}
+
+type oauthService struct {
+	logger         *zap.Logger
+	cfg            *config.Config
+	clientRepo     repository.OAuthClientRepository
+	consentRepo    repository.OAuthConsentRepository
+	userRepo       repository.UserRepository
+	roleRepo       repository.RoleRepository
+	permissionRepo repository.PermissionRepository
+	mfaService     MFAService
+	keyService     KeyService
+	denylist       utils.TokenDenylist
+	cache          utils.CacheService
+}
+
+func NewOAuthService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	clientRepo repository.OAuthClientRepository,
+	consentRepo repository.OAuthConsentRepository,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	mfaService MFAService,
+	keyService KeyService,
+	denylist utils.TokenDenylist,
+	cache utils.CacheService,
+) OAuthService {
+	return &oauthService{
+		logger:         logger,
+		cfg:            cfg,
+		clientRepo:     clientRepo,
+		consentRepo:    consentRepo,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		mfaService:     mfaService,
+		keyService:     keyService,
+		denylist:       denylist,
+		cache:          cache,
+	}
+}
+
+func (s *oauthService) CreateClient(req dto.OAuthClientRequest) (res dto.OAuthClientSecretResponse, err error) {
+	s.logger.Info("Create OAuth Client",
+		zap.String("name", req.Name),
+	)
+
+	if !req.Confidential && slices.Contains(req.GrantTypes, model.GrantTypeClientCredentials) {
+		return res, ErrPublicClientGrant
+	}
+	if slices.Contains(req.GrantTypes, model.GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return res, ErrRedirectURIRequired
+	}
+
+	permissions, err := s.permissionRepo.GetAllPermissions()
+	if err != nil {
+		s.logger.Error("error getting permissions", zap.Error(err))
+		return res, err
+	}
+	for _, scope := range req.Scopes {
+		if !slices.ContainsFunc(permissions, func(p *model.Permission) bool { return p.Name == scope }) {
+			return res, ErrUnknownScope
+		}
+	}
+
+	clientID, err := utils.RandomString(16)
+	if err != nil {
+		return res, err
+	}
+	client := &model.OAuthClient{
+		ID:           clientID,
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		GrantTypes:   strings.Join(req.GrantTypes, " "),
+		Scopes:       strings.Join(req.Scopes, " "),
+		FirstParty:   req.FirstParty,
+	}
+
+	var secret string
+	if req.Confidential {
+		secret, err = utils.RandomString(32)
+		if err != nil {
+			return res, err
+		}
+		client.SecretHash = sql.NullString{String: utils.HashToken(secret), Valid: true}
+	}
+
+	if err := s.clientRepo.CreateClient(client); err != nil {
+		s.logger.Error("error creating oauth client", zap.Error(err))
+		return res, err
+	}
+
+	return dto.OAuthClientSecretResponse{
+		OAuthClientResponse: dto.NewOAuthClientResponse(client),
+		Secret:              secret,
+	}, nil
+}
+
+func (s *oauthService) GetClients() ([]dto.OAuthClientResponse, error) {
+	clients, err := s.clientRepo.GetAllClients()
+	if err != nil {
+		s.logger.Error("error getting oauth clients", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		res = append(res, dto.NewOAuthClientResponse(client))
+	}
+	return res, nil
+}
+
+func (s *oauthService) GetClient(clientID string) (res dto.OAuthClientResponse, err error) {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return res, err
+	}
+	return dto.NewOAuthClientResponse(client), nil
+}
+
+func (s *oauthService) RotateClientSecret(clientID string) (res dto.OAuthClientSecretResponse, err error) {
+	s.logger.Info("Rotate OAuth Client Secret",
+		zap.String("client_id", clientID),
+	)
+
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return res, err
+	}
+	if !client.Confidential() {
+		return res, ErrPublicClientSecret
+	}
+
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return res, err
+	}
+	if err := s.clientRepo.UpdateClientSecret(clientID, utils.HashToken(secret)); err != nil {
+		s.logger.Error("error updating oauth client secret", zap.Error(err))
+		return res, err
+	}
+
+	return dto.OAuthClientSecretResponse{
+		OAuthClientResponse: dto.NewOAuthClientResponse(client),
+		Secret:              secret,
+	}, nil
+}
+
+func (s *oauthService) DeleteClient(clientID string) error {
+	s.logger.Info("Delete OAuth Client",
+		zap.String("client_id", clientID),
+	)
+
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	// the consents are deleted along with the client, their families have
+	// to be revoked first so a failed revocation can be retried
+	consents, err := s.consentRepo.GetConsentsByClientID(client.ID)
+	if err != nil {
+		s.logger.Error("error getting consents", zap.Error(err))
+		return err
+	}
+
+	families := []string{clientTokenFamily(client.ID)}
+	for _, consent := range consents {
+		families = append(families, consent.TokenFamily)
+	}
+	for _, family := range families {
+		if err := s.denylist.RevokeFamily(family, s.cfg.OAuth.AccessTokenExp); err != nil {
+			s.logger.Error("error revoking oauth token family", zap.Error(err))
+			return err
+		}
+	}
+
+	if err := s.clientRepo.DeleteClient(client.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOAuthClientNotFound
+		}
+		s.logger.Error("error deleting oauth client", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *oauthService) GetAuthorization(userID string, req dto.AuthorizationRequest) (res dto.AuthorizationResponse, err error) {
+	client, scopes, err := s.validateAuthorization(req)
+	if err != nil {
+		return res, err
+	}
+
+	consentRequired, err := s.consentRequired(userID, client, scopes)
+	if err != nil {
+		return res, err
+	}
+
+	return dto.AuthorizationResponse{
+		ClientID:        client.ID,
+		ClientName:      client.Name,
+		Scopes:          scopes,
+		ConsentRequired: consentRequired,
+	}, nil
+}
+
+func (s *oauthService) Authorize(userID string, req dto.AuthorizationRequest, approve bool) (res dto.AuthorizationRedirectResponse, err error) {
+	client, scopes, err := s.validateAuthorization(req)
+	if err != nil {
+		return res, err
+	}
+
+	s.logger.Info("Authorize OAuth Client",
+		zap.String("user_id", userID),
+		zap.String("client_id", client.ID),
+		zap.Bool("approve", approve),
+	)
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !approve {
+		params.Set("error", OAuthAccessDenied)
+		return dto.AuthorizationRedirectResponse{RedirectURL: redirectURL(req.RedirectURI, params)}, nil
+	}
+
+	tokenFamily := clientTokenFamily(client.ID)
+	if !client.FirstParty {
+		consent, err := s.saveConsent(userID, client.ID, scopes)
+		if err != nil {
+			return res, err
+		}
+		tokenFamily = consent.TokenFamily
+	}
+
+	code, err := utils.RandomString(32)
+	if err != nil {
+		return res, err
+	}
+	value, err := json.Marshal(authorizationCode{
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        strings.Join(scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		TokenFamily:   tokenFamily,
+	})
+	if err != nil {
+		return res, err
+	}
+	if err := s.cache.Set(authorizationCodeKey(code), value, int64(s.cfg.OAuth.AuthorizationCodeExp.Seconds())); err != nil {
+		s.logger.Error("error storing authorization code", zap.Error(err))
+		return res, err
+	}
+
+	params.Set("code", code)
+	return dto.AuthorizationRedirectResponse{RedirectURL: redirectURL(req.RedirectURI, params)}, nil
+}
+
+func (s *oauthService) Token(auth dto.ClientAuthentication, req dto.TokenRequest) (res dto.TokenResponse, err error) {
+	client, err := s.authenticateClient(auth)
+	if err != nil {
+		return res, err
+	}
+
+	s.logger.Info("OAuth Token",
+		zap.String("client_id", client.ID),
+		zap.String("grant_type", req.GrantType),
+	)
+
+	switch req.GrantType {
+	case model.GrantTypeClientCredentials, model.GrantTypeAuthorizationCode:
+	default:
+		return res, oauthError(OAuthUnsupportedGrantType, "grant type is not supported")
+	}
+	if !slices.Contains(client.GrantTypeList(), req.GrantType) {
+		return res, oauthError(OAuthUnauthorizedClient, "client may not use this grant type")
+	}
+
+	if req.GrantType == model.GrantTypeClientCredentials {
+		return s.clientCredentialsToken(client, req)
+	}
+	return s.authorizationCodeToken(client, req)
+}
+
+func (s *oauthService) Introspect(auth dto.ClientAuthentication, token string) (res dto.IntrospectionResponse, err error) {
+	client, err := s.authenticateClient(auth)
+	if err != nil {
+		return res, err
+	}
+	if !client.Confidential() {
+		return res, oauthError(OAuthUnauthorizedClient, "only confidential clients may introspect tokens")
+	}
+
+	claims, err := s.keyService.Verify(token)
+	if err != nil || !claims.IsAccessToken() {
+		return dto.IntrospectionResponse{Active: false}, nil
+	}
+
+	revoked, err := s.denylist.IsRevoked(claims)
+	if err != nil {
+		s.logger.Error("error checking token denylist", zap.Error(err))
+		return res, err
+	}
+	if revoked {
+		return dto.IntrospectionResponse{Active: false}, nil
+	}
+
+	// user tokens of the first party apps carry no scope string
+	scope := claims.Scope
+	if claims.ClientID == "" {
+		scope = strings.Join(claims.Permissions, " ")
+	}
+
+	res = dto.IntrospectionResponse{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Email,
+		TokenType: "Bearer",
+		Sub:       claims.ID,
+		Iss:       claims.Issuer,
+		Jti:       claims.RegisteredClaims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		res.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		res.Iat = claims.IssuedAt.Unix()
+	}
+	return res, nil
+}
+
+func (s *oauthService) GetConsents(userID string) ([]dto.ConsentResponse, error) {
+	consents, err := s.consentRepo.GetConsentsByUserID(userID)
+	if err != nil {
+		s.logger.Error("error getting consents", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		client, err := s.clientRepo.GetClientByID(consent.ClientID)
+		if err != nil {
+			s.logger.Error("error getting oauth client", zap.Error(err))
+			return nil, err
+		}
+		res = append(res, dto.ConsentResponse{
+			ClientID:   client.ID,
+			ClientName: client.Name,
+			Scopes:     consent.ScopeList(),
+			CreatedAt:  consent.CreatedAt,
+			UpdatedAt:  consent.UpdatedAt,
+		})
+	}
+	return res, nil
+}
+
+func (s *oauthService) RevokeConsent(userID, clientID string) error {
+	s.logger.Info("Revoke OAuth Consent",
+		zap.String("user_id", userID),
+		zap.String("client_id", clientID),
+	)
+
+	consent, err := s.consentRepo.GetConsent(userID, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrConsentNotFound
+		}
+		s.logger.Error("error getting consent", zap.Error(err))
+		return err
+	}
+
+	if err := s.consentRepo.DeleteConsent(userID, clientID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrConsentNotFound
+		}
+		s.logger.Error("error deleting consent", zap.Error(err))
+		return err
+	}
+
+	if err := s.denylist.RevokeFamily(consent.TokenFamily, s.cfg.OAuth.AccessTokenExp); err != nil {
+		s.logger.Error("error revoking oauth token family", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *oauthService) clientCredentialsToken(client *model.OAuthClient, req dto.TokenRequest) (res dto.TokenResponse, err error) {
+	scopes, err := requestedScopes(client, req.Scope)
+	if err != nil {
+		return res, err
+	}
+
+	claims := utils.NewClaims(
+		client.ID,
+		client.Name,
+		"",
+		s.cfg.App.Name,
+		utils.AccessToken,
+		time.Now().Add(s.cfg.OAuth.AccessTokenExp),
+	)
+	claims.FamilyID = clientTokenFamily(client.ID)
+	return s.issueToken(client, claims, scopes)
+}
+
+func (s *oauthService) authorizationCodeToken(client *model.OAuthClient, req dto.TokenRequest) (res dto.TokenResponse, err error) {
+	if req.Code == "" {
+		return res, oauthError(OAuthInvalidRequest, "code is required")
+	}
+
+	// codes are single use, even when the redemption fails, so concurrent
+	// requests must not both read it
+	value, err := s.cache.GetDel(authorizationCodeKey(req.Code))
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return res, oauthError(OAuthInvalidGrant, "authorization code is invalid or expired")
+		}
+		s.logger.Error("error getting authorization code", zap.Error(err))
+		return res, err
+	}
+
+	var code authorizationCode
+	if err := json.Unmarshal(value, &code); err != nil {
+		s.logger.Error("error decoding authorization code", zap.Error(err))
+		return res, oauthError(OAuthInvalidGrant, "authorization code is invalid or expired")
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return res, oauthError(OAuthInvalidGrant, "authorization code was issued to another client or redirect uri")
+	}
+	if code.CodeChallenge != "" || req.CodeVerifier != "" {
+		if subtle.ConstantTimeCompare([]byte(oidc.CodeChallenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+			return res, oauthError(OAuthInvalidGrant, "code verifier does not match the code challenge")
+		}
+	}
+
+	user, err := s.userRepo.GetUserByID(code.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, oauthError(OAuthInvalidGrant, "user no longer exists")
+		}
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", code.UserID))
+		return res, err
+	}
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+	permissions, err := grantedPermissions(s.cfg, s.permissionRepo, s.mfaService, user, role)
+	if err != nil {
+		s.logger.Error("error getting granted permissions", zap.Error(err))
+		return res, err
+	}
+
+	// the user may have lost permissions since granting them
+	var scopes []string
+	for _, scope := range strings.Fields(code.Scopes) {
+		if slices.Contains(permissions, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	claims := utils.NewClaims(
+		user.ID,
+		user.Name,
+		user.Email,
+		s.cfg.App.Name,
+		utils.AccessToken,
+		time.Now().Add(s.cfg.OAuth.AccessTokenExp),
+	)
+	claims.FamilyID = code.TokenFamily
+	claims.Role = role.Name
+	claims.EmailVerified = user.EmailVerifiedAt.Valid
+	return s.issueToken(client, claims, scopes)
+}
+
+func (s *oauthService) issueToken(client *model.OAuthClient, claims utils.MyClaims, scopes []string) (res dto.TokenResponse, err error) {
+	claims.ClientID = client.ID
+	claims.Scope = strings.Join(scopes, " ")
+	claims.Permissions = scopes
+
+	token, err := s.keyService.Sign(claims)
+	if err != nil {
+		s.logger.Error("error signing oauth access token", zap.Error(err))
+		return res, err
+	}
+
+	return dto.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.OAuth.AccessTokenExp.Seconds()),
+		Scope:       claims.Scope,
+	}, nil
+}
+
+// validateAuthorization checks an authorization request against the client
+// registration and returns the client with the requested scopes.
+func (s *oauthService) validateAuthorization(req dto.AuthorizationRequest) (*model.OAuthClient, []string, error) {
+	client, err := s.clientRepo.GetClientByID(req.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, oauthError(OAuthInvalidClient, "unknown client")
+		}
+		s.logger.Error("error getting oauth client", zap.Error(err))
+		return nil, nil, err
+	}
+
+	// redirect uris are compared exactly, anything looser lets codes leak to
+	// attacker controlled pages
+	if !slices.Contains(client.RedirectURIList(), req.RedirectURI) {
+		return nil, nil, oauthError(OAuthInvalidRequest, "redirect uri is not registered for the client")
+	}
+	if req.ResponseType != "code" {
+		return nil, nil, oauthError(OAuthInvalidRequest, "only the code response type is supported")
+	}
+	if !slices.Contains(client.GrantTypeList(), model.GrantTypeAuthorizationCode) {
+		return nil, nil, oauthError(OAuthUnauthorizedClient, "client may not use the authorization code grant")
+	}
+
+	if req.CodeChallenge == "" {
+		if !client.Confidential() {
+			return nil, nil, oauthError(OAuthInvalidRequest, "public clients must use PKCE")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return nil, nil, oauthError(OAuthInvalidRequest, "code challenge method must be S256")
+	}
+
+	scopes, err := requestedScopes(client, req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, scopes, nil
+}
+
+func (s *oauthService) consentRequired(userID string, client *model.OAuthClient, scopes []string) (bool, error) {
+	if client.FirstParty {
+		return false, nil
+	}
+
+	consent, err := s.consentRepo.GetConsent(userID, client.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		s.logger.Error("error getting consent", zap.Error(err))
+		return false, err
+	}
+
+	granted := consent.ScopeList()
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// saveConsent adds scopes to the user's consent for the client.
+func (s *oauthService) saveConsent(userID, clientID string, scopes []string) (*model.OAuthConsent, error) {
+	consent, err := s.consentRepo.GetConsent(userID, clientID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting consent", zap.Error(err))
+		return nil, err
+	}
+
+	if consent == nil {
+		consent = &model.OAuthConsent{
+			UserID:      userID,
+			ClientID:    clientID,
+			TokenFamily: rand.Text(),
+		}
+	}
+	granted := consent.ScopeList()
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	consent.Scopes = strings.Join(granted, " ")
+
+	if err := s.consentRepo.SaveConsent(consent); err != nil {
+		s.logger.Error("error saving consent", zap.Error(err))
+		return nil, err
+	}
+	return consent, nil
+}
+
+// authenticateClient checks the client credentials. Public clients only send
+// their id.
+func (s *oauthService) authenticateClient(auth dto.ClientAuthentication) (*model.OAuthClient, error) {
+	if auth.ClientID == "" {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+
+	client, err := s.clientRepo.GetClientByID(auth.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+		s.logger.Error("error getting oauth client", zap.Error(err))
+		return nil, err
+	}
+
+	if client.Confidential() {
+		hash := utils.HashToken(auth.ClientSecret)
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash.String)) != 1 {
+			s.logger.Error("invalid oauth client secret", zap.String("client_id", client.ID))
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+	} else if auth.ClientSecret != "" {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+func (s *oauthService) getClient(clientID string) (*model.OAuthClient, error) {
+	client, err := s.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthClientNotFound
+		}
+		s.logger.Error("error getting oauth client", zap.Error(err))
+		return nil, err
+	}
+	return client, nil
+}
+
+// requestedScopes parses a scope parameter. No scope means every scope the
+// client is registered for.
+func requestedScopes(client *model.OAuthClient, scope string) ([]string, error) {
+	allowed := client.ScopeList()
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, oauthError(OAuthInvalidScope, "scope "+s+" is not allowed for the client")
+		}
+	}
+	slices.Sort(requested)
+	return slices.Compact(requested), nil
+}
+
+func redirectURL(redirectURI string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
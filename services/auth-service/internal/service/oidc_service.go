@@ -0,0 +1,514 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/oidc"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown login provider")
+	ErrInvalidOIDCState = errors.New("login state is invalid or expired, start the login again")
+	ErrOIDCLoginFailed  = errors.New("login with the provider failed")
+	ErrIdentityInUse    = errors.New("this provider account is already linked to a user")
+	// ErrIdentityNotLinked is returned when the provider's email belongs to
+	// an account that cannot be linked automatically. The user has to log in
+	// and link the provider from their profile.
+	ErrIdentityNotLinked = errors.New("an account with this email already exists, log in and link the provider from your profile")
+	ErrIdentityNotFound  = errors.New("identity not found")
+)
+
+// oidcState is what a login or link remembers between redirecting the user
+// to the provider and the callback. UserID is set when linking.
+type oidcState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	UserID       string `json:"user_id,omitempty"`
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// OIDCService logs users in through external OpenID Connect providers and
+// links provider accounts to users. OIDCLogin behaves like
+// UserService.Login.
+type OIDCService interface {
+	OIDCProviders() []string
+	OIDCAuthorizationURL(provider string) (string, error)
+	// OIDCLogin finishes a provider login. Unknown provider accounts are
+	// linked to the user with the same email when both sides verified it,
+	// and get a new user otherwise.
+	OIDCLogin(code, state string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error)
+	GetIdentities(accessToken string) ([]dto.IdentityResponse, error)
+	// LinkIdentityURL starts linking a provider account to the token's
+	// user.
+	LinkIdentityURL(accessToken, provider string) (string, error)
+	LinkIdentity(accessToken, code, state string) (dto.IdentityResponse, error)
+	UnlinkIdentity(accessToken string, identityID int) error
+}
+
+type oidcService struct {
+	logger         *zap.Logger
+	cfg            *config.Config
+	userRepo       repository.UserRepository
+	roleRepo       repository.RoleRepository
+	identityRepo   repository.IdentityRepository
+	providers      map[string]*oidc.Provider
+	cache          utils.CacheService
+	mfaService     MFAService
+	sessions       SessionService
+	mail           AccountMailer
+	passwordHasher utils.PasswordHasher
+	audit          AuditService
+}
+
+func NewOIDCService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	identityRepo repository.IdentityRepository,
+	providers map[string]*oidc.Provider,
+	cache utils.CacheService,
+	mfaService MFAService,
+	sessions SessionService,
+	mail AccountMailer,
+	passwordHasher utils.PasswordHasher,
+	audit AuditService,
+) OIDCService {
+	return &oidcService{
+		logger:         logger,
+		cfg:            cfg,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		identityRepo:   identityRepo,
+		providers:      providers,
+		cache:          cache,
+		mfaService:     mfaService,
+		sessions:       sessions,
+		mail:           mail,
+		passwordHasher: passwordHasher,
+		audit:          audit,
+	}
+}
+
+func (s *oidcService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *oidcService) OIDCAuthorizationURL(provider string) (string, error) {
+	return s.authorizationURL(provider, "")
+}
+
+func (s *oidcService) OIDCLogin(code, state string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error) {
+	saved, identity, err := s.oidcCallback(code, state)
+	if err != nil {
+		return res, nil, err
+	}
+	if saved.UserID != "" {
+		s.logger.Error("link state used for login", zap.String("user_id", saved.UserID))
+		return res, nil, ErrInvalidOIDCState
+	}
+
+	s.logger.Info("OIDC Login",
+		zap.String("provider", saved.Provider),
+		zap.String("email", identity.Email),
+		zap.String("ip", client.IP),
+	)
+
+	user, err := s.oidcUser(saved.Provider, identity)
+	if err != nil {
+		return res, nil, err
+	}
+
+	if user.PasswordResetRequired {
+		s.logger.Error("login while password reset is required", zap.String("user_id", user.ID))
+		recordLoginFailure(s.audit, user.ID, user.Email, "password_reset_required", client)
+		return res, nil, ErrPasswordResetRequired
+	}
+
+	if s.cfg.Auth.RequireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		s.logger.Error("login with unverified email", zap.String("user_id", user.ID))
+		recordLoginFailure(s.audit, user.ID, user.Email, "email_not_verified", client)
+		return res, nil, ErrEmailNotVerified
+	}
+
+	mfaEnabled, err := s.mfaService.IsEnabled(user.ID)
+	if err != nil {
+		return res, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := s.sessions.MFAChallenge(user)
+		if err != nil {
+			s.logger.Error("error creating mfa challenge", zap.Error(err))
+			return res, nil, err
+		}
+		return res, challenge, nil
+	}
+
+	res, err = s.sessions.CompleteLogin(user, "oidc:"+saved.Provider, client)
+	return res, nil, err
+}
+
+func (s *oidcService) GetIdentities(accessToken string) ([]dto.IdentityResponse, error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.identityRepo.GetIdentitiesByUserID(claims.ID)
+	if err != nil {
+		s.logger.Error("error getting identities", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		res = append(res, dto.NewIdentityResponse(identity))
+	}
+	return res, nil
+}
+
+func (s *oidcService) LinkIdentityURL(accessToken, provider string) (string, error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	return s.authorizationURL(provider, claims.ID)
+}
+
+func (s *oidcService) LinkIdentity(accessToken, code, state string) (res dto.IdentityResponse, err error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return res, err
+	}
+
+	user, err := currentUser(s.logger, s.userRepo, claims)
+	if err != nil {
+		return res, err
+	}
+
+	saved, identity, err := s.oidcCallback(code, state)
+	if err != nil {
+		return res, err
+	}
+	// the state must have been created by the same user, otherwise anyone
+	// could get their provider account linked to a victim's session
+	if saved.UserID != user.ID {
+		s.logger.Error("link state of another user", zap.String("user_id", user.ID))
+		return res, ErrInvalidOIDCState
+	}
+
+	s.logger.Info("Link Identity",
+		zap.String("user_id", user.ID),
+		zap.String("provider", saved.Provider),
+	)
+
+	linked, err := s.createIdentity(user.ID, saved.Provider, identity)
+	if err != nil {
+		return res, err
+	}
+
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "A login provider was linked to your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYou can now log in with your %s account %s. If this was not you, remove it from your profile and change your password right away.\n",
+			user.Name, saved.Provider, identity.Email,
+		),
+	})
+
+	return dto.NewIdentityResponse(linked), nil
+}
+
+func (s *oidcService) UnlinkIdentity(accessToken string, identityID int) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Unlink Identity",
+		zap.String("user_id", claims.ID),
+		zap.Int("identity_id", identityID),
+	)
+
+	if err := s.identityRepo.DeleteIdentity(claims.ID, identityID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIdentityNotFound
+		}
+		s.logger.Error("error deleting identity", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// authorizationURL stores a new login state and returns the provider page
+// the user has to visit.
+func (s *oidcService) authorizationURL(provider, userID string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(oidcState{
+		Provider:     provider,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		UserID:       userID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.cache.Set(oidcStateKey(state), value, int64(s.cfg.OIDC.StateExp.Seconds())); err != nil {
+		s.logger.Error("error storing oidc state", zap.Error(err))
+		return "", err
+	}
+
+	authURL, err := p.AuthCodeURL(state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		s.logger.Error("error building authorization url", zap.Error(err), zap.String("provider", provider))
+		return "", err
+	}
+	return authURL, nil
+}
+
+// oidcCallback consumes the login state and resolves the provider account
+// the authorization code belongs to.
+func (s *oidcService) oidcCallback(code, state string) (*oidcState, *oidc.Identity, error) {
+	// the state is consumed atomically so that it can only be used once
+	value, err := s.cache.GetDel(oidcStateKey(state))
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return nil, nil, ErrInvalidOIDCState
+		}
+		s.logger.Error("error getting oidc state", zap.Error(err))
+		return nil, nil, err
+	}
+
+	var saved oidcState
+	if err := json.Unmarshal(value, &saved); err != nil {
+		s.logger.Error("error decoding oidc state", zap.Error(err))
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	p, ok := s.providers[saved.Provider]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	token, err := p.Exchange(code, saved.CodeVerifier)
+	if err != nil {
+		s.logger.Error("error exchanging authorization code", zap.Error(err), zap.String("provider", saved.Provider))
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	identity, err := p.Identity(token, saved.Nonce)
+	if err != nil {
+		s.logger.Error("error resolving identity", zap.Error(err), zap.String("provider", saved.Provider))
+		if errors.Is(err, oidc.ErrNoEmail) {
+			return nil, nil, fmt.Errorf("%w: %w", ErrOIDCLoginFailed, err)
+		}
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	return &saved, identity, nil
+}
+
+// oidcUser returns the user a provider account logs in as, linking or
+// creating one on first login.
+func (s *oidcService) oidcUser(provider string, identity *oidc.Identity) (*model.User, error) {
+	linked, err := s.identityRepo.GetIdentity(provider, identity.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetUserByID(linked.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				s.logger.Error("identity of a deleted user", zap.String("user_id", linked.UserID))
+				return nil, ErrUserNotFound
+			}
+			s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", linked.UserID))
+			return nil, err
+		}
+		if err := s.identityRepo.TouchIdentity(linked.ID, identity.Email, time.Now()); err != nil {
+			s.logger.Error("error updating identity", zap.Error(err))
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting identity", zap.Error(err))
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByEmail(identity.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", identity.Email))
+		return nil, err
+	}
+
+	if user == nil {
+		return s.provisionUser(provider, identity)
+	}
+
+	// an unverified local account may have been registered by someone else
+	// in advance, linking it would hand them the provider login
+	if !identity.EmailVerified || !user.EmailVerifiedAt.Valid {
+		s.logger.Warn("identity not linked automatically", zap.String("user_id", user.ID), zap.String("provider", provider))
+		return nil, ErrIdentityNotLinked
+	}
+
+	if _, err := s.createIdentity(user.ID, provider, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates the user for a provider account seen for the first
+// time, linked to that account. The random password is never shared, it
+// can be replaced through a password reset.
+func (s *oidcService) provisionUser(provider string, identity *oidc.Identity) (*model.User, error) {
+	role, err := s.roleRepo.GetRoleByName(s.cfg.Auth.DefaultRole)
+	if err != nil {
+		s.logger.Error("error getting default role",
+			zap.Error(err),
+			zap.String("role", s.cfg.Auth.DefaultRole),
+		)
+		return nil, err
+	}
+
+	name, err := s.availableName(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := s.passwordHasher.Hash(rand.Text())
+	if err != nil {
+		s.logger.Error("error hashing password", zap.Error(err))
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &model.User{
+		Name:            name,
+		Email:           identity.Email,
+		Password:        password,
+		RoleID:          role.ID,
+		EmailVerifiedAt: sql.NullTime{Time: now, Valid: identity.EmailVerified},
+	}
+	linked := newIdentity("", provider, identity, now)
+	if err := s.identityRepo.CreateUserWithIdentity(user, linked); err != nil {
+		if errors.Is(err, repository.ErrDuplicateIdentity) {
+			return nil, ErrIdentityInUse
+		}
+		s.logger.Error("error creating user", zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Info("Provision User",
+		zap.String("user_id", user.ID),
+		zap.String("email", user.Email),
+	)
+
+	if !identity.EmailVerified {
+		if err := s.mail.SendVerificationEmail(user); err != nil {
+			s.logger.Error("error sending verification email", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// availableName derives a user name from the provider profile, adding a
+// random suffix while the name is taken.
+func (s *oidcService) availableName(identity *oidc.Identity) (string, error) {
+	base := strings.TrimSpace(identity.Name)
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	// leave room for the suffix within the 50 characters names may have
+	if runes := []rune(base); len(runes) > 40 {
+		base = string(runes[:40])
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	name := base
+	for range 5 {
+		exists, err := s.userRepo.NameExists(name)
+		if err != nil {
+			s.logger.Error("error checking name", zap.Error(err))
+			return "", err
+		}
+		if !exists {
+			return name, nil
+		}
+
+		suffix, err := utils.RandomString(3)
+		if err != nil {
+			return "", err
+		}
+		name = base + "-" + suffix
+	}
+	return "", ErrNameTaken
+}
+
+func (s *oidcService) createIdentity(userID, provider string, identity *oidc.Identity) (*model.UserIdentity, error) {
+	linked := newIdentity(userID, provider, identity, time.Now())
+	if err := s.identityRepo.CreateIdentity(linked); err != nil {
+		if errors.Is(err, repository.ErrDuplicateIdentity) {
+			return nil, ErrIdentityInUse
+		}
+		s.logger.Error("error creating identity", zap.Error(err))
+		return nil, err
+	}
+	return linked, nil
+}
+
+func newIdentity(userID, provider string, identity *oidc.Identity, now time.Time) *model.UserIdentity {
+	return &model.UserIdentity{
+		UserID:      userID,
+		Provider:    provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: sql.NullTime{Time: now, Valid: true},
+	}
+}
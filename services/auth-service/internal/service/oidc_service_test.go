@@ -0,0 +1,283 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/oidc"
+	"github.com/ecomz/backend/libs/utils"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// The fakes embed the interface they implement, calling a method a test
+// does not expect panics.
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[string]*model.User
+}
+
+func (r *fakeUserRepo) GetUserByID(id string) (*model.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeUserRepo) GetUserByEmail(email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeUserRepo) NameExists(name string) (bool, error) {
+	for _, user := range r.users {
+		if user.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeRoleRepo struct {
+	repository.RoleRepository
+	roles []*model.Role
+}
+
+func (r *fakeRoleRepo) GetRoleByName(name string) (*model.Role, error) {
+	for _, role := range r.roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+type fakeIdentityRepo struct {
+	repository.IdentityRepository
+	users      *fakeUserRepo
+	identities []*model.UserIdentity
+}
+
+func (r *fakeIdentityRepo) GetIdentity(provider, subject string) (*model.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeIdentityRepo) CreateIdentity(identity *model.UserIdentity) error {
+	if _, err := r.GetIdentity(identity.Provider, identity.Subject); err == nil {
+		return repository.ErrDuplicateIdentity
+	}
+	identity.ID = len(r.identities) + 1
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error {
+	user.ID = "provisioned"
+	identity.UserID = user.ID
+	if err := r.CreateIdentity(identity); err != nil {
+		return err
+	}
+	r.users.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeIdentityRepo) TouchIdentity(id int, email string, now time.Time) error {
+	r.identities[id-1].Email = email
+	r.identities[id-1].LastLoginAt = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+type fakeAccountMailer struct {
+	AccountMailer
+	verifications []string
+}
+
+func (m *fakeAccountMailer) SendVerificationEmail(user *model.User) error {
+	m.verifications = append(m.verifications, user.ID)
+	return nil
+}
+
+type fakeCache struct {
+	utils.CacheService
+	values map[string][]byte
+}
+
+func (c *fakeCache) Set(key string, value []byte, ttl int64) error {
+	c.values[key] = value
+	return nil
+}
+
+func (c *fakeCache) GetDel(key string) ([]byte, error) {
+	value, ok := c.values[key]
+	if !ok {
+		return nil, redis.ErrNil
+	}
+	delete(c.values, key)
+	return value, nil
+}
+
+type fakePasswordHasher struct {
+	utils.PasswordHasher
+}
+
+func (fakePasswordHasher) Hash(password string) (string, error) {
+	return "hash:" + password, nil
+}
+
+func newTestOIDCService(users ...*model.User) (*oidcService, *fakeIdentityRepo, *fakeAccountMailer) {
+	userRepo := &fakeUserRepo{users: make(map[string]*model.User)}
+	for _, user := range users {
+		userRepo.users[user.ID] = user
+	}
+	identityRepo := &fakeIdentityRepo{users: userRepo}
+	mail := &fakeAccountMailer{}
+
+	s := &oidcService{
+		logger:         zap.NewNop(),
+		cfg:            &config.Config{Auth: config.AuthConfig{DefaultRole: "customer"}},
+		userRepo:       userRepo,
+		roleRepo:       &fakeRoleRepo{roles: []*model.Role{{ID: 1, Name: "admin"}, {ID: 2, Name: "customer"}}},
+		identityRepo:   identityRepo,
+		providers:      make(map[string]*oidc.Provider),
+		cache:          &fakeCache{values: make(map[string][]byte)},
+		mail:           mail,
+		passwordHasher: fakePasswordHasher{},
+	}
+	return s, identityRepo, mail
+}
+
+func verifiedUser(id, email string) *model.User {
+	return &model.User{
+		ID:              id,
+		Name:            id,
+		Email:           email,
+		RoleID:          1,
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+}
+
+func TestOIDCUserLinkedIdentity(t *testing.T) {
+	s, identityRepo, _ := newTestOIDCService(verifiedUser("jane", "jane@example.com"))
+	identityRepo.identities = []*model.UserIdentity{{ID: 1, UserID: "jane", Provider: "google", Subject: "sub", Email: "old@example.com"}}
+
+	user, err := s.oidcUser("google", &oidc.Identity{Subject: "sub", Email: "new@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "jane" {
+		t.Errorf("user = %s, want jane", user.ID)
+	}
+	if identity := identityRepo.identities[0]; identity.Email != "new@example.com" || !identity.LastLoginAt.Valid {
+		t.Errorf("identity was not updated: %+v", identity)
+	}
+}
+
+func TestOIDCUserAutoLink(t *testing.T) {
+	unverified := verifiedUser("jane", "jane@example.com")
+	unverified.EmailVerifiedAt = sql.NullTime{}
+
+	tests := []struct {
+		name          string
+		user          *model.User
+		emailVerified bool
+		wantErr       error
+	}{
+		{"both verified", verifiedUser("jane", "jane@example.com"), true, nil},
+		{"provider unverified", verifiedUser("jane", "jane@example.com"), false, ErrIdentityNotLinked},
+		{"local unverified", unverified, true, ErrIdentityNotLinked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, identityRepo, _ := newTestOIDCService(tt.user)
+
+			user, err := s.oidcUser("google", &oidc.Identity{Subject: "sub", Email: "jane@example.com", EmailVerified: tt.emailVerified})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(identityRepo.identities) != 0 {
+					t.Errorf("identity linked: %+v", identityRepo.identities[0])
+				}
+				return
+			}
+			if user.ID != "jane" {
+				t.Errorf("user = %s, want jane", user.ID)
+			}
+			if len(identityRepo.identities) != 1 || identityRepo.identities[0].UserID != "jane" {
+				t.Errorf("identity not linked to jane: %+v", identityRepo.identities)
+			}
+		})
+	}
+}
+
+func TestOIDCUserProvision(t *testing.T) {
+	for _, emailVerified := range []bool{true, false} {
+		s, identityRepo, mail := newTestOIDCService(verifiedUser("Jane", "other@example.com"))
+
+		user, err := s.oidcUser("google", &oidc.Identity{Subject: "sub", Email: "jane@example.com", EmailVerified: emailVerified, Name: "Jane"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.RoleID != 2 {
+			t.Errorf("role = %d, want the default role", user.RoleID)
+		}
+		if user.Name == "Jane" {
+			t.Error("provisioned user got a taken name")
+		}
+		if user.EmailVerifiedAt.Valid != emailVerified {
+			t.Errorf("email verified = %v, want %v", user.EmailVerifiedAt.Valid, emailVerified)
+		}
+		if wantMails := !emailVerified; (len(mail.verifications) == 1) != wantMails {
+			t.Errorf("verification mails = %v", mail.verifications)
+		}
+		if len(identityRepo.identities) != 1 || identityRepo.identities[0].UserID != user.ID {
+			t.Errorf("identity not linked to the new user: %+v", identityRepo.identities)
+		}
+	}
+}
+
+func TestOIDCCallbackConsumesState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s, _, _ := newTestOIDCService()
+	s.providers["github"] = oidc.NewProvider(config.OIDCProviderConfig{
+		Name:     "github",
+		AuthURL:  server.URL + "/authorize",
+		TokenURL: server.URL + "/token",
+	}, "http://localhost/callback")
+
+	if _, err := s.authorizationURL("github", ""); err != nil {
+		t.Fatal(err)
+	}
+	var state string
+	for key := range s.cache.(*fakeCache).values {
+		state = key[len(oidcStateKey("")):]
+	}
+
+	if _, _, err := s.oidcCallback("code", state); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("err = %v, want %v", err, ErrOIDCLoginFailed)
+	}
+	if _, _, err := s.oidcCallback("code", state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("reused state: err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
@@ -0,0 +1,624 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	organizationReadPermission  = "organization:read"
+	organizationWritePermission = "organization:write"
+	// memberWritePermission is granted by organization roles and lets
+	// members manage their organization.
+	memberWritePermission = "member:write"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var (
+	// ErrOrganizationNotFound is also returned to users who are not members
+	// so organizations cannot be discovered.
+	ErrOrganizationNotFound     = errors.New("organization not found")
+	ErrOrganizationForbidden    = errors.New("you cannot manage this organization")
+	ErrInvalidSlug              = errors.New("slug may only contain lowercase letters, digits and single dashes")
+	ErrSlugTaken                = errors.New("slug is already taken")
+	ErrOrganizationRoleNotFound = errors.New("organization role not found")
+	ErrMemberNotFound           = errors.New("member not found")
+	ErrAlreadyMember            = errors.New("user is already a member of the organization")
+	// ErrLastOwner keeps every organization manageable by one of its members.
+	ErrLastOwner               = errors.New("the organization must keep at least one owner")
+	ErrInvitationNotFound      = errors.New("invalid or expired invitation")
+	ErrInvitationEmailMismatch = errors.New("the invitation was sent to another email address")
+	ErrNotOrganizationMember   = errors.New("you are not a member of the organization")
+)
+
+// OrganizationService manages organizations, the merchants of the
+// marketplace, and their members. Members act for an organization by
+// switching their session to it, see UserService.RefreshToken.
+//
+// Members with the member:write permission in their organization role and
+// holders of the global organization:write permission manage an
+// organization.
+type OrganizationService interface {
+	// CreateOrganization makes the creator its owner.
+	CreateOrganization(actor *utils.MyClaims, req dto.OrganizationRequest) (dto.OrganizationResponse, error)
+	GetOrganizations() ([]dto.OrganizationResponse, error)
+	GetUserOrganizations(userID string) ([]dto.OrganizationResponse, error)
+	GetOrganization(actor *utils.MyClaims, organizationID string) (dto.OrganizationResponse, error)
+	UpdateOrganization(actor *utils.MyClaims, organizationID string, req dto.OrganizationRequest) (dto.OrganizationResponse, error)
+	DeleteOrganization(actor *utils.MyClaims, organizationID string) error
+	GetRoles() ([]dto.OrganizationRoleResponse, error)
+
+	GetMembers(actor *utils.MyClaims, organizationID string) ([]dto.MemberResponse, error)
+	ChangeMemberRole(actor *utils.MyClaims, organizationID, userID, role string) error
+	// RemoveMember also lets members leave on their own.
+	RemoveMember(actor *utils.MyClaims, organizationID, userID string) error
+
+	Invite(actor *utils.MyClaims, organizationID string, req dto.InvitationRequest) (dto.InvitationResponse, error)
+	GetInvitations(actor *utils.MyClaims, organizationID string) ([]dto.InvitationResponse, error)
+	RevokeInvitation(actor *utils.MyClaims, organizationID string, invitationID int) error
+	// AcceptInvitation adds the user logged in with the invited address.
+	AcceptInvitation(actor *utils.MyClaims, token string) (dto.OrganizationResponse, error)
+}
+
+type organizationService struct {
+	logger           *zap.Logger
+	cfg              *config.Config
+	organizationRepo repository.OrganizationRepository
+	userRepo         repository.UserRepository
+	mailer           mailer.Mailer
+}
+
+func NewOrganizationService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	organizationRepo repository.OrganizationRepository,
+	userRepo repository.UserRepository,
+	mailer mailer.Mailer,
+) OrganizationService {
+	return &organizationService{
+		logger:           logger,
+		cfg:              cfg,
+		organizationRepo: organizationRepo,
+		userRepo:         userRepo,
+		mailer:           mailer,
+	}
+}
+
+func (s *organizationService) CreateOrganization(actor *utils.MyClaims, req dto.OrganizationRequest) (res dto.OrganizationResponse, err error) {
+	s.logger.Info("Create Organization",
+		zap.String("user_id", actor.ID),
+		zap.String("slug", req.Slug),
+	)
+
+	if !slugPattern.MatchString(req.Slug) {
+		return res, ErrInvalidSlug
+	}
+
+	owner, err := s.organizationRepo.GetOrganizationRoleByName(model.OrganizationRoleOwner)
+	if err != nil {
+		s.logger.Error("error getting owner role", zap.Error(err))
+		return res, err
+	}
+
+	organization := &model.Organization{Name: req.Name, Slug: req.Slug}
+	if err := s.organizationRepo.CreateOrganization(organization, actor.ID, owner.ID); err != nil {
+		if errors.Is(err, repository.ErrDuplicateSlug) {
+			return res, ErrSlugTaken
+		}
+		s.logger.Error("error creating organization", zap.Error(err))
+		return res, err
+	}
+
+	res = dto.NewOrganizationResponse(organization)
+	res.Role = owner.Name
+	return res, nil
+}
+
+func (s *organizationService) GetOrganizations() ([]dto.OrganizationResponse, error) {
+	organizations, err := s.organizationRepo.GetOrganizations()
+	if err != nil {
+		s.logger.Error("error getting organizations", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.OrganizationResponse, 0, len(organizations))
+	for _, organization := range organizations {
+		res = append(res, dto.NewOrganizationResponse(organization))
+	}
+	return res, nil
+}
+
+func (s *organizationService) GetUserOrganizations(userID string) ([]dto.OrganizationResponse, error) {
+	organizations, err := s.organizationRepo.GetOrganizationsByUserID(userID)
+	if err != nil {
+		s.logger.Error("error getting user organizations", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.OrganizationResponse, 0, len(organizations))
+	for _, organization := range organizations {
+		organizationRes := dto.NewOrganizationResponse(&organization.Organization)
+		organizationRes.Role = organization.RoleName
+		res = append(res, organizationRes)
+	}
+	return res, nil
+}
+
+func (s *organizationService) GetOrganization(actor *utils.MyClaims, organizationID string) (res dto.OrganizationResponse, err error) {
+	member, err := s.authorizeRead(actor, organizationID)
+	if err != nil {
+		return res, err
+	}
+
+	organization, err := s.getOrganization(organizationID)
+	if err != nil {
+		return res, err
+	}
+
+	res = dto.NewOrganizationResponse(organization)
+	if member != nil {
+		res.Role = member.RoleName
+	}
+	return res, nil
+}
+
+func (s *organizationService) UpdateOrganization(actor *utils.MyClaims, organizationID string, req dto.OrganizationRequest) (res dto.OrganizationResponse, err error) {
+	s.logger.Info("Update Organization",
+		zap.String("user_id", actor.ID),
+		zap.String("organization_id", organizationID),
+	)
+
+	if err := s.authorizeManage(actor, organizationID); err != nil {
+		return res, err
+	}
+
+	if !slugPattern.MatchString(req.Slug) {
+		return res, ErrInvalidSlug
+	}
+
+	organization, err := s.getOrganization(organizationID)
+	if err != nil {
+		return res, err
+	}
+
+	organization.Name = req.Name
+	organization.Slug = req.Slug
+	if err := s.organizationRepo.UpdateOrganization(organization); err != nil {
+		if errors.Is(err, repository.ErrDuplicateSlug) {
+			return res, ErrSlugTaken
+		}
+		s.logger.Error("error updating organization", zap.Error(err))
+		return res, err
+	}
+
+	return dto.NewOrganizationResponse(organization), nil
+}
+
+// DeleteOrganization is limited to owners since it deletes the
+// organization's catalogue as well.
+func (s *organizationService) DeleteOrganization(actor *utils.MyClaims, organizationID string) error {
+	s.logger.Info("Delete Organization",
+		zap.String("user_id", actor.ID),
+		zap.String("organization_id", organizationID),
+	)
+
+	if !actor.HasPermission(organizationWritePermission) {
+		member, err := s.member(organizationID, actor.ID)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return ErrOrganizationNotFound
+		}
+		if member.RoleName != model.OrganizationRoleOwner {
+			return ErrOrganizationForbidden
+		}
+	}
+
+	if err := s.organizationRepo.DeleteOrganization(organizationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrganizationNotFound
+		}
+		s.logger.Error("error deleting organization", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *organizationService) GetRoles() ([]dto.OrganizationRoleResponse, error) {
+	roles, err := s.organizationRepo.GetOrganizationRoles()
+	if err != nil {
+		s.logger.Error("error getting organization roles", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.OrganizationRoleResponse, 0, len(roles))
+	for _, role := range roles {
+		permissions, err := s.organizationRepo.GetOrganizationRolePermissions(role.ID)
+		if err != nil {
+			s.logger.Error("error getting organization role permissions", zap.Error(err))
+			return nil, err
+		}
+		res = append(res, dto.OrganizationRoleResponse{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissions,
+		})
+	}
+	return res, nil
+}
+
+func (s *organizationService) GetMembers(actor *utils.MyClaims, organizationID string) ([]dto.MemberResponse, error) {
+	if _, err := s.authorizeRead(actor, organizationID); err != nil {
+		return nil, err
+	}
+
+	members, err := s.organizationRepo.GetMembers(organizationID)
+	if err != nil {
+		s.logger.Error("error getting members", zap.Error(err))
+		return nil, err
+	}
+
+	res := make([]dto.MemberResponse, 0, len(members))
+	for _, member := range members {
+		res = append(res, dto.NewMemberResponse(member))
+	}
+	return res, nil
+}
+
+func (s *organizationService) ChangeMemberRole(actor *utils.MyClaims, organizationID, userID, roleName string) error {
+	s.logger.Info("Change Member Role",
+		zap.String("actor_id", actor.ID),
+		zap.String("organization_id", organizationID),
+		zap.String("user_id", userID),
+		zap.String("role", roleName),
+	)
+
+	if err := s.authorizeManage(actor, organizationID); err != nil {
+		return err
+	}
+
+	role, err := s.role(roleName)
+	if err != nil {
+		return err
+	}
+
+	member, err := s.member(organizationID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrMemberNotFound
+	}
+
+	if member.RoleName == model.OrganizationRoleOwner && role.Name != model.OrganizationRoleOwner {
+		if err := s.keepOwner(organizationID, member.RoleID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.organizationRepo.UpdateMemberRole(organizationID, userID, role.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		s.logger.Error("error updating member role", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *organizationService) RemoveMember(actor *utils.MyClaims, organizationID, userID string) error {
+	s.logger.Info("Remove Member",
+		zap.String("actor_id", actor.ID),
+		zap.String("organization_id", organizationID),
+		zap.String("user_id", userID),
+	)
+
+	if actor.ID != userID {
+		if err := s.authorizeManage(actor, organizationID); err != nil {
+			return err
+		}
+	}
+
+	member, err := s.member(organizationID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrMemberNotFound
+	}
+
+	if member.RoleName == model.OrganizationRoleOwner {
+		if err := s.keepOwner(organizationID, member.RoleID); err != nil {
+			return err
+		}
+	}
+
+	// tokens issued for the organization keep their permissions until they
+	// expire, refreshing them drops the organization
+	if err := s.organizationRepo.RemoveMember(organizationID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		s.logger.Error("error removing member", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *organizationService) Invite(actor *utils.MyClaims, organizationID string, req dto.InvitationRequest) (res dto.InvitationResponse, err error) {
+	s.logger.Info("Invite Member",
+		zap.String("actor_id", actor.ID),
+		zap.String("organization_id", organizationID),
+		zap.String("email", req.Email),
+	)
+
+	if err := s.authorizeManage(actor, organizationID); err != nil {
+		return res, err
+	}
+
+	organization, err := s.getOrganization(organizationID)
+	if err != nil {
+		return res, err
+	}
+
+	role, err := s.role(req.Role)
+	if err != nil {
+		return res, err
+	}
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		return res, err
+	}
+
+	invitation := &model.OrganizationInvitation{
+		OrganizationID: organizationID,
+		Email:          req.Email,
+		RoleID:         role.ID,
+		TokenHash:      utils.HashToken(token),
+		InvitedBy:      sql.NullString{String: actor.ID, Valid: true},
+		ExpiresAt:      time.Now().Add(s.cfg.Auth.OrganizationInvitationExp),
+	}
+	if err := s.organizationRepo.CreateInvitation(invitation); err != nil {
+		s.logger.Error("error creating invitation", zap.Error(err))
+		return res, err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", s.cfg.Auth.OrganizationInvitationURL, url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      req.Email,
+		Subject: fmt.Sprintf("You are invited to join %s", organization.Name),
+		Body: fmt.Sprintf(
+			"Hi,\n\n%s invited you to join %s as %s. Log in or sign up with this email address and open the link below to accept:\n\n%s\n\nThe invitation expires in %s.\n",
+			actor.Name, organization.Name, role.Name, link, s.cfg.Auth.OrganizationInvitationExp,
+		),
+	}
+	go func() {
+		if err := s.mailer.Send(msg); err != nil {
+			s.logger.Error("error sending mail", zap.Error(err), zap.String("subject", msg.Subject))
+		}
+	}()
+
+	return dto.InvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      role.Name,
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}, nil
+}
+
+func (s *organizationService) GetInvitations(actor *utils.MyClaims, organizationID string) ([]dto.InvitationResponse, error) {
+	if err := s.authorizeManage(actor, organizationID); err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.organizationRepo.GetPendingInvitations(organizationID, time.Now())
+	if err != nil {
+		s.logger.Error("error getting invitations", zap.Error(err))
+		return nil, err
+	}
+
+	roles, err := s.organizationRepo.GetOrganizationRoles()
+	if err != nil {
+		s.logger.Error("error getting organization roles", zap.Error(err))
+		return nil, err
+	}
+	roleNames := make(map[int]string, len(roles))
+	for _, role := range roles {
+		roleNames[role.ID] = role.Name
+	}
+
+	res := make([]dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		res = append(res, dto.InvitationResponse{
+			ID:        invitation.ID,
+			Email:     invitation.Email,
+			Role:      roleNames[invitation.RoleID],
+			ExpiresAt: invitation.ExpiresAt,
+			CreatedAt: invitation.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+func (s *organizationService) RevokeInvitation(actor *utils.MyClaims, organizationID string, invitationID int) error {
+	s.logger.Info("Revoke Invitation",
+		zap.String("actor_id", actor.ID),
+		zap.String("organization_id", organizationID),
+		zap.Int("invitation_id", invitationID),
+	)
+
+	if err := s.authorizeManage(actor, organizationID); err != nil {
+		return err
+	}
+
+	if err := s.organizationRepo.DeleteInvitation(organizationID, invitationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvitationNotFound
+		}
+		s.logger.Error("error deleting invitation", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *organizationService) AcceptInvitation(actor *utils.MyClaims, token string) (res dto.OrganizationResponse, err error) {
+	now := time.Now()
+	invitation, err := s.organizationRepo.GetPendingInvitationByToken(utils.HashToken(token), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, ErrInvitationNotFound
+		}
+		s.logger.Error("error getting invitation", zap.Error(err))
+		return res, err
+	}
+
+	s.logger.Info("Accept Invitation",
+		zap.String("user_id", actor.ID),
+		zap.String("organization_id", invitation.OrganizationID),
+	)
+
+	// the email in the token is stale after an email change
+	user, err := s.userRepo.GetUserByID(actor.ID)
+	if err != nil {
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return res, err
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return res, ErrInvitationEmailMismatch
+	}
+
+	if err := s.organizationRepo.AddMember(invitation.OrganizationID, user.ID, invitation.RoleID); err != nil {
+		if errors.Is(err, repository.ErrDuplicateMembership) {
+			return res, ErrAlreadyMember
+		}
+		s.logger.Error("error adding member", zap.Error(err))
+		return res, err
+	}
+
+	if err := s.organizationRepo.AcceptInvitation(invitation.ID, now); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error accepting invitation", zap.Error(err))
+		return res, err
+	}
+
+	organization, err := s.getOrganization(invitation.OrganizationID)
+	if err != nil {
+		return res, err
+	}
+	member, err := s.member(invitation.OrganizationID, user.ID)
+	if err != nil {
+		return res, err
+	}
+
+	res = dto.NewOrganizationResponse(organization)
+	if member != nil {
+		res.Role = member.RoleName
+	}
+	return res, nil
+}
+
+// authorizeRead lets members and holders of organization:read see the
+// organization. The membership is nil for the latter.
+func (s *organizationService) authorizeRead(actor *utils.MyClaims, organizationID string) (*model.OrganizationMember, error) {
+	member, err := s.member(organizationID, actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil && !actor.HasPermission(organizationReadPermission) {
+		return nil, ErrOrganizationNotFound
+	}
+	return member, nil
+}
+
+func (s *organizationService) authorizeManage(actor *utils.MyClaims, organizationID string) error {
+	if actor.HasPermission(organizationWritePermission) {
+		return nil
+	}
+
+	member, err := s.member(organizationID, actor.ID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrOrganizationNotFound
+	}
+
+	permissions, err := s.organizationRepo.GetOrganizationRolePermissions(member.RoleID)
+	if err != nil {
+		s.logger.Error("error getting organization role permissions", zap.Error(err))
+		return err
+	}
+	if !slices.Contains(permissions, memberWritePermission) {
+		return ErrOrganizationForbidden
+	}
+	return nil
+}
+
+// member returns nil when the user is not a member of the organization.
+func (s *organizationService) member(organizationID, userID string) (*model.OrganizationMember, error) {
+	member, err := s.organizationRepo.GetMember(organizationID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		s.logger.Error("error getting member", zap.Error(err))
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *organizationService) getOrganization(organizationID string) (*model.Organization, error) {
+	organization, err := s.organizationRepo.GetOrganization(organizationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		s.logger.Error("error getting organization", zap.Error(err))
+		return nil, err
+	}
+	return organization, nil
+}
+
+func (s *organizationService) role(name string) (*model.OrganizationRole, error) {
+	role, err := s.organizationRepo.GetOrganizationRoleByName(name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationRoleNotFound
+		}
+		s.logger.Error("error getting organization role", zap.Error(err))
+		return nil, err
+	}
+	return role, nil
+}
+
+// keepOwner fails when the organization has no owner besides the one about
+// to lose the role.
+func (s *organizationService) keepOwner(organizationID string, ownerRoleID int) error {
+	owners, err := s.organizationRepo.CountMembersWithRole(organizationID, ownerRoleID)
+	if err != nil {
+		s.logger.Error("error counting owners", zap.Error(err))
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
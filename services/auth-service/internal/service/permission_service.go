@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
+type PermissionService interface {
+	GetAllPermissions() ([]*model.Permission, error)
+	GetPermissionsByRoleID(roleID int) ([]*model.Permission, error)
+	CreatePermission(name, description string) error
+	SetRolePermissions(roleID int, permissionIDs []int) error
+}
+
+type permissionService struct {
+	logger         *zap.Logger
+	permissionRepo repository.PermissionRepository
+	roleRepo       repository.RoleRepository
+}
+
+func NewPermissionService(logger *zap.Logger, permissionRepo repository.PermissionRepository, roleRepo repository.RoleRepository) PermissionService {
+	return &permissionService{
+		logger:         logger,
+		permissionRepo: permissionRepo,
+		roleRepo:       roleRepo,
+	}
+}
+
+func (s *permissionService) GetAllPermissions() ([]*model.Permission, error) {
+	permissions, err := s.permissionRepo.GetAllPermissions()
+	if err != nil {
+		s.logger.Error("error getting all permissions", zap.Error(err))
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (s *permissionService) GetPermissionsByRoleID(roleID int) ([]*model.Permission, error) {
+	if _, err := s.roleRepo.GetRoleByID(roleID); err != nil {
+		s.logger.Error("error getting role", zap.Error(err), zap.Int("role_id", roleID))
+		return nil, err
+	}
+
+	permissions, err := s.permissionRepo.GetPermissionsByRoleID(roleID)
+	if err != nil {
+		s.logger.Error("error getting role permissions", zap.Error(err), zap.Int("role_id", roleID))
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (s *permissionService) CreatePermission(name, description string) error {
+	s.logger.Info("Creating permission",
+		zap.String("permission_name", name),
+	)
+	if err := s.permissionRepo.CreatePermission(name, description); err != nil {
+		s.logger.Error("error creating permission", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *permissionService) SetRolePermissions(roleID int, permissionIDs []int) error {
+	s.logger.Info("Setting role permissions",
+		zap.Int("role_id", roleID),
+		zap.Ints("permission_ids", permissionIDs),
+	)
+	if _, err := s.roleRepo.GetRoleByID(roleID); err != nil {
+		s.logger.Error("error getting role", zap.Error(err), zap.Int("role_id", roleID))
+		return err
+	}
+
+	if err := s.permissionRepo.SetRolePermissions(roleID, permissionIDs); err != nil {
+		if errors.Is(err, repository.ErrUnknownPermission) {
+			return ErrUnknownPermission
+		}
+		s.logger.Error("error setting role permissions", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/mailer"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrNameTaken         = errors.New("name is already taken")
+	ErrEmailTaken        = errors.New("email is already taken")
+)
+
+// ProfileService lets users manage their own account: their profile,
+// password and sessions, and closing or erasing the account.
+type ProfileService interface {
+	UpdateProfile(accessToken string, req dto.UpdateProfileRequest) (dto.UserResponse, error)
+	GetSessions(accessToken string) ([]dto.SessionResponse, error)
+	// RevokeSession signs out one of the token user's sessions, which may
+	// be the current one.
+	RevokeSession(accessToken, sessionID string, client dto.ClientInfo) error
+	// ChangePassword keeps the session of accessToken and ends all others.
+	ChangePassword(accessToken, currentPassword, newPassword string) error
+	// DeleteAccount closes the account of the token's user. The account is
+	// soft-deleted so administrators can still restore it.
+	DeleteAccount(accessToken, password string) error
+	// RequestErasure closes the account and queues the erasure of the
+	// user's personal data, processed by DataRequestService.
+	RequestErasure(accessToken, password string) (dto.DataRequestResponse, error)
+}
+
+type profileService struct {
+	logger         *zap.Logger
+	cfg            *config.Config
+	userRepo       repository.UserRepository
+	roleRepo       repository.RoleRepository
+	userTokenRepo  repository.UserTokenRepository
+	denylist       utils.TokenDenylist
+	loginThrottle  LoginThrottle
+	sessions       SessionService
+	mail           AccountMailer
+	dataRequests   DataRequestService
+	passwordHasher utils.PasswordHasher
+	passwordPolicy utils.PasswordPolicy
+	audit          AuditService
+}
+
+func NewProfileService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	userTokenRepo repository.UserTokenRepository,
+	denylist utils.TokenDenylist,
+	loginThrottle LoginThrottle,
+	sessions SessionService,
+	mail AccountMailer,
+	dataRequests DataRequestService,
+	passwordHasher utils.PasswordHasher,
+	passwordPolicy utils.PasswordPolicy,
+	audit AuditService,
+) ProfileService {
+	return &profileService{
+		logger:         logger,
+		cfg:            cfg,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		userTokenRepo:  userTokenRepo,
+		denylist:       denylist,
+		loginThrottle:  loginThrottle,
+		sessions:       sessions,
+		mail:           mail,
+		dataRequests:   dataRequests,
+		passwordHasher: passwordHasher,
+		passwordPolicy: passwordPolicy,
+		audit:          audit,
+	}
+}
+
+func (s *profileService) UpdateProfile(accessToken string, req dto.UpdateProfileRequest) (res dto.UserResponse, err error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return res, err
+	}
+
+	s.logger.Info("Update Profile",
+		zap.String("user_id", claims.ID),
+	)
+
+	user, err := currentUser(s.logger, s.userRepo, claims)
+	if err != nil {
+		return res, err
+	}
+
+	// the email change is validated first so a rejected change does not
+	// leave the name changed either
+	changeEmail := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+	if changeEmail {
+		if err := s.checkEmailChange(user, *req.Email, req.CurrentPassword); err != nil {
+			return res, err
+		}
+	}
+
+	if req.Name != nil && *req.Name != user.Name {
+		if err := s.userRepo.UpdateName(user.ID, *req.Name); err != nil {
+			if errors.Is(err, repository.ErrDuplicateName) {
+				return res, ErrNameTaken
+			}
+			s.logger.Error("error updating name", zap.Error(err))
+			return res, err
+		}
+		user.Name = *req.Name
+	}
+
+	if changeEmail {
+		if err := s.requestEmailChange(user, *req.Email); err != nil {
+			return res, err
+		}
+	}
+
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+
+	return dto.NewUserResponse(user, role), nil
+}
+
+func (s *profileService) ChangePassword(accessToken, currentPassword, newPassword string) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Change Password",
+		zap.String("user_id", claims.ID),
+	)
+
+	user, err := currentUser(s.logger, s.userRepo, claims)
+	if err != nil {
+		return err
+	}
+
+	if err := s.passwordPolicy.Validate(newPassword); err != nil {
+		s.logger.Error("password rejected by policy", zap.Error(err))
+		return err
+	}
+
+	if err := s.checkCurrentPassword(user, currentPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(newPassword)
+	if err != nil {
+		s.logger.Error("error hashing password", zap.Error(err))
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		s.logger.Error("error updating password", zap.Error(err))
+		return err
+	}
+
+	// a pending reset link would let someone undo the change
+	if err := s.userTokenRepo.InvalidateTokens(user.ID, model.TokenPurposePasswordReset); err != nil {
+		s.logger.Error("error invalidating password reset tokens", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeOtherSessions(user.ID, claims.FamilyID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe password of your account was just changed and your other sessions were signed out. If this was not you, reset your password right away.\n",
+			user.Name,
+		),
+	})
+
+	return nil
+}
+
+func (s *profileService) DeleteAccount(accessToken, password string) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Delete Account",
+		zap.String("user_id", claims.ID),
+	)
+
+	user, err := currentUser(s.logger, s.userRepo, claims)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkCurrentPassword(user, password); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SoftDeleteUser(user.ID); err != nil {
+		s.logger.Error("error deleting user", zap.Error(err))
+		return err
+	}
+
+	if err := s.denylist.RevokeToken(claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("error revoking access token", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(user.ID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account was closed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account has been closed as requested. Contact support if you want it restored.\n",
+			user.Name,
+		),
+	})
+
+	return nil
+}
+
+func (s *profileService) GetSessions(accessToken string) ([]dto.SessionResponse, error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sessions.GetSessions(claims.ID, claims.FamilyID)
+}
+
+func (s *profileService) RevokeSession(accessToken, sessionID string, client dto.ClientInfo) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sessions.RevokeSession(claims.ID, sessionID); err != nil {
+		return err
+	}
+	s.audit.Record(model.AuditSessionRevoked, claims.ID, sessionID, client, nil)
+	return nil
+}
+
+func (s *profileService) RequestErasure(accessToken, password string) (res dto.DataRequestResponse, err error) {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return res, err
+	}
+
+	user, err := currentUser(s.logger, s.userRepo, claims)
+	if err != nil {
+		return res, err
+	}
+
+	if err := s.checkCurrentPassword(user, password); err != nil {
+		return res, err
+	}
+
+	res, err = s.dataRequests.RequestErasure(user, user.ID)
+	if err != nil {
+		return res, err
+	}
+
+	if err := s.denylist.RevokeToken(claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("error revoking access token", zap.Error(err))
+		return res, err
+	}
+
+	return res, nil
+}
+
+// checkEmailChange makes sure the user may change their address to email.
+func (s *profileService) checkEmailChange(user *model.User, email, currentPassword string) error {
+	if err := s.checkCurrentPassword(user, currentPassword); err != nil {
+		return err
+	}
+
+	_, err := s.userRepo.GetUserByEmail(email)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return err
+	}
+	return nil
+}
+
+// requestEmailChange stores the new address as pending and mails it a
+// confirmation link. The current address is told about the change.
+func (s *profileService) requestEmailChange(user *model.User, email string) error {
+	if err := s.userRepo.SetPendingEmail(user.ID, email); err != nil {
+		s.logger.Error("error setting pending email", zap.Error(err))
+		return err
+	}
+	user.PendingEmail = sql.NullString{String: email, Valid: true}
+
+	if err := s.userTokenRepo.InvalidateTokens(user.ID, model.TokenPurposeEmailChange); err != nil {
+		s.logger.Error("error invalidating email change tokens", zap.Error(err))
+		return err
+	}
+
+	token, err := s.mail.CreateToken(user.ID, model.TokenPurposeEmailChange, s.cfg.Auth.EmailVerificationExp)
+	if err != nil {
+		s.logger.Error("error creating email change token", zap.Error(err))
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", s.cfg.Auth.EmailVerificationURL, url.QueryEscape(token))
+	s.mail.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your new email address by opening the link below:\n\n%s\n\nThe link expires in %s. Until then you keep logging in with your current address.\n",
+			user.Name, link, s.cfg.Auth.EmailVerificationExp,
+		),
+	})
+	s.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA change of your account's email address to %s was requested. If this was not you, change your password right away.\n",
+			user.Name, email,
+		),
+	})
+
+	return nil
+}
+
+// checkCurrentPassword verifies a password re-entered by a logged in user.
+// Failures count towards the login lockout so a stolen access token cannot be
+// used to guess the password.
+func (s *profileService) checkCurrentPassword(user *model.User, password string) error {
+	if err := s.loginThrottle.Attempt(user.Email, ""); err != nil {
+		return err
+	}
+
+	if !s.passwordHasher.Verify(password, user.Password) {
+		s.logger.Error("incorrect current password", zap.String("user_id", user.ID))
+		if err := s.loginThrottle.RecordFailure(user.Email, ""); err != nil {
+			s.logger.Error("error recording login failure", zap.Error(err))
+			return err
+		}
+		return ErrIncorrectPassword
+	}
+
+	if err := s.loginThrottle.Release(user.Email, ""); err != nil {
+		s.logger.Error("error releasing login attempt", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
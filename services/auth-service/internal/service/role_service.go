@@ -1,32 +1,57 @@
 package service
 
 import (
+	"database/sql"
+	"errors"
+
 	"github.com/ecomz/backend/auth-service/internal/model"
 	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrRoleNotFound            = errors.New("role not found")
+	ErrRoleInUse               = errors.New("role is still assigned to users, pass reassign_to to move them to another role")
+	ErrInvalidReplacementRole  = errors.New("replacement role must be another existing role")
+	ErrDefaultRoleNotRemovable = errors.New("the default role cannot be renamed or deleted")
+)
+
 type RoleService interface {
 	GetRoleByID(roleID int) (*model.Role, error)
 	GetAllRoles() ([]*model.Role, error)
-	CreateRole(name string) error
-	DeleteRole(roleID int) error
+	CreateRole(name string, mfaRequired bool) error
+	UpdateRole(roleID int, name string, mfaRequired bool) error
+	// DeleteRole soft-deletes the role. Users holding it are moved to
+	// replacementRoleID and signed out, without one the role must be unused.
+	DeleteRole(roleID, replacementRoleID int) error
 }
 
 type roleService struct {
 	logger   *zap.Logger
+	cfg      *config.Config
 	roleRepo repository.RoleRepository
+	sessions SessionService
 }
 
-func NewRoleService(logger *zap.Logger, roleRepo repository.RoleRepository) RoleService {
-	return &roleService{logger: logger, roleRepo: roleRepo}
+func NewRoleService(logger *zap.Logger, cfg *config.Config, roleRepo repository.RoleRepository, sessions SessionService) RoleService {
+	return &roleService{logger: logger, cfg: cfg, roleRepo: roleRepo, sessions: sessions}
 }
 
 func (s *roleService) GetRoleByID(roleID int) (*model.Role, error) {
 	s.logger.Info("Getting role by ID",
 		zap.Int("role_id", roleID),
 	)
-	return s.roleRepo.GetRoleByID(roleID)
+
+	role, err := s.roleRepo.GetRoleByID(roleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		s.logger.Error("error getting role", zap.Error(err))
+		return nil, err
+	}
+	return role, nil
 }
 
 func (s *roleService) GetAllRoles() ([]*model.Role, error) {
@@ -38,11 +63,12 @@ func (s *roleService) GetAllRoles() ([]*model.Role, error) {
 	return roles, nil
 }
 
-func (s *roleService) CreateRole(name string) error {
+func (s *roleService) CreateRole(name string, mfaRequired bool) error {
 	s.logger.Info("Creating role",
 		zap.String("role_name", name),
+		zap.Bool("mfa_required", mfaRequired),
 	)
-	if err := s.roleRepo.CreateRole(name); err != nil {
+	if err := s.roleRepo.CreateRole(name, mfaRequired); err != nil {
 		s.logger.Error("error creating role", zap.Error(err))
 		return err
 	}
@@ -50,9 +76,75 @@ func (s *roleService) CreateRole(name string) error {
 	return nil
 }
 
-func (s *roleService) DeleteRole(roleID int) error {
+func (s *roleService) UpdateRole(roleID int, name string, mfaRequired bool) error {
+	s.logger.Info("Updating role",
+		zap.Int("role_id", roleID),
+		zap.String("role_name", name),
+		zap.Bool("mfa_required", mfaRequired),
+	)
+
+	role, err := s.GetRoleByID(roleID)
+	if err != nil {
+		return err
+	}
+
+	// new users are assigned the default role by name
+	if role.Name == s.cfg.Auth.DefaultRole && name != role.Name {
+		return ErrDefaultRoleNotRemovable
+	}
+
+	role.Name = name
+	role.MFARequired = mfaRequired
+	if err := s.roleRepo.UpdateRole(role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		s.logger.Error("error updating role", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *roleService) DeleteRole(roleID, replacementRoleID int) error {
 	s.logger.Info("Deleting role",
 		zap.Int("role_id", roleID),
+		zap.Int("replacement_role_id", replacementRoleID),
 	)
-	return s.roleRepo.DeleteRole(roleID)
+
+	role, err := s.GetRoleByID(roleID)
+	if err != nil {
+		return err
+	}
+
+	if role.Name == s.cfg.Auth.DefaultRole {
+		return ErrDefaultRoleNotRemovable
+	}
+
+	if replacementRoleID == roleID {
+		return ErrInvalidReplacementRole
+	}
+
+	movedUserIDs, err := s.roleRepo.DeleteRole(roleID, replacementRoleID)
+	switch {
+	case err == nil:
+		// their access tokens still carry the deleted role, as after
+		// UserAdminService.ChangeUserRole
+		for _, userID := range movedUserIDs {
+			if err := s.sessions.RevokeAllSessions(userID); err != nil {
+				s.logger.Error("error revoking refresh token families", zap.Error(err), zap.String("user_id", userID))
+				return err
+			}
+		}
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrRoleNotFound
+	case errors.Is(err, repository.ErrRoleInUse):
+		return ErrRoleInUse
+	case errors.Is(err, repository.ErrReplacementRoleNotFound):
+		return ErrInvalidReplacementRole
+	}
+
+	s.logger.Error("error deleting role", zap.Error(err))
+	return err
 }
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"github.com/ecomz/backend/libs/config"
+	"github.com/ecomz/backend/libs/utils"
+	"go.uber.org/zap"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService starts, refreshes and ends the sessions of users. A session
+// is a refresh token family, the services logging users in or managing their
+// accounts share it.
+type SessionService interface {
+	// CompleteLogin starts the session of a user who passed authentication
+	// with method.
+	CompleteLogin(user *model.User, method string, client dto.ClientInfo) (dto.LoginAndRegisiterResponse, error)
+	// StartSession opens a new session and issues its first token pair.
+	StartSession(user *model.User, role *model.Role, client dto.ClientInfo) (accessToken, refreshToken string, err error)
+	// MFAChallenge returns the challenge a user with MFA completes through
+	// UserService.VerifyMFALogin.
+	MFAChallenge(user *model.User) (*dto.MFAChallengeResponse, error)
+	// Refresh switches the organization the session acts for when
+	// organizationID is not nil.
+	Refresh(refreshToken string, organizationID *string, client dto.ClientInfo) (dto.LoginAndRegisiterResponse, error)
+	// VerifyAccessToken validates an access token and makes sure it has not
+	// been revoked through logout.
+	VerifyAccessToken(accessToken string) (*utils.MyClaims, error)
+	// VerifyAccountToken is VerifyAccessToken for the account endpoints,
+	// which an administrator impersonating the user may not use.
+	VerifyAccountToken(accessToken string) (*utils.MyClaims, error)
+	// GetSessions lists the active sessions of the user, flagging currentID.
+	GetSessions(userID, currentID string) ([]dto.SessionResponse, error)
+	RevokeSession(userID, sessionID string) error
+	// RevokeFamily ends a single login without checking it is still active.
+	RevokeFamily(userID, familyID string) error
+	RevokeAllSessions(userID string) error
+	// RevokeOtherSessions ends every session of the user but currentID.
+	RevokeOtherSessions(userID, currentID string) error
+}
+
+type sessionService struct {
+	logger           *zap.Logger
+	cfg              *config.Config
+	userRepo         repository.UserRepository
+	roleRepo         repository.RoleRepository
+	permissionRepo   repository.PermissionRepository
+	sessionRepo      repository.SessionRepository
+	organizationRepo repository.OrganizationRepository
+	keyService       KeyService
+	denylist         utils.TokenDenylist
+	activity         utils.SessionActivity
+	mfaService       MFAService
+	audit            AuditService
+}
+
+func NewSessionService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	sessionRepo repository.SessionRepository,
+	organizationRepo repository.OrganizationRepository,
+	keyService KeyService,
+	denylist utils.TokenDenylist,
+	activity utils.SessionActivity,
+	mfaService MFAService,
+	audit AuditService,
+) SessionService {
+	return &sessionService{
+		logger:           logger,
+		cfg:              cfg,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		permissionRepo:   permissionRepo,
+		sessionRepo:      sessionRepo,
+		organizationRepo: organizationRepo,
+		keyService:       keyService,
+		denylist:         denylist,
+		activity:         activity,
+		mfaService:       mfaService,
+		audit:            audit,
+	}
+}
+
+func (s *sessionService) CompleteLogin(user *model.User, method string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error) {
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+
+	accessToken, refreshToken, err := s.StartSession(user, role, client)
+	if err != nil {
+		s.logger.Error("error generating tokens", zap.Error(err))
+		return res, err
+	}
+	s.audit.Record(model.AuditLoginSucceeded, user.ID, user.ID, client, map[string]string{"method": method})
+
+	return dto.NewLoginResponse(user, role, accessToken, refreshToken), nil
+}
+
+// StartSession opens a new refresh token family for the user, records it as
+// a session of the client and issues the first token pair of that family.
+func (s *sessionService) StartSession(user *model.User, role *model.Role, client dto.ClientInfo) (accessToken, refreshToken string, err error) {
+	familyID, err := utils.RandomString(16)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token family: %w", err)
+	}
+
+	family := &model.RefreshFamily{
+		ID:         familyID,
+		UserID:     user.ID,
+		Generation: 0,
+	}
+	if err := s.userRepo.CreateRefreshFamily(family, s.cfg.JWT.RefreshExp); err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token family: %w", err)
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		ID:        family.ID,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.JWT.RefreshExp),
+	}
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		return "", "", fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return s.generateTokens(user, role, nil, family.ID, family.Generation)
+}
+
+func (s *sessionService) MFAChallenge(user *model.User) (*dto.MFAChallengeResponse, error) {
+	claims := utils.NewClaims(
+		user.ID,
+		user.Name,
+		user.Email,
+		s.cfg.App.Name,
+		utils.MFAChallengeToken,
+		time.Now().Add(s.cfg.Auth.MFAChallengeExp),
+	)
+
+	token, err := s.keyService.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(s.cfg.Auth.MFAChallengeExp.Seconds()),
+	}, nil
+}
+
+func (s *sessionService) Refresh(refreshToken string, switchOrganization *string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error) {
+	claims, err := s.keyService.Verify(refreshToken)
+	if err != nil {
+		s.logger.Error("error parsing refresh token", zap.Error(err))
+		return res, err
+	}
+
+	if claims.TokenType != utils.RefreshToken || claims.FamilyID == "" {
+		s.logger.Error("token is not a refresh token", zap.String("email", claims.Email))
+		return res, fmt.Errorf("invalid refresh token")
+	}
+
+	s.logger.Info("Refresh Token",
+		zap.String("user_id", claims.ID),
+		zap.String("family_id", claims.FamilyID),
+		zap.Int("generation", claims.Generation),
+	)
+
+	// checked before rotating so a refused switch keeps the token usable
+	organizationID := ""
+	if switchOrganization != nil {
+		organizationID = *switchOrganization
+	} else if session, err := s.sessionRepo.GetActiveSession(claims.ID, claims.FamilyID, time.Now()); err == nil {
+		organizationID = session.OrganizationID.String
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting session", zap.Error(err))
+		return res, err
+	}
+
+	member, err := s.organizationMember(organizationID, claims.ID)
+	if err != nil {
+		return res, err
+	}
+	if member == nil && switchOrganization != nil && organizationID != "" {
+		return res, ErrNotOrganizationMember
+	}
+
+	err = s.userRepo.RotateRefreshFamily(claims.FamilyID, claims.Generation, s.cfg.JWT.RefreshExp)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			s.logger.Warn("refresh token reuse detected, family revoked",
+				zap.String("user_id", claims.ID),
+				zap.String("family_id", claims.FamilyID),
+			)
+			if err := s.RevokeFamily(claims.ID, claims.FamilyID); err != nil {
+				s.logger.Error("error revoking refresh token family", zap.Error(err))
+			}
+			s.audit.Record(model.AuditRefreshTokenReuse, "", claims.FamilyID, client, map[string]string{
+				"user_id":    claims.ID,
+				"generation": strconv.Itoa(claims.Generation),
+			})
+			return res, fmt.Errorf("refresh token has been revoked")
+		case errors.Is(err, repository.ErrRefreshFamilyNotFound):
+			s.logger.Error("refresh token family not found", zap.String("family_id", claims.FamilyID))
+			return res, fmt.Errorf("refresh token has been revoked")
+		}
+		s.logger.Error("error rotating refresh token", zap.Error(err))
+		return res, err
+	}
+
+	user, err := s.userRepo.GetUserByID(claims.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("user not found", zap.String("user_id", claims.ID))
+			return res, fmt.Errorf("user not found")
+		}
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", claims.ID))
+		return res, err
+	}
+
+	if s.cfg.Auth.RequireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		s.logger.Error("refresh with unverified email", zap.String("user_id", user.ID))
+		return res, ErrEmailNotVerified
+	}
+
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+
+	accessToken, newRefreshToken, err := s.generateTokens(user, role, member, claims.FamilyID, claims.Generation+1)
+	if err != nil {
+		s.logger.Error("error generating tokens", zap.Error(err))
+		return res, err
+	}
+
+	now := time.Now()
+	if err := s.sessionRepo.TouchSession(claims.FamilyID, client.IP, now, now.Add(s.cfg.JWT.RefreshExp)); err != nil {
+		s.logger.Error("error updating session", zap.Error(err))
+		return res, err
+	}
+	// a session whose user left the organization falls back to none
+	if member == nil && organizationID != "" {
+		organizationID = ""
+		switchOrganization = &organizationID
+	}
+	if switchOrganization != nil {
+		if err := s.sessionRepo.SetSessionOrganization(claims.FamilyID, organizationID); err != nil {
+			s.logger.Error("error switching session organization", zap.Error(err))
+			return res, err
+		}
+	}
+	if err := s.activity.Touch(claims.FamilyID, now); err != nil {
+		s.logger.Warn("error recording session activity", zap.Error(err))
+	}
+
+	return dto.NewLoginResponse(user, role, accessToken, newRefreshToken), nil
+}
+
+func (s *sessionService) VerifyAccessToken(accessToken string) (*utils.MyClaims, error) {
+	claims, err := s.keyService.Verify(accessToken)
+	if err != nil {
+		s.logger.Error("error parsing token", zap.Error(err))
+		return nil, err
+	}
+
+	if !claims.IsAccessToken() {
+		s.logger.Error("token is not an access token",
+			zap.String("email", claims.Email),
+			zap.String("token_type", claims.TokenType),
+		)
+		return nil, utils.ErrInvalidToken
+	}
+
+	// tokens of OAuth clients are for resource APIs, not for managing the
+	// user's account
+	if claims.ClientID != "" {
+		s.logger.Error("oauth client token used for account endpoint", zap.String("client_id", claims.ClientID))
+		return nil, utils.ErrInvalidToken
+	}
+
+	revoked, err := s.denylist.IsRevoked(claims)
+	if err != nil {
+		s.logger.Error("error checking token denylist", zap.Error(err))
+		return nil, err
+	}
+	if revoked {
+		s.logger.Error("revoked token used", zap.String("jti", claims.RegisteredClaims.ID))
+		return nil, utils.ErrTokenRevoked
+	}
+
+	if err := s.activity.Touch(claims.FamilyID, time.Now()); err != nil {
+		s.logger.Warn("error recording session activity", zap.Error(err))
+	}
+
+	return claims, nil
+}
+
+func (s *sessionService) VerifyAccountToken(accessToken string) (*utils.MyClaims, error) {
+	claims, err := s.VerifyAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsImpersonated() {
+		s.logger.Error("impersonation token used for account endpoint",
+			zap.String("user_id", claims.ID),
+			zap.String("actor_id", claims.Act.ID),
+		)
+		return nil, ErrImpersonationSession
+	}
+
+	return claims, nil
+}
+
+func (s *sessionService) GetSessions(userID, currentID string) ([]dto.SessionResponse, error) {
+	sessions, err := s.sessionRepo.GetActiveSessions(userID, time.Now())
+	if err != nil {
+		s.logger.Error("error getting sessions", zap.Error(err))
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	// requests seen by the authenticators are more recent than the last
+	// refresh stored with the session
+	lastSeen, err := s.activity.LastSeen(ids)
+	if err != nil {
+		s.logger.Warn("error getting session activity", zap.Error(err))
+		lastSeen = nil
+	}
+
+	res := make([]dto.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		lastSeenAt := session.LastSeenAt
+		if seen, ok := lastSeen[session.ID]; ok && seen.After(lastSeenAt) {
+			lastSeenAt = seen
+		}
+		res = append(res, dto.NewSessionResponse(session, lastSeenAt, session.ID == currentID))
+	}
+	return res, nil
+}
+
+func (s *sessionService) RevokeSession(userID, sessionID string) error {
+	s.logger.Info("Revoke Session",
+		zap.String("user_id", userID),
+		zap.String("session_id", sessionID),
+	)
+
+	if _, err := s.sessionRepo.GetActiveSession(userID, sessionID, time.Now()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		s.logger.Error("error getting session", zap.Error(err))
+		return err
+	}
+
+	if err := s.RevokeFamily(userID, sessionID); err != nil {
+		s.logger.Error("error revoking refresh token family", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RevokeFamily ends a single login: its refresh tokens can no longer be
+// rotated and its outstanding access tokens are denied.
+func (s *sessionService) RevokeFamily(userID, familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+
+	if err := s.userRepo.DeleteRefreshFamily(familyID); err != nil {
+		return err
+	}
+
+	if err := s.sessionRepo.RevokeSession(familyID, time.Now()); err != nil {
+		return err
+	}
+
+	return s.denylist.RevokeFamily(familyID, s.cfg.JWT.LoginExp)
+}
+
+func (s *sessionService) RevokeAllSessions(userID string) error {
+	return s.RevokeOtherSessions(userID, "")
+}
+
+func (s *sessionService) RevokeOtherSessions(userID, currentID string) error {
+	// every refresh family is recorded as a session that expires with it
+	sessions, err := s.sessionRepo.GetActiveSessions(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentID {
+			continue
+		}
+		if err := s.RevokeFamily(userID, session.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateTokens adds the permissions member has in its organization to the
+// access token when member is not nil.
+func (s *sessionService) generateTokens(user *model.User, role *model.Role, member *model.OrganizationMember, familyID string, generation int) (accessToken, refreshToken string, err error) {
+	s.logger.Info("Generate Tokens for User",
+		zap.String("email", user.Email),
+	)
+
+	permissions, err := grantedPermissions(s.cfg, s.permissionRepo, s.mfaService, user, role)
+	if err != nil {
+		s.logger.Error("error getting granted permissions", zap.Error(err))
+		return "", "", err
+	}
+
+	claimsAccessToken := utils.NewClaims(
+		user.ID,
+		user.Name,
+		user.Email,
+		s.cfg.App.Name,
+		utils.AccessToken,
+		time.Now().Add(s.cfg.JWT.LoginExp),
+	)
+	claimsAccessToken.FamilyID = familyID
+	claimsAccessToken.Role = role.Name
+	claimsAccessToken.EmailVerified = user.EmailVerifiedAt.Valid
+	claimsAccessToken.Permissions = permissions
+	if member != nil {
+		organizationPermissions, err := s.organizationRepo.GetOrganizationRolePermissions(member.RoleID)
+		if err != nil {
+			s.logger.Error("error getting organization role permissions", zap.Error(err))
+			return "", "", err
+		}
+		claimsAccessToken.OrgID = member.OrganizationID
+		claimsAccessToken.OrgRole = member.RoleName
+		claimsAccessToken.OrgPermissions = slices.DeleteFunc(organizationPermissions, func(permission string) bool {
+			return !user.EmailVerifiedAt.Valid && slices.Contains(s.cfg.Auth.VerifiedEmailPermissions, permission)
+		})
+	}
+	accessToken, err = s.keyService.Sign(claimsAccessToken)
+	if err != nil {
+		s.logger.Error("error generating access token", zap.Error(err))
+		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	claimsRefreshToken := utils.NewClaims(
+		user.ID,
+		user.Name,
+		user.Email,
+		s.cfg.App.Name,
+		utils.RefreshToken,
+		time.Now().Add(s.cfg.JWT.RefreshExp),
+	)
+	claimsRefreshToken.FamilyID = familyID
+	claimsRefreshToken.Generation = generation
+	refreshToken, err = s.keyService.Sign(claimsRefreshToken)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// organizationMember returns nil when organizationID is empty or the user
+// is not a member of it.
+func (s *sessionService) organizationMember(organizationID, userID string) (*model.OrganizationMember, error) {
+	if organizationID == "" {
+		return nil, nil
+	}
+
+	member, err := s.organizationRepo.GetMember(organizationID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		s.logger.Error("error getting organization member", zap.Error(err))
+		return nil, err
+	}
+	return member, nil
+}
+
+// grantedPermissions returns the permissions of the user's role that are in
+// effect right now. Roles requiring MFA grant nothing until the user has
+// enrolled, the token is still good for enrolling. Some permissions need a
+// verified email.
+func grantedPermissions(cfg *config.Config, permissionRepo repository.PermissionRepository, mfaService MFAService, user *model.User, role *model.Role) ([]string, error) {
+	permissions, err := permissionRepo.GetPermissionsByRoleID(role.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	if role.MFARequired {
+		mfaEnabled, err := mfaService.IsEnabled(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mfa status: %w", err)
+		}
+		if !mfaEnabled {
+			return nil, nil
+		}
+	}
+
+	var granted []string
+	for _, permission := range permissions {
+		if !user.EmailVerifiedAt.Valid && slices.Contains(cfg.Auth.VerifiedEmailPermissions, permission.Name) {
+			continue
+		}
+		granted = append(granted, permission.Name)
+	}
+	return granted, nil
+}
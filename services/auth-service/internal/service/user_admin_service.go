@@ -0,0 +1,291 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ecomz/backend/auth-service/internal/dto"
+	"github.com/ecomz/backend/auth-service/internal/model"
+	"github.com/ecomz/backend/auth-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrCannotModifySelf = errors.New("administrators cannot change their own role or delete their own account")
+)
+
+// UserAdminService lets administrators manage the accounts of other users.
+// actorID is the administrator performing the change.
+type UserAdminService interface {
+	ListUsers(query dto.UserListQuery) (dto.UserListResponse, error)
+	GetUser(userID string) (dto.AdminUserResponse, error)
+	// ChangeUserRole moves the user to another role and ends their sessions
+	// so the new permissions apply right away.
+	ChangeUserRole(actorID, userID string, roleID int) error
+	// DeleteUser soft-deletes the user and ends their sessions.
+	DeleteUser(actorID, userID string) error
+	// EraseUser is ProfileService.RequestErasure for administrators acting
+	// on a request the user made elsewhere. Soft-deleted users can be
+	// erased as well.
+	EraseUser(actorID, userID string) (dto.DataRequestResponse, error)
+	RestoreUser(userID string) error
+	// ForcePasswordReset blocks login with the current password, ends all
+	// sessions and mails the user a reset link.
+	ForcePasswordReset(userID string) error
+	GetUserSessions(userID string) ([]dto.SessionResponse, error)
+	RevokeUserSession(userID, sessionID string) error
+	RevokeUserSessions(userID string) error
+}
+
+type userAdminService struct {
+	logger       *zap.Logger
+	userRepo     repository.UserRepository
+	roleRepo     repository.RoleRepository
+	sessions     SessionService
+	mail         AccountMailer
+	dataRequests DataRequestService
+}
+
+func NewUserAdminService(
+	logger *zap.Logger,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	sessions SessionService,
+	mail AccountMailer,
+	dataRequests DataRequestService,
+) UserAdminService {
+	return &userAdminService{
+		logger:       logger,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		sessions:     sessions,
+		mail:         mail,
+		dataRequests: dataRequests,
+	}
+}
+
+func (s *userAdminService) ListUsers(query dto.UserListQuery) (res dto.UserListResponse, err error) {
+	filter := model.UserFilter{
+		Search: query.Search,
+		RoleID: query.RoleID,
+		Status: query.Status,
+	}
+
+	total, err := s.userRepo.CountUsers(filter)
+	if err != nil {
+		s.logger.Error("error counting users", zap.Error(err))
+		return res, err
+	}
+
+	users, err := s.userRepo.GetUsers(filter, query.Limit, (query.Page-1)*query.Limit)
+	if err != nil {
+		s.logger.Error("error getting users", zap.Error(err))
+		return res, err
+	}
+
+	roles, err := s.roleRepo.GetAllRoles()
+	if err != nil {
+		s.logger.Error("error getting roles", zap.Error(err))
+		return res, err
+	}
+	rolesByID := make(map[int]*model.Role, len(roles))
+	for _, role := range roles {
+		rolesByID[role.ID] = role
+	}
+
+	res = dto.UserListResponse{
+		Users: make([]dto.AdminUserResponse, 0, len(users)),
+		Page:  query.Page,
+		Limit: query.Limit,
+		Total: total,
+	}
+	for _, user := range users {
+		role, ok := rolesByID[user.RoleID]
+		if !ok {
+			role = &model.Role{ID: user.RoleID}
+		}
+		res.Users = append(res.Users, dto.NewAdminUserResponse(user, role))
+	}
+
+	return res, nil
+}
+
+func (s *userAdminService) GetUser(userID string) (res dto.AdminUserResponse, err error) {
+	user, err := s.userRepo.GetUserByIDIncludingDeleted(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, ErrUserNotFound
+		}
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", userID))
+		return res, err
+	}
+
+	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	if err != nil {
+		s.logger.Error("error getting role", zap.Error(err))
+		return res, err
+	}
+
+	return dto.NewAdminUserResponse(user, role), nil
+}
+
+func (s *userAdminService) ChangeUserRole(actorID, userID string, roleID int) error {
+	s.logger.Info("Change User Role",
+		zap.String("actor_id", actorID),
+		zap.String("user_id", userID),
+		zap.Int("role_id", roleID),
+	)
+
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	if _, err := s.roleRepo.GetRoleByID(roleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		s.logger.Error("error getting role", zap.Error(err))
+		return err
+	}
+
+	if err := s.userRepo.UpdateRole(userID, roleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		s.logger.Error("error updating user role", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(userID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *userAdminService) DeleteUser(actorID, userID string) error {
+	s.logger.Info("Delete User",
+		zap.String("actor_id", actorID),
+		zap.String("user_id", userID),
+	)
+
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	if err := s.userRepo.SoftDeleteUser(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		s.logger.Error("error deleting user", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(userID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *userAdminService) RestoreUser(userID string) error {
+	s.logger.Info("Restore User",
+		zap.String("user_id", userID),
+	)
+
+	if err := s.userRepo.RestoreUser(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		s.logger.Error("error restoring user", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *userAdminService) ForcePasswordReset(userID string) error {
+	s.logger.Info("Force Password Reset",
+		zap.String("user_id", userID),
+	)
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+
+	if err := s.userRepo.RequirePasswordReset(userID); err != nil {
+		s.logger.Error("error requiring password reset", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(userID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	return s.mail.SendPasswordResetEmail(user,
+		"An administrator has asked you to choose a new password before you can log in again. Open the link below to choose one:",
+		"If it has expired, request a new link from the password reset page.",
+	)
+}
+
+func (s *userAdminService) EraseUser(actorID, userID string) (res dto.DataRequestResponse, err error) {
+	s.logger.Info("Erase User",
+		zap.String("actor_id", actorID),
+		zap.String("user_id", userID),
+	)
+
+	if actorID == userID {
+		return res, ErrCannotModifySelf
+	}
+
+	user, err := s.userRepo.GetUserByIDIncludingDeleted(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, ErrUserNotFound
+		}
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return res, err
+	}
+	if user.ErasedAt.Valid {
+		return res, ErrUserNotFound
+	}
+
+	return s.dataRequests.RequestErasure(user, actorID)
+}
+
+func (s *userAdminService) GetUserSessions(userID string) ([]dto.SessionResponse, error) {
+	if _, err := s.userRepo.GetUserByIDIncludingDeleted(userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+
+	return s.sessions.GetSessions(userID, "")
+}
+
+func (s *userAdminService) RevokeUserSession(userID, sessionID string) error {
+	return s.sessions.RevokeSession(userID, sessionID)
+}
+
+func (s *userAdminService) RevokeUserSessions(userID string) error {
+	s.logger.Info("Revoke User Sessions",
+		zap.String("user_id", userID),
+	)
+
+	if err := s.sessions.RevokeAllSessions(userID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -1,10 +1,11 @@
 package service
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/ecomz/backend/auth-service/internal/dto"
 	"github.com/ecomz/backend/auth-service/internal/model"
@@ -14,35 +15,126 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	ErrEmailNotVerified = errors.New("email address is not verified")
+	// ErrInvalidCredentials is returned for unknown emails and wrong
+	// passwords alike so login does not reveal which accounts exist.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrPasswordResetRequired is returned by login after an administrator
+	// forced a password reset.
+	ErrPasswordResetRequired = errors.New("password reset required, check your email for a reset link")
+	// ErrImpersonationSession is returned by account endpoints, which an
+	// administrator impersonating the user may not use.
+	ErrImpersonationSession = errors.New("not available while impersonating a user")
+)
+
+// UserService registers users and logs them in and out with their
+// password. The account flows mailed to the user, verifying the email and
+// resetting the password, are here as well.
 type UserService interface {
-	Login(email, password string) (res dto.LoginAndRegisiterResponse, err error)
-	Register(user *model.User) (res dto.LoginAndRegisiterResponse, err error)
+	// Login returns a challenge instead of tokens when the user has to
+	// complete multi-factor authentication through VerifyMFALogin.
+	Login(email, password string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error)
+	VerifyMFALogin(mfaToken, code string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error)
+	Register(user *model.User, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error)
 	CurrentUser(accessToken string) (res dto.UserResponse, err error)
+	// RefreshToken switches the organization the session acts for when
+	// organizationID is not nil.
+	RefreshToken(refreshToken string, organizationID *string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error)
+	Logout(accessToken string, client dto.ClientInfo) error
+	LogoutAll(accessToken string, client dto.ClientInfo) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, password string) error
+	// VerifyEmail accepts both verification and email change tokens.
+	VerifyEmail(token string) error
+	ResendVerificationEmail(email string) error
 }
 
 type userService struct {
-	logger   *zap.Logger
-	cfg      *config.Config
-	userRepo repository.UserRepository
-	roleRepo repository.RoleRepository
+	logger         *zap.Logger
+	cfg            *config.Config
+	userRepo       repository.UserRepository
+	roleRepo       repository.RoleRepository
+	userTokenRepo  repository.UserTokenRepository
+	denylist       utils.TokenDenylist
+	keyService     KeyService
+	cache          utils.CacheService
+	mfaService     MFAService
+	loginThrottle  LoginThrottle
+	sessions       SessionService
+	mail           AccountMailer
+	passwordHasher utils.PasswordHasher
+	passwordPolicy utils.PasswordPolicy
+	// dummyPasswordHash is compared against when the login email is
+	// unknown.
+	dummyPasswordHash func() string
+	audit             AuditService
 }
 
-func NewUserService(logger *zap.Logger, cfg *config.Config, userRepo repository.UserRepository, roleRepo repository.RoleRepository) UserService {
+func NewUserService(
+	logger *zap.Logger,
+	cfg *config.Config,
+	userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	userTokenRepo repository.UserTokenRepository,
+	denylist utils.TokenDenylist,
+	keyService KeyService,
+	cache utils.CacheService,
+	mfaService MFAService,
+	loginThrottle LoginThrottle,
+	sessions SessionService,
+	mail AccountMailer,
+	passwordHasher utils.PasswordHasher,
+	passwordPolicy utils.PasswordPolicy,
+	audit AuditService,
+) UserService {
 	return &userService{
-		logger:   logger,
-		cfg:      cfg,
-		userRepo: userRepo,
-		roleRepo: roleRepo,
+		logger:         logger,
+		cfg:            cfg,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		userTokenRepo:  userTokenRepo,
+		denylist:       denylist,
+		keyService:     keyService,
+		cache:          cache,
+		mfaService:     mfaService,
+		loginThrottle:  loginThrottle,
+		sessions:       sessions,
+		mail:           mail,
+		passwordHasher: passwordHasher,
+		passwordPolicy: passwordPolicy,
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, _ := passwordHasher.Hash(rand.Text())
+			return hash
+		}),
+		audit: audit,
 	}
 }
 
-func (s *userService) Register(user *model.User) (res dto.LoginAndRegisiterResponse, err error) {
+func (s *userService) Register(user *model.User, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error) {
 	s.logger.Info("Register User ",
 		zap.String("name", user.Name),
 		zap.String("email", user.Email),
-		zap.Int("role_id", user.RoleID),
 	)
-	user.Password, err = utils.HashPassword(user.Password)
+
+	// self registered users always get the default role, higher privileged
+	// roles are granted by an administrator
+	role, err := s.roleRepo.GetRoleByName(s.cfg.Auth.DefaultRole)
+	if err != nil {
+		s.logger.Error("error getting default role",
+			zap.Error(err),
+			zap.String("role", s.cfg.Auth.DefaultRole),
+		)
+		return res, err
+	}
+	user.RoleID = role.ID
+
+	if err := s.passwordPolicy.Validate(user.Password); err != nil {
+		s.logger.Error("password rejected by policy", zap.Error(err))
+		return res, err
+	}
+
+	user.Password, err = s.passwordHasher.Hash(user.Password)
 	if err != nil {
 		s.logger.Error("error hashing password", zap.Error(err))
 		return res, err
@@ -53,17 +145,18 @@ func (s *userService) Register(user *model.User) (res dto.LoginAndRegisiterRespo
 		s.logger.Error("error creating user", zap.Error(err))
 		return res, err
 	}
+	s.audit.Record(model.AuditRegistered, user.ID, user.ID, client, nil)
 
-	role, err := s.roleRepo.GetRoleByID(user.RoleID)
-	if err != nil {
-		s.logger.Error("error getting role",
-			zap.Error(err),
-			zap.Int("role_id", user.RoleID),
-		)
-		return
+	if err := s.mail.SendVerificationEmail(user); err != nil {
+		s.logger.Error("error sending verification email", zap.Error(err))
+		return res, err
+	}
+
+	if s.cfg.Auth.RequireVerifiedEmail {
+		return dto.NewLoginResponse(user, role, "", ""), nil
 	}
 
-	accessToken, refreshToken, err := s.generateTokens(user)
+	accessToken, refreshToken, err := s.sessions.StartSession(user, role, client)
 	if err != nil {
 		s.logger.Error("error generating tokens", zap.Error(err))
 		return res, err
@@ -72,55 +165,199 @@ func (s *userService) Register(user *model.User) (res dto.LoginAndRegisiterRespo
 	return dto.NewLoginResponse(user, role, accessToken, refreshToken), nil
 }
 
-func (s *userService) Login(email, password string) (res dto.LoginAndRegisiterResponse, err error) {
+func (s *userService) Login(email, password string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, challenge *dto.MFAChallengeResponse, err error) {
 	s.logger.Info("Login User",
 		zap.String("email", email),
+		zap.String("ip", client.IP),
 	)
 
+	if err := s.loginThrottle.Attempt(email, client.IP); err != nil {
+		s.logger.Warn("login rejected while locked out", zap.String("email", email), zap.String("ip", client.IP))
+		recordLoginFailure(s.audit, "", email, "locked_out", client)
+		return res, nil, err
+	}
+
 	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return res, nil, err
+	}
+
+	// unknown emails cost a password hash comparison as well so the response
+	// time does not reveal which accounts exist
+	passwordHash := s.dummyPasswordHash()
+	if user != nil {
+		passwordHash = user.Password
+	}
+
+	if !s.passwordHasher.Verify(password, passwordHash) || user == nil {
+		s.logger.Error("invalid credentials", zap.String("email", email), zap.String("ip", client.IP))
+		userID := ""
+		if user != nil {
+			userID = user.ID
+		}
+		recordLoginFailure(s.audit, userID, email, "invalid_credentials", client)
+		if err := s.loginThrottle.RecordFailure(email, client.IP); err != nil {
+			s.logger.Error("error recording login failure", zap.Error(err))
+			return res, nil, err
+		}
+		return res, nil, ErrInvalidCredentials
+	}
+
+	if err := s.loginThrottle.Release(email, client.IP); err != nil {
+		s.logger.Error("error releasing login attempt", zap.Error(err))
+		return res, nil, err
+	}
+
+	s.rehashPassword(user, password)
+
+	if user.PasswordResetRequired {
+		s.logger.Error("login while password reset is required", zap.String("email", email))
+		recordLoginFailure(s.audit, user.ID, email, "password_reset_required", client)
+		return res, nil, ErrPasswordResetRequired
+	}
+
+	if s.cfg.Auth.RequireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		s.logger.Error("login with unverified email", zap.String("email", email))
+		recordLoginFailure(s.audit, user.ID, email, "email_not_verified", client)
+		return res, nil, ErrEmailNotVerified
+	}
+
+	mfaEnabled, err := s.mfaService.IsEnabled(user.ID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			s.logger.Error("user not found", zap.String("email", email))
-			return res, fmt.Errorf("user not found")
+		return res, nil, err
+	}
+	if mfaEnabled {
+		// failures are only reset once the second factor is verified as well
+		challenge, err := s.sessions.MFAChallenge(user)
+		if err != nil {
+			s.logger.Error("error creating mfa challenge", zap.Error(err))
+			return res, nil, err
 		}
-		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return res, challenge, nil
+	}
+
+	if err := s.loginThrottle.RecordSuccess(user.Email); err != nil {
+		s.logger.Error("error resetting login failures", zap.Error(err))
+		return res, nil, err
+	}
+
+	res, err = s.sessions.CompleteLogin(user, "password", client)
+	return res, nil, err
+}
+
+// rehashPassword upgrades the stored hash of a user who just proved their
+// password when it was made with another algorithm or weaker parameters.
+// Failures are only logged, the old hash keeps working.
+func (s *userService) rehashPassword(user *model.User, password string) {
+	if !s.passwordHasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		s.logger.Error("error rehashing password", zap.Error(err), zap.String("user_id", user.ID))
+		return
+	}
+
+	if err := s.userRepo.RehashPassword(user.ID, user.Password, hash); err != nil {
+		s.logger.Error("error storing rehashed password", zap.Error(err), zap.String("user_id", user.ID))
+		return
+	}
+	user.Password = hash
+}
+
+// VerifyMFALogin completes a login started with Login using the challenge
+// token and a TOTP or recovery code. Wrong codes count as failed logins of
+// the account.
+func (s *userService) VerifyMFALogin(mfaToken, code string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error) {
+	claims, err := s.keyService.Verify(mfaToken)
+	if err != nil {
+		s.logger.Error("error parsing mfa token", zap.Error(err))
 		return res, err
 	}
 
-	if !utils.CheckPasswordHash(password, user.Password) {
-		s.logger.Error("invalid password")
-		return res, fmt.Errorf("invalid password")
+	if claims.TokenType != utils.MFAChallengeToken {
+		s.logger.Error("token is not an mfa challenge", zap.String("token_type", claims.TokenType))
+		return res, utils.ErrInvalidToken
 	}
 
-	role, err := s.roleRepo.GetRoleByID(user.RoleID)
+	revoked, err := s.denylist.IsRevoked(claims)
 	if err != nil {
-		s.logger.Error("error getting role", zap.Error(err))
+		s.logger.Error("error checking token denylist", zap.Error(err))
+		return res, err
+	}
+	if revoked {
+		s.logger.Error("mfa challenge already used", zap.String("user_id", claims.ID))
+		return res, utils.ErrTokenRevoked
+	}
+
+	s.logger.Info("Verify MFA Login",
+		zap.String("user_id", claims.ID),
+		zap.String("ip", client.IP),
+	)
+
+	if err := s.loginThrottle.Attempt(claims.Email, client.IP); err != nil {
+		s.logger.Warn("mfa login rejected while locked out", zap.String("user_id", claims.ID), zap.String("ip", client.IP))
+		recordLoginFailure(s.audit, claims.ID, claims.Email, "locked_out", client)
+		return res, err
+	}
+
+	if err := s.mfaService.Verify(claims.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			recordLoginFailure(s.audit, claims.ID, claims.Email, "invalid_mfa_code", client)
+			if err := s.loginThrottle.RecordFailure(claims.Email, client.IP); err != nil {
+				s.logger.Error("error recording login failure", zap.Error(err))
+				return res, err
+			}
+		}
+		return res, err
+	}
+
+	if err := s.loginThrottle.Release(claims.Email, client.IP); err != nil {
+		s.logger.Error("error releasing login attempt", zap.Error(err))
+		return res, err
+	}
+
+	// a challenge completes a single login
+	if err := s.denylist.RevokeToken(claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("error revoking mfa challenge", zap.Error(err))
+		return res, err
+	}
+
+	if err := s.loginThrottle.RecordSuccess(claims.Email); err != nil {
+		s.logger.Error("error resetting login failures", zap.Error(err))
 		return res, err
 	}
 
-	accessToken, refreshToken, err := s.generateTokens(user)
+	user, err := s.userRepo.GetUserByID(claims.ID)
 	if err != nil {
-		s.logger.Error("error generating tokens", zap.Error(err))
+		s.logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", claims.ID))
 		return res, err
 	}
 
-	return dto.NewLoginResponse(user, role, accessToken, refreshToken), nil
+	return s.sessions.CompleteLogin(user, "mfa", client)
+}
+
+// recordLoginFailure audits a refused login. The email is kept since userID
+// is empty for unknown accounts.
+func recordLoginFailure(audit AuditService, userID, email, reason string, client dto.ClientInfo) {
+	audit.Record(model.AuditLoginFailed, "", userID, client, map[string]string{
+		"email":  email,
+		"reason": reason,
+	})
 }
 
 func (s *userService) CurrentUser(accessToken string) (res dto.UserResponse, err error) {
-	claims, err := utils.ParseToken(accessToken, s.cfg.JWT.SecretKey)
+	// impersonated sessions can see the user, the frontend shows a banner
+	claims, err := s.sessions.VerifyAccessToken(accessToken)
 	if err != nil {
-		s.logger.Error("error parsing token", zap.Error(err))
 		return res, err
 	}
 
-	user, err := s.userRepo.GetUserByEmail(claims.Email)
+	// the email in the token is stale after an email change
+	user, err := currentUser(s.logger, s.userRepo, claims)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			s.logger.Error("user not found", zap.String("email", claims.Email))
-			return res, fmt.Errorf("user not found")
-		}
-		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", claims.Email))
 		return res, err
 	}
 
@@ -130,38 +367,273 @@ func (s *userService) CurrentUser(accessToken string) (res dto.UserResponse, err
 		return res, err
 	}
 
-	return dto.NewUserResponse(user, role), nil
+	res = dto.NewUserResponse(user, role)
+	if claims.IsImpersonated() {
+		res.Impersonation = &dto.ImpersonationInfo{
+			ID:        claims.FamilyID,
+			ActorID:   claims.Act.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}
+		if actor, err := s.userRepo.GetUserByIDIncludingDeleted(claims.Act.ID); err == nil {
+			res.Impersonation.ActorName = actor.Name
+		}
+	}
+
+	return res, nil
 }
 
-func (s *userService) generateTokens(user *model.User) (accessToken, refreshToken string, err error) {
-	s.logger.Info("Generate Tokens for User",
-		zap.String("email", user.Email),
+func (s *userService) RefreshToken(refreshToken string, switchOrganization *string, client dto.ClientInfo) (res dto.LoginAndRegisiterResponse, err error) {
+	return s.sessions.Refresh(refreshToken, switchOrganization, client)
+}
+
+func (s *userService) Logout(accessToken string, client dto.ClientInfo) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Logout User",
+		zap.String("user_id", claims.ID),
+		zap.String("family_id", claims.FamilyID),
 	)
 
-	claimsAccessToken := utils.NewClaims(
-		user.ID,
-		user.Name,
-		user.Email,
-		s.cfg.App.Name,
-		time.Now().Add(s.cfg.JWT.LoginExp),
+	if err := s.denylist.RevokeToken(claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("error revoking access token", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeFamily(claims.ID, claims.FamilyID); err != nil {
+		s.logger.Error("error revoking refresh token family", zap.Error(err))
+		return err
+	}
+	s.audit.Record(model.AuditLoggedOut, claims.ID, claims.FamilyID, client, nil)
+
+	return nil
+}
+
+func (s *userService) LogoutAll(accessToken string, client dto.ClientInfo) error {
+	claims, err := s.sessions.VerifyAccountToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Logout User From All Sessions",
+		zap.String("user_id", claims.ID),
+	)
+
+	if err := s.denylist.RevokeToken(claims.RegisteredClaims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("error revoking access token", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(claims.ID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+	s.audit.Record(model.AuditLoggedOutAll, claims.ID, claims.ID, client, nil)
+
+	return nil
+}
+
+// RequestPasswordReset mails a reset link when the email belongs to a user.
+// Unknown emails are not reported to the caller so accounts cannot be
+// enumerated through this endpoint.
+func (s *userService) RequestPasswordReset(email string) error {
+	s.logger.Info("Request Password Reset",
+		zap.String("email", email),
+	)
+
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("password reset requested for unknown email", zap.String("email", email))
+			return nil
+		}
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return err
+	}
+
+	return s.mail.SendPasswordResetEmail(user,
+		"We received a request to reset your password. Open the link below to choose a new one:",
+		"If you did not request a reset you can ignore this email.",
+	)
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+// and signs the user out of every session.
+func (s *userService) ResetPassword(token, password string) error {
+	// checked before the token is consumed so the user can pick another
+	// password with the same link
+	if err := s.passwordPolicy.Validate(password); err != nil {
+		s.logger.Error("password rejected by policy", zap.Error(err))
+		return err
+	}
+
+	resetToken, err := s.userTokenRepo.ConsumeToken(model.TokenPurposePasswordReset, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("invalid or expired password reset token")
+			return fmt.Errorf("invalid or expired reset token")
+		}
+		s.logger.Error("error consuming password reset token", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("Reset Password",
+		zap.String("user_id", resetToken.UserID),
+	)
+
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		s.logger.Error("error hashing password", zap.Error(err))
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(resetToken.UserID, hashedPassword); err != nil {
+		s.logger.Error("error updating password", zap.Error(err))
+		return err
+	}
+
+	if err := s.userTokenRepo.InvalidateTokens(resetToken.UserID, model.TokenPurposePasswordReset); err != nil {
+		s.logger.Error("error invalidating password reset tokens", zap.Error(err))
+		return err
+	}
+
+	// following the mailed link proves the user owns the address
+	if err := s.userRepo.MarkEmailVerified(resetToken.UserID); err != nil {
+		s.logger.Error("error marking email verified", zap.Error(err))
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(resetToken.UserID); err != nil {
+		s.logger.Error("error revoking refresh token families", zap.Error(err))
+		return err
+	}
+
+	// the owner just proved access to the mailbox, let them log in again
+	user, err := s.userRepo.GetUserByID(resetToken.UserID)
+	if err != nil {
+		s.logger.Error("error getting user by id", zap.Error(err))
+		return err
+	}
+	if err := s.loginThrottle.ClearLockout(LockoutKindAccount, user.Email); err != nil {
+		s.logger.Error("error clearing login lockout", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *userService) VerifyEmail(token string) error {
+	verificationToken, err := s.userTokenRepo.ConsumeToken(model.TokenPurposeEmailVerification, utils.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		// the link may confirm a changed address instead
+		err = s.confirmEmailChange(token)
+		if err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		s.logger.Error("invalid or expired email verification token")
+		return fmt.Errorf("invalid or expired verification token")
+	}
+	if err != nil {
+		s.logger.Error("error consuming email verification token", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("Verify Email",
+		zap.String("user_id", verificationToken.UserID),
+	)
+
+	if err := s.userRepo.MarkEmailVerified(verificationToken.UserID); err != nil {
+		s.logger.Error("error marking email verified", zap.Error(err))
+		return err
+	}
+
+	if err := s.userTokenRepo.InvalidateTokens(verificationToken.UserID, model.TokenPurposeEmailVerification); err != nil {
+		s.logger.Error("error invalidating email verification tokens", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ResendVerificationEmail mails a new verification link, at most once per
+// EmailVerificationResendInterval. Like RequestPasswordReset it reports
+// nothing about whether the email exists.
+func (s *userService) ResendVerificationEmail(email string) error {
+	s.logger.Info("Resend Verification Email",
+		zap.String("email", email),
 	)
-	accessToken, err = utils.GenerateToken(claimsAccessToken, s.cfg.JWT.SecretKey)
+
+	user, err := s.userRepo.GetUserByEmail(email)
 	if err != nil {
-		s.logger.Error("error generating access token", zap.Error(err))
-		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("verification email requested for unknown email", zap.String("email", email))
+			return nil
+		}
+		s.logger.Error("error getting user by email", zap.Error(err), zap.String("email", email))
+		return err
 	}
 
-	claimsRefreshToken := utils.NewClaims(
-		user.ID,
-		user.Name,
-		user.Email,
-		s.cfg.App.Name,
-		time.Now().Add(s.cfg.JWT.RefreshExp),
+	if user.EmailVerifiedAt.Valid {
+		s.logger.Warn("verification email requested for verified email", zap.String("user_id", user.ID))
+		return nil
+	}
+
+	allowed, err := s.cache.SetNX(
+		"email_verification_resend:"+user.ID,
+		[]byte("1"),
+		int64(s.cfg.Auth.EmailVerificationResendInterval.Seconds()),
 	)
-	refreshToken, err = utils.GenerateToken(claimsRefreshToken, s.cfg.JWT.SecretKey)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+		s.logger.Error("error throttling verification email", zap.Error(err))
+		return err
+	}
+	if !allowed {
+		s.logger.Warn("verification email throttled", zap.String("user_id", user.ID))
+		return nil
+	}
+
+	return s.mail.SendVerificationEmail(user)
+}
+
+func (s *userService) confirmEmailChange(token string) error {
+	changeToken, err := s.userTokenRepo.ConsumeToken(model.TokenPurposeEmailChange, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Confirm Email Change",
+		zap.String("user_id", changeToken.UserID),
+	)
+
+	if err := s.userRepo.ConfirmPendingEmail(changeToken.UserID); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return ErrEmailTaken
+		}
+		s.logger.Error("error confirming pending email", zap.Error(err))
+		return err
+	}
+
+	// reset links mailed to the old address must not outlive it
+	if err := s.userTokenRepo.InvalidateTokens(changeToken.UserID, model.TokenPurposePasswordReset); err != nil {
+		s.logger.Error("error invalidating password reset tokens", zap.Error(err))
+		return err
 	}
 
-	return accessToken, refreshToken, nil
+	return nil
+}
+
+// currentUser loads the user of an access token.
+func currentUser(logger *zap.Logger, userRepo repository.UserRepository, claims *utils.MyClaims) (*model.User, error) {
+	user, err := userRepo.GetUserByID(claims.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error("user not found", zap.String("user_id", claims.ID))
+			return nil, ErrUserNotFound
+		}
+		logger.Error("error getting user by id", zap.Error(err), zap.String("user_id", claims.ID))
+		return nil, err
+	}
+	return user, nil
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/ecomz/backend/libs/config"
 	"github.com/ecomz/backend/libs/db"
+	"github.com/ecomz/backend/libs/jwks"
 	"github.com/ecomz/backend/libs/logger"
+	"github.com/ecomz/backend/libs/middleware"
+	"github.com/ecomz/backend/libs/utils"
 	"github.com/ecomz/backend/product-service/cmd/router"
 	"github.com/ecomz/backend/product-service/internal/handler"
 	"github.com/ecomz/backend/product-service/internal/repository"
@@ -14,7 +18,11 @@ import (
 )
 
 func main() {
-	zapLogger := logger.NewZapLogger()
+	baseLogger, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	zapLogger := logger.FromZap(baseLogger)
 	cfg := config.LoadConfigFromFile("./cmd", "config", "yml")
 
 	dbConn, err := db.NewConnectionManager(cfg.Database)
@@ -27,15 +35,33 @@ func main() {
 		}
 	}()
 
+	redisAddr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
+	pool, err := utils.CreateRedisPool(redisAddr, cfg.Redis.Password, cfg.Redis.MaxIdle, baseLogger)
+	if err != nil {
+		zapLogger.Fatal("Failed to create Redis pool", zap.Error(err))
+	}
+	defer pool.Close()
+
+	verifier, err := jwks.NewVerifierFromConfig(cfg.JWT)
+	if err != nil {
+		zapLogger.Fatal("Failed to create token verifier", zap.Error(err))
+	}
+
+	authenticator := middleware.NewAuthenticator(verifier, utils.NewTokenDenylist(pool)).
+		WithSessionActivity(utils.NewSessionActivity(pool, cfg.JWT.RefreshExp)).
+		WithAPIKeys(utils.NewAPIKeyVerifier(dbConn.GetDB(), cfg.Auth.VerifiedEmailPermissions))
+
+	cache := utils.NewCacheService(pool, baseLogger)
+
 	categoryRepository := repository.NewCategoryRepository(dbConn.GetDB())
 	categoryService := service.NewCategoryService(zapLogger, categoryRepository)
 	categoryHandler := handler.NewCategoryHandler(zapLogger, categoryService)
 
 	productRepository := repository.NewProductRepository(dbConn.GetDB())
-	productService := service.NewProductService(zapLogger, productRepository)
+	productService := service.NewProductService(zapLogger, productRepository, categoryRepository, cfg.Catalog, cache)
 	productHandler := handler.NewProductHandler(zapLogger, productService)
 
-	r := router.NewRouter(categoryHandler, productHandler)
+	r := router.NewRouter(authenticator, categoryHandler, productHandler)
 
 	serverAddress := ":" + cfg.App.Port
 
@@ -3,28 +3,39 @@ package router
 import (
 	"net/http"
 
+	"github.com/ecomz/backend/libs/middleware"
 	"github.com/ecomz/backend/product-service/internal/handler"
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(categoryHandler *handler.CategoryHandler, productHandler *handler.ProductHandler) *mux.Router {
+func NewRouter(authenticator *middleware.Authenticator, categoryHandler *handler.CategoryHandler, productHandler *handler.ProductHandler) *mux.Router {
 	r := mux.NewRouter()
 
 	api := r.PathPrefix("/api").Subrouter()
 
 	product := api.PathPrefix("/products").Subrouter()
 
+	// organization members may manage their organization's catalogue, the
+	// handlers limit the writes to it
+	requireOrgPermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return authenticator.RequireOrgPermission(permission)(h)
+	}
+
 	product.HandleFunc("", productHandler.GetAllProducts).Methods(http.MethodGet)
-	product.HandleFunc("", productHandler.CreateProduct).Methods(http.MethodPost)
-	product.HandleFunc("/{id}", productHandler.GetProductByID).Methods(http.MethodGet)
-	product.HandleFunc("/{id}", productHandler.UpdateProduct).Methods(http.MethodPut)
-	product.HandleFunc("/{id}", productHandler.DeleteProduct).Methods(http.MethodDelete)
+	product.Handle("", requireOrgPermission("product:write", productHandler.CreateProduct)).Methods(http.MethodPost)
+
+	product.HandleFunc("/search", productHandler.SearchProducts).Methods(http.MethodGet)
+	product.HandleFunc("/suggest", productHandler.Suggest).Methods(http.MethodGet)
 
 	product.HandleFunc("/categories", categoryHandler.GetAllCategories).Methods(http.MethodGet)
-	product.HandleFunc("/categories", categoryHandler.CreateCategory).Methods(http.MethodPost)
+	product.Handle("/categories", requireOrgPermission("category:write", categoryHandler.CreateCategory)).Methods(http.MethodPost)
 	product.HandleFunc("/categories/{id}", categoryHandler.GetCategoryByID).Methods(http.MethodGet)
-	product.HandleFunc("/categories/{id}", categoryHandler.UpdateCategory).Methods(http.MethodPut)
-	product.HandleFunc("/categories/{id}", categoryHandler.DeleteCategory).Methods(http.MethodDelete)
+	product.Handle("/categories/{id}", requireOrgPermission("category:write", categoryHandler.UpdateCategory)).Methods(http.MethodPut)
+	product.Handle("/categories/{id}", requireOrgPermission("category:write", categoryHandler.DeleteCategory)).Methods(http.MethodDelete)
+
+	product.HandleFunc("/{id}", productHandler.GetProductByID).Methods(http.MethodGet)
+	product.Handle("/{id}", requireOrgPermission("product:write", productHandler.UpdateProduct)).Methods(http.MethodPut)
+	product.Handle("/{id}", requireOrgPermission("product:write", productHandler.DeleteProduct)).Methods(http.MethodDelete)
 
 	return r
 }
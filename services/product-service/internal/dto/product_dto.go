@@ -1,5 +1,7 @@
 package dto
 
+import "github.com/ecomz/backend/product-service/internal/model"
+
 type CreateProductRequest struct {
 	Name        string  `json:"name" validate:"required,min=3,max=50"`
 	Description string  `json:"description" validate:"required,max=255"`
@@ -13,3 +15,70 @@ type UpdateProductRequest struct {
 	Price       float64 `json:"price" validate:"omitempty,gt=0"`
 	CategoryID  int     `json:"category_id" validate:"omitempty,gt=0"`
 }
+
+// ProductListQuery holds the query parameters of the product listing. A
+// cursor from the previous page continues the listing in place of Page and
+// must come with the same Sort and Order.
+type ProductListQuery struct {
+	OrganizationID string
+	CategoryID     int     `validate:"gte=0"`
+	MinPrice       float64 `validate:"gte=0"`
+	MaxPrice       float64 `validate:"omitempty,gtefield=MinPrice"`
+	Search         string  `validate:"max=255"`
+	Sort           string  `validate:"oneof=id name price created_at"`
+	Order          string  `validate:"oneof=asc desc"`
+	Cursor         string  `validate:"max=512"`
+	Page           int     `validate:"gte=1"`
+	Limit          int     `validate:"gte=1,lte=100"`
+	// Facets asks for the facets of the whole listing along with the page.
+	Facets bool
+}
+
+// ProductSearchQuery holds the query parameters of the product search.
+// Query uses the websearch syntax: quoted phrases, OR and -excluded words.
+type ProductSearchQuery struct {
+	Query          string `validate:"required,max=255"`
+	OrganizationID string
+	CategoryID     int `validate:"gte=0"`
+	Page           int `validate:"gte=1"`
+	Limit          int `validate:"gte=1,lte=100"`
+}
+
+// ProductFacets counts the products of a listing by the configured facets,
+// facets that are not configured are left out.
+type ProductFacets struct {
+	Categories     []CategoryFacet    `json:"categories,omitempty"`
+	Price          []PriceBucketFacet `json:"price,omitempty"`
+	HasPrice       *FlagFacet         `json:"has_price,omitempty"`
+	HasDescription *FlagFacet         `json:"has_description,omitempty"`
+}
+
+type CategoryFacet struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PriceBucketFacet counts the prices from Min up to Max, excluded. The last
+// bucket has no Max.
+type PriceBucketFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+type FlagFacet struct {
+	True  int `json:"true"`
+	False int `json:"false"`
+}
+
+// SuggestQuery holds the query parameters of the autocomplete.
+type SuggestQuery struct {
+	Query          string `validate:"required,min=2,max=100"`
+	OrganizationID string
+}
+
+type SuggestResponse struct {
+	Products   []*model.Suggestion `json:"products"`
+	Categories []*model.Suggestion `json:"categories"`
+}
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/ecomz/backend/libs/logger"
+	"github.com/ecomz/backend/libs/middleware"
 	"github.com/ecomz/backend/libs/utils"
 	"github.com/ecomz/backend/product-service/internal/dto"
 	"github.com/ecomz/backend/product-service/internal/service"
@@ -42,8 +44,11 @@ func (ch *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// categories created with an organization role belong to the organization
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	category, err := ch.service.CreateCategory(&req)
+	category, err := ch.service.CreateCategory(&req, claims.OrgScope("category:write"))
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -54,7 +59,12 @@ func (ch *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request
 }
 
 func (ch *CategoryHandler) GetAllCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := ch.service.GetAllCategories()
+	organizationID, ok := organizationIDQuery(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := ch.service.GetAllCategories(organizationID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -112,10 +122,12 @@ func (ch *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	err = ch.service.UpdateCategory(idInt, &req)
+	err = ch.service.UpdateCategory(idInt, &req, claims.OrgScope("category:write"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		categoryErrorResponse(w, err)
 		return
 	}
 
@@ -135,13 +147,23 @@ func (ch *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	err = ch.service.DeleteCategory(idInt)
+	err = ch.service.DeleteCategory(idInt, claims.OrgScope("category:write"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		categoryErrorResponse(w, err)
 		return
 	}
 
 	// return
 	utils.SuccessResponse(w, http.StatusOK, "Category deleted successfully", nil)
 }
+
+func categoryErrorResponse(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrCategoryNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+}
@@ -2,16 +2,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/ecomz/backend/libs/logger"
+	"github.com/ecomz/backend/libs/middleware"
 	"github.com/ecomz/backend/libs/utils"
 	"github.com/ecomz/backend/product-service/internal/dto"
 	"github.com/ecomz/backend/product-service/internal/service"
 	"github.com/gorilla/mux"
 )
 
+const defaultProductListLimit = 20
+
 type ProductHandler struct {
 	logger  logger.Logger
 	service service.ProductService
@@ -41,10 +45,13 @@ func (ch *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// products created with an organization role belong to the organization
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	product, err := ch.service.CreateProduct(&req)
+	product, err := ch.service.CreateProduct(&req, claims.OrgScope("product:write"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		productErrorResponse(w, err)
 		return
 	}
 
@@ -52,14 +59,158 @@ func (ch *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request)
 	utils.SuccessResponse(w, http.StatusOK, "Product created successfully", product)
 }
 
+// GetAllProducts lists products a page at a time, by page number or by the
+// cursor of the previous page, with the facets of the listing when asked.
 func (ch *ProductHandler) GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := ch.service.GetAllProducts()
+	organizationID, ok := organizationIDQuery(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := dto.ProductListQuery{
+		OrganizationID: organizationID,
+		Search:         params.Get("search"),
+		Sort:           params.Get("sort"),
+		Order:          params.Get("order"),
+		Cursor:         params.Get("cursor"),
+		Page:           1,
+		Limit:          defaultProductListLimit,
+	}
+	if query.Sort == "" {
+		query.Sort = "id"
+	}
+	if value := params.Get("facets"); value != "" {
+		facets, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid facets")
+			return
+		}
+		query.Facets = facets
+	}
+	if query.Order == "" {
+		query.Order = "asc"
+	}
+
+	for name, target := range map[string]*int{"category_id": &query.CategoryID, "page": &query.Page, "limit": &query.Limit} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = n
+	}
+
+	for name, target := range map[string]*float64{"min_price": &query.MinPrice, "max_price": &query.MaxPrice} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = n
+	}
+
+	validationErr := utils.ValidateStruct(query)
+	if validationErr != nil {
+		utils.ValidationErrorResponse(w, validationErr)
+		return
+	}
+
+	if query.Facets {
+		products, pagination, facets, err := ch.service.GetProductsWithFacets(query)
+		if err != nil {
+			productErrorResponse(w, err)
+			return
+		}
+		utils.FacetedSuccessResponse(w, http.StatusOK, "Products fetched successfully", products, pagination, facets)
+		return
+	}
+
+	products, pagination, err := ch.service.GetAllProducts(query)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		productErrorResponse(w, err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Products fetched successfully", products, pagination)
+}
+
+// Suggest autocompletes the text typed so far, given in the q parameter.
+func (ch *ProductHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	organizationID, ok := organizationIDQuery(w, r)
+	if !ok {
+		return
+	}
+
+	query := dto.SuggestQuery{
+		Query:          r.URL.Query().Get("q"),
+		OrganizationID: organizationID,
+	}
+
+	validationErr := utils.ValidateStruct(query)
+	if validationErr != nil {
+		utils.ValidationErrorResponse(w, validationErr)
+		return
+	}
+
+	res, err := ch.service.Suggest(query)
+	if err != nil {
+		productErrorResponse(w, err)
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Products fetched successfully", products)
+	utils.SuccessResponse(w, http.StatusOK, "Suggestions fetched successfully", res)
+}
+
+// SearchProducts runs the full-text search given in the q parameter.
+func (ch *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	organizationID, ok := organizationIDQuery(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := dto.ProductSearchQuery{
+		Query:          params.Get("q"),
+		OrganizationID: organizationID,
+		Page:           1,
+		Limit:          defaultProductListLimit,
+	}
+
+	for name, target := range map[string]*int{"category_id": &query.CategoryID, "page": &query.Page, "limit": &query.Limit} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = n
+	}
+
+	validationErr := utils.ValidateStruct(query)
+	if validationErr != nil {
+		utils.ValidationErrorResponse(w, validationErr)
+		return
+	}
+
+	results, pagination, err := ch.service.SearchProducts(query)
+	if err != nil {
+		productErrorResponse(w, err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Products found successfully", results, pagination)
 }
 
 func (ch *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request) {
@@ -109,10 +260,12 @@ func (ch *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	err = ch.service.UpdateProduct(idInt, &req)
+	err = ch.service.UpdateProduct(idInt, &req, claims.OrgScope("product:write"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		productErrorResponse(w, err)
 		return
 	}
 
@@ -131,13 +284,40 @@ func (ch *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+
 	// call service
-	err = ch.service.DeleteProduct(idInt)
+	err = ch.service.DeleteProduct(idInt, claims.OrgScope("product:write"))
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		productErrorResponse(w, err)
 		return
 	}
 
 	// return
 	utils.SuccessResponse(w, http.StatusOK, "Product deleted successfully", nil)
 }
+
+func productErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrProductNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrCategoryNotFound), errors.Is(err, service.ErrInvalidCursor):
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// organizationIDQuery reads the optional organization_id filter of the
+// listings.
+func organizationIDQuery(w http.ResponseWriter, r *http.Request) (string, bool) {
+	organizationID := r.URL.Query().Get("organization_id")
+	if organizationID == "" {
+		return "", true
+	}
+	if err := utils.ValidateVar(organizationID, "uuid"); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid organization_id")
+		return "", false
+	}
+	return organizationID, true
+}
@@ -3,8 +3,11 @@ package model
 import "time"
 
 type Category struct {
-	ID        int       `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// OrganizationID is nil for platform categories, which every
+	// organization may use.
+	OrganizationID *string   `json:"organization_id" db:"organization_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -1,11 +1,81 @@
 package model
 
+import "database/sql"
+
 type Product struct {
 	ID          int     `json:"id" db:"id"`
 	Name        string  `json:"name" db:"name"`
 	Description string  `json:"description" db:"description"`
 	Price       float64 `json:"price" db:"price"`
 	CategoryID  int     `json:"category_id" db:"category_id"`
-	CreatedAt   string  `json:"created_at" db:"created_at"`
-	UpdatedAt   string  `json:"updated_at" db:"updated_at"`
+	// OrganizationID is the merchant selling the product, nil when the
+	// platform does.
+	OrganizationID *string `json:"organization_id" db:"organization_id"`
+	CreatedAt      string  `json:"created_at" db:"created_at"`
+	UpdatedAt      string  `json:"updated_at" db:"updated_at"`
+}
+
+// ProductFilter narrows down the products returned by
+// ProductRepository.GetProducts. Zero fields match everything.
+type ProductFilter struct {
+	OrganizationID string
+	CategoryID     int
+	MinPrice       float64
+	MaxPrice       float64
+	// Search matches a part of the name, case-insensitively.
+	Search string
+}
+
+// ProductSort orders a product listing by Field, one of the
+// ProductSortFields, and then by id.
+type ProductSort struct {
+	Field string
+	Desc  bool
+}
+
+// facets of product listings, see ProductRepository.CountFacets
+const (
+	FacetCategory       = "category"
+	FacetPrice          = "price"
+	FacetHasPrice       = "has_price"
+	FacetHasDescription = "has_description"
+)
+
+// ProductFacetCount counts the matching products sharing a category, a
+// price bucket and the presence of a price and of a description. Facets
+// are sums of these groups.
+type ProductFacetCount struct {
+	CategoryID     int            `db:"category_id"`
+	CategoryName   sql.NullString `db:"category_name"`
+	PriceBucket    int            `db:"price_bucket"`
+	HasPrice       bool           `db:"has_price"`
+	HasDescription bool           `db:"has_description"`
+	Count          int            `db:"count"`
+}
+
+// ProductSortFields are the fields products can be sorted by.
+var ProductSortFields = []string{"id", "name", "price", "created_at"}
+
+// ProductCursor is the position of the last product of a page, in the sort
+// the page was listed with. Value is the product's sort field as text.
+type ProductCursor struct {
+	Value string
+	ID    int
+}
+
+// HighlightStart and HighlightStop surround the matches in the snippets of
+// search results. Private use characters are not markup, so the snippets
+// can be escaped before the matches are marked up.
+const (
+	HighlightStart = "\ue000"
+	HighlightStop  = "\ue001"
+)
+
+// ProductSearchResult is a product matching a search, with its rank and
+// the name and description with the matches highlighted.
+type ProductSearchResult struct {
+	Product
+	Rank                 float64 `json:"rank" db:"rank"`
+	NameHighlight        string  `json:"name_highlight" db:"name_highlight"`
+	DescriptionHighlight string  `json:"description_highlight" db:"description_highlight"`
 }
@@ -0,0 +1,8 @@
+package model
+
+// Suggestion is a product or category whose name matches what the user is
+// typing.
+type Suggestion struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
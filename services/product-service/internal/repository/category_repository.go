@@ -8,12 +8,16 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// CategoryRepository writes are limited to the categories of organizationID
+// unless it is empty, and return sql.ErrNoRows when no category matched.
 type CategoryRepository interface {
-	CreateCategory(data *dto.CreateCategoryRequest) (*model.Category, error)
-	GetAllCategories() ([]*model.Category, error)
+	CreateCategory(data *dto.CreateCategoryRequest, organizationID string) (*model.Category, error)
+	GetAllCategories(organizationID string) ([]*model.Category, error)
 	GetCategoryByID(id int) (*model.Category, error)
-	UpdateCategory(id int, data *dto.UpdateCategoryRequest) error
-	DeleteCategory(id int) error
+	// SuggestCategories is ProductRepository.SuggestProducts for categories.
+	SuggestCategories(text, organizationID string, limit int) ([]*model.Suggestion, error)
+	UpdateCategory(id int, data *dto.UpdateCategoryRequest, organizationID string) error
+	DeleteCategory(id int, organizationID string) error
 }
 
 type categoryRepository struct {
@@ -24,13 +28,16 @@ func NewCategoryRepository(db *sqlx.DB) CategoryRepository {
 	return &categoryRepository{db}
 }
 
-func (r *categoryRepository) CreateCategory(data *dto.CreateCategoryRequest) (*model.Category, error) {
+func (r *categoryRepository) CreateCategory(data *dto.CreateCategoryRequest, organizationID string) (*model.Category, error) {
 	category := &model.Category{
 		Name: data.Name,
 	}
+	if organizationID != "" {
+		category.OrganizationID = &organizationID
+	}
 
-	query := `INSERT INTO categories (name, created_at, updated_at) VALUES ($1, NOW(), NOW()) RETURNING id, created_at, updated_at`
-	err := r.db.QueryRow(query, category.Name).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
+	query := `INSERT INTO categories (name, organization_id, created_at, updated_at) VALUES ($1, $2, NOW(), NOW()) RETURNING id, created_at, updated_at`
+	err := r.db.QueryRow(query, category.Name, category.OrganizationID).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +45,17 @@ func (r *categoryRepository) CreateCategory(data *dto.CreateCategoryRequest) (*m
 	return category, nil
 }
 
-func (r *categoryRepository) GetAllCategories() ([]*model.Category, error) {
+// GetAllCategories returns every category when organizationID is empty.
+func (r *categoryRepository) GetAllCategories(organizationID string) ([]*model.Category, error) {
 	var categories []*model.Category
-	err := r.db.Select(&categories, "SELECT * FROM categories")
+	err := r.db.Select(&categories, "SELECT * FROM categories WHERE $1 = '' OR organization_id = NULLIF($1, '')::uuid", organizationID)
 	return categories, err
 }
 
+func (r *categoryRepository) SuggestCategories(text, organizationID string, limit int) ([]*model.Suggestion, error) {
+	return suggest(r.db, "categories", text, organizationID, true, limit)
+}
+
 func (r *categoryRepository) GetCategoryByID(id int) (*model.Category, error) {
 	var category model.Category
 
@@ -55,12 +67,29 @@ func (r *categoryRepository) GetCategoryByID(id int) (*model.Category, error) {
 	return &category, err
 }
 
-func (r *categoryRepository) UpdateCategory(id int, data *dto.UpdateCategoryRequest) error {
-	_, err := r.db.Exec("UPDATE categories SET name=$1, updated_at=NOW() WHERE id=$2", data.Name, id)
-	return err
+func (r *categoryRepository) UpdateCategory(id int, data *dto.UpdateCategoryRequest, organizationID string) error {
+	result, err := r.db.Exec("UPDATE categories SET name=$1, updated_at=NOW() WHERE id=$2 AND ($3 = '' OR organization_id = NULLIF($3, '')::uuid)", data.Name, id, organizationID)
+	if err != nil {
+		return err
+	}
+	return checkRowAffected(result)
+}
+
+func (r *categoryRepository) DeleteCategory(id int, organizationID string) error {
+	result, err := r.db.Exec("DELETE FROM categories WHERE id=$1 AND ($2 = '' OR organization_id = NULLIF($2, '')::uuid)", id, organizationID)
+	if err != nil {
+		return err
+	}
+	return checkRowAffected(result)
 }
 
-func (r *categoryRepository) DeleteCategory(id int) error {
-	_, err := r.db.Exec("DELETE FROM categories WHERE id=$1", id)
-	return err
+func checkRowAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
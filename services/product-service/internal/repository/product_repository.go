@@ -2,18 +2,47 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/ecomz/backend/product-service/internal/dto"
 	"github.com/ecomz/backend/product-service/internal/model"
 	"github.com/jmoiron/sqlx"
 )
 
+// productColumns leaves out search_vector, which only the database uses.
+const productColumns = `
+	id, name, description, price, category_id, organization_id, created_at, updated_at`
+
+// searchHighlightOptions are the ts_headline options of the search results,
+// the snippets mark matches with model.HighlightStart and HighlightStop.
+const searchHighlightOptions = `StartSel="` + model.HighlightStart + `", StopSel="` + model.HighlightStop + `"`
+
+// ProductRepository writes are limited to the products of organizationID
+// unless it is empty, and return sql.ErrNoRows when no product matched.
 type ProductRepository interface {
-	CreateProduct(data *dto.CreateProductRequest) (*model.Product, error)
-	GetAllProducts() ([]*model.Product, error)
+	CreateProduct(data *dto.CreateProductRequest, organizationID string) (*model.Product, error)
+	// GetProducts returns a page of the matching products, the one after
+	// the cursor when it is not nil and the one at offset otherwise.
+	GetProducts(filter model.ProductFilter, sort model.ProductSort, after *model.ProductCursor, limit, offset int) ([]*model.Product, error)
+	CountProducts(filter model.ProductFilter) (int, error)
+	// CountFacets groups the matching products in a single scan. The price
+	// bucket of a product is the number of priceBuckets, ascending lower
+	// bounds, at or below its price. The category filter is not applied so
+	// the category facet can offer the other categories, callers keep the
+	// groups of filter.CategoryID for everything else.
+	CountFacets(filter model.ProductFilter, priceBuckets []float64) ([]*model.ProductFacetCount, error)
+	// SuggestProducts returns the products whose name starts with, contains
+	// or resembles text, prefix matches first.
+	SuggestProducts(text, organizationID string, limit int) ([]*model.Suggestion, error)
+	// SearchProducts returns the products matching text, a websearch query,
+	// best ranked first.
+	SearchProducts(text string, filter model.ProductFilter, limit, offset int) ([]*model.ProductSearchResult, error)
+	CountSearchResults(text string, filter model.ProductFilter) (int, error)
 	GetProductByID(id int) (*model.Product, error)
-	UpdateProduct(id int, data *dto.UpdateProductRequest) error
-	DeleteProduct(id int) error
+	UpdateProduct(id int, data *dto.UpdateProductRequest, organizationID string) error
+	DeleteProduct(id int, organizationID string) error
 }
 
 type productRepository struct {
@@ -24,21 +53,25 @@ func NewProductRepository(db *sqlx.DB) ProductRepository {
 	return &productRepository{db}
 }
 
-func (r *productRepository) CreateProduct(data *dto.CreateProductRequest) (*model.Product, error) {
+func (r *productRepository) CreateProduct(data *dto.CreateProductRequest, organizationID string) (*model.Product, error) {
 	product := &model.Product{
 		Name:        data.Name,
 		Description: data.Description,
 		Price:       data.Price,
 		CategoryID:  data.CategoryID,
 	}
+	if organizationID != "" {
+		product.OrganizationID = &organizationID
+	}
 
-	query := `INSERT INTO products (name, description, price, category_id, created_at, updated_at) VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id, created_at, updated_at`
+	query := `INSERT INTO products (name, description, price, category_id, organization_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id, created_at, updated_at`
 	err := r.db.QueryRow(
 		query,
 		product.Name,
 		product.Description,
 		product.Price,
-		product.CategoryID).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+		product.CategoryID,
+		product.OrganizationID).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
 
 	if err != nil {
 		return nil, err
@@ -47,16 +80,127 @@ func (r *productRepository) CreateProduct(data *dto.CreateProductRequest) (*mode
 	return product, nil
 }
 
-func (r *productRepository) GetAllProducts() ([]*model.Product, error) {
-	var products []*model.Product
-	err := r.db.Select(&products, "SELECT * FROM products")
-	return products, err
+func (r *productRepository) GetProducts(filter model.ProductFilter, sort model.ProductSort, after *model.ProductCursor, limit, offset int) ([]*model.Product, error) {
+	column, ok := productSortColumns[sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown product sort field %q", sort.Field)
+	}
+	direction, comparison := "ASC", ">"
+	if sort.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions, args := productFilterConditions(filter)
+	if after != nil {
+		args = append(args, after.Value, after.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)",
+			column.name, comparison, len(args)-1, column.castTo, len(args)))
+		offset = 0
+	}
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(
+		"SELECT"+productColumns+" FROM products %s ORDER BY %s %s, id %s LIMIT $%d OFFSET $%d",
+		whereClause(conditions), column.name, direction, direction, len(args)-1, len(args),
+	)
+
+	products := []*model.Product{}
+	if err := r.db.Select(&products, query, args...); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *productRepository) CountProducts(filter model.ProductFilter) (int, error) {
+	conditions, args := productFilterConditions(filter)
+
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM products "+whereClause(conditions), args...)
+	return count, err
+}
+
+func (r *productRepository) CountFacets(filter model.ProductFilter, priceBuckets []float64) ([]*model.ProductFacetCount, error) {
+	filter.CategoryID = 0
+	conditions, args := productFilterConditions(filter)
+
+	bounds := make([]string, 0, len(priceBuckets))
+	for _, bound := range priceBuckets {
+		bounds = append(bounds, strconv.FormatFloat(bound, 'f', -1, 64))
+	}
+	args = append(args, "{"+strings.Join(bounds, ",")+"}")
+
+	// categories share column names with products, the filter applies to
+	// the subquery alone
+	query := fmt.Sprintf(`
+		SELECT p.category_id, c.name AS category_name,
+			width_bucket(p.price, $%d::numeric[]) AS price_bucket,
+			p.price > 0 AS has_price,
+			COALESCE(p.description, '') <> '' AS has_description,
+			COUNT(*) AS count
+		FROM (SELECT category_id, price, description FROM products %s) p
+		LEFT JOIN categories c ON c.id = p.category_id
+		GROUP BY 1, 2, 3, 4, 5`,
+		len(args), whereClause(conditions),
+	)
+
+	counts := []*model.ProductFacetCount{}
+	if err := r.db.Select(&counts, query, args...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (r *productRepository) SuggestProducts(text, organizationID string, limit int) ([]*model.Suggestion, error) {
+	return suggest(r.db, "products", text, organizationID, false, limit)
+}
+
+func (r *productRepository) SearchProducts(text string, filter model.ProductFilter, limit, offset int) ([]*model.ProductSearchResult, error) {
+	conditions, args := productFilterConditions(filter)
+	args = append(args, text)
+	conditions = append(conditions, "search_vector @@ q")
+	args = append(args, limit, offset, searchHighlightOptions)
+
+	// snippets are only made for the page, ts_headline reads the whole text
+	query := fmt.Sprintf(`
+		SELECT p.*,
+			ts_headline('english', p.name, q, 'HighlightAll=true, ' || $%[2]d) AS name_highlight,
+			ts_headline('english', COALESCE(p.description, ''), q, 'MaxFragments=2, MaxWords=20, MinWords=5, ' || $%[2]d) AS description_highlight
+		FROM (
+			SELECT %[3]s, ts_rank(search_vector, q) AS rank
+			FROM products, websearch_to_tsquery('english', $%[1]d) q
+			%[4]s
+			ORDER BY rank DESC, id LIMIT $%[5]d OFFSET $%[6]d
+		) p, websearch_to_tsquery('english', $%[1]d) q
+		ORDER BY p.rank DESC, p.id`,
+		len(args)-3, len(args), productColumns, whereClause(conditions), len(args)-2, len(args)-1,
+	)
+
+	results := []*model.ProductSearchResult{}
+	if err := r.db.Select(&results, query, args...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *productRepository) CountSearchResults(text string, filter model.ProductFilter) (int, error) {
+	conditions, args := productFilterConditions(filter)
+	args = append(args, text)
+	conditions = append(conditions, "search_vector @@ q")
+
+	query := fmt.Sprintf(
+		"SELECT COUNT(*) FROM products, websearch_to_tsquery('english', $%d) q %s",
+		len(args), whereClause(conditions),
+	)
+
+	var count int
+	err := r.db.Get(&count, query, args...)
+	return count, err
 }
 
 func (r *productRepository) GetProductByID(id int) (*model.Product, error) {
 	var product model.Product
 
-	err := r.db.Get(&product, "SELECT * FROM products WHERE id = $1", id)
+	err := r.db.Get(&product, "SELECT"+productColumns+" FROM products WHERE id = $1", id)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -64,21 +208,102 @@ func (r *productRepository) GetProductByID(id int) (*model.Product, error) {
 	return &product, err
 }
 
-func (r *productRepository) UpdateProduct(id int, data *dto.UpdateProductRequest) error {
-	query := `UPDATE products SET name = $1, description = $2, price = $3, category_id = $4, updated_at = NOW() WHERE id = $5`
-	_, err := r.db.Exec(
+func (r *productRepository) UpdateProduct(id int, data *dto.UpdateProductRequest, organizationID string) error {
+	query := `UPDATE products SET name = $1, description = $2, price = $3, category_id = $4, updated_at = NOW() WHERE id = $5 AND ($6 = '' OR organization_id = NULLIF($6, '')::uuid)`
+	result, err := r.db.Exec(
 		query,
 		data.Name,
 		data.Description,
 		data.Price,
 		data.CategoryID,
 		id,
+		organizationID,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return checkRowAffected(result)
 }
 
-func (r *productRepository) DeleteProduct(id int) error {
-	_, err := r.db.Exec("DELETE FROM products WHERE id=$1", id)
-	return err
+func (r *productRepository) DeleteProduct(id int, organizationID string) error {
+	result, err := r.db.Exec("DELETE FROM products WHERE id=$1 AND ($2 = '' OR organization_id = NULLIF($2, '')::uuid)", id, organizationID)
+	if err != nil {
+		return err
+	}
+	return checkRowAffected(result)
+}
+
+// productSortColumns maps the model.ProductSortFields to their column and
+// the type cursor values are compared as.
+var productSortColumns = map[string]struct{ name, castTo string }{
+	"id":         {"id", "integer"},
+	"name":       {"name", "text"},
+	"price":      {"price", "numeric"},
+	"created_at": {"created_at", "timestamp"},
+}
+
+// likeEscaper escapes the LIKE wildcards in user supplied search terms.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func productFilterConditions(filter model.ProductFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.OrganizationID != "" {
+		args = append(args, filter.OrganizationID)
+		conditions = append(conditions, fmt.Sprintf("organization_id = $%d::uuid", len(args)))
+	}
+	if filter.CategoryID > 0 {
+		args = append(args, filter.CategoryID)
+		conditions = append(conditions, fmt.Sprintf("category_id = $%d", len(args)))
+	}
+	if filter.MinPrice > 0 {
+		args = append(args, filter.MinPrice)
+		conditions = append(conditions, fmt.Sprintf("price >= $%d", len(args)))
+	}
+	if filter.MaxPrice > 0 {
+		args = append(args, filter.MaxPrice)
+		conditions = append(conditions, fmt.Sprintf("price <= $%d", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Search)+"%")
+		conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", len(args)))
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// suggest matches names of table with the trigram index on name. word
+// similarity (<%) tolerates typos in the typed words, ILIKE catches
+// prefixes too short to have trigrams in common. With shared, rows of no
+// organization match an organization filter too.
+func suggest(db *sqlx.DB, table, text, organizationID string, shared bool, limit int) ([]*model.Suggestion, error) {
+	escaped := likeEscaper.Replace(text)
+
+	organizationCondition := "$4 = '' OR organization_id = NULLIF($4, '')::uuid"
+	if shared {
+		organizationCondition += " OR organization_id IS NULL"
+	}
+	query := fmt.Sprintf(`
+		SELECT id, name FROM %s
+		WHERE (name ILIKE $2 OR $1 <%% name) AND (%s)
+		ORDER BY name ILIKE $3 DESC, word_similarity($1, name) DESC, name, id
+		LIMIT $5`,
+		table, organizationCondition,
+	)
+
+	suggestions := []*model.Suggestion{}
+	err := db.Select(&suggestions, query, text, "%"+escaped+"%", escaped+"%", organizationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return suggestions, nil
 }
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"database/sql"
+	"errors"
+
 	"github.com/ecomz/backend/libs/logger"
 	"github.com/ecomz/backend/product-service/internal/dto"
 	"github.com/ecomz/backend/product-service/internal/model"
@@ -8,12 +11,16 @@ import (
 	"go.uber.org/zap"
 )
 
+var ErrCategoryNotFound = errors.New("category not found")
+
+// CategoryService creates, updates and deletes the categories of
+// organizationID, or platform categories when it is empty.
 type CategoryService interface {
-	CreateCategory(data *dto.CreateCategoryRequest) (*model.Category, error)
-	GetAllCategories() ([]*model.Category, error)
+	CreateCategory(data *dto.CreateCategoryRequest, organizationID string) (*model.Category, error)
+	GetAllCategories(organizationID string) ([]*model.Category, error)
 	GetCategoryByID(id int) (*model.Category, error)
-	UpdateCategory(id int, data *dto.UpdateCategoryRequest) error
-	DeleteCategory(id int) error
+	UpdateCategory(id int, data *dto.UpdateCategoryRequest, organizationID string) error
+	DeleteCategory(id int, organizationID string) error
 }
 
 type categoryService struct {
@@ -28,8 +35,8 @@ func NewCategoryService(logger logger.Logger, categoryRepository repository.Cate
 	}
 }
 
-func (c *categoryService) CreateCategory(data *dto.CreateCategoryRequest) (*model.Category, error) {
-	category, err := c.repo.CreateCategory(data)
+func (c *categoryService) CreateCategory(data *dto.CreateCategoryRequest, organizationID string) (*model.Category, error) {
+	category, err := c.repo.CreateCategory(data, organizationID)
 	if err != nil {
 		c.logger.Error("failed to create category", zap.Error(err))
 		return nil, err
@@ -38,8 +45,8 @@ func (c *categoryService) CreateCategory(data *dto.CreateCategoryRequest) (*mode
 	return category, err
 }
 
-func (c *categoryService) GetAllCategories() ([]*model.Category, error) {
-	categories, err := c.repo.GetAllCategories()
+func (c *categoryService) GetAllCategories(organizationID string) ([]*model.Category, error) {
+	categories, err := c.repo.GetAllCategories(organizationID)
 	if err != nil {
 		c.logger.Error("failed to get all categories", zap.Error(err))
 		return nil, err
@@ -57,8 +64,11 @@ func (c *categoryService) GetCategoryByID(id int) (*model.Category, error) {
 	return category, err
 }
 
-func (c *categoryService) UpdateCategory(id int, data *dto.UpdateCategoryRequest) error {
-	if err := c.repo.UpdateCategory(id, data); err != nil {
+func (c *categoryService) UpdateCategory(id int, data *dto.UpdateCategoryRequest, organizationID string) error {
+	if err := c.repo.UpdateCategory(id, data, organizationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCategoryNotFound
+		}
 		c.logger.Error("failed to update category", zap.Error(err), zap.Int("id", id))
 		return err
 	}
@@ -66,8 +76,11 @@ func (c *categoryService) UpdateCategory(id int, data *dto.UpdateCategoryRequest
 	return nil
 }
 
-func (c *categoryService) DeleteCategory(id int) error {
-	if err := c.repo.DeleteCategory(id); err != nil {
+func (c *categoryService) DeleteCategory(id int, organizationID string) error {
+	if err := c.repo.DeleteCategory(id, organizationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCategoryNotFound
+		}
 		c.logger.Error("failed to update category", zap.Error(err), zap.Int("id", id))
 		return err
 	}
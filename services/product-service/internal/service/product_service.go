@@ -1,35 +1,88 @@
 package service
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecomz/backend/libs/config"
 	"github.com/ecomz/backend/libs/logger"
+	"github.com/ecomz/backend/libs/utils"
 	"github.com/ecomz/backend/product-service/internal/dto"
 	"github.com/ecomz/backend/product-service/internal/model"
 	"github.com/ecomz/backend/product-service/internal/repository"
+	"github.com/gomodule/redigo/redis"
 	"go.uber.org/zap"
 )
 
+const (
+	productSuggestionLimit  = 8
+	categorySuggestionLimit = 4
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+)
+
+// ProductService creates, updates and deletes the products of
+// organizationID, or platform products when it is empty. Organizations may
+// use platform categories and their own.
 type ProductService interface {
-	CreateProduct(data *dto.CreateProductRequest) (*model.Product, error)
-	GetAllProducts() ([]*model.Product, error)
+	CreateProduct(data *dto.CreateProductRequest, organizationID string) (*model.Product, error)
+	// GetAllProducts returns a page of the listing and where it stands.
+	GetAllProducts(query dto.ProductListQuery) ([]*model.Product, utils.Pagination, error)
+	// GetProductsWithFacets is GetAllProducts that also counts the products
+	// of the listing, all pages, by the configured facets.
+	GetProductsWithFacets(query dto.ProductListQuery) ([]*model.Product, utils.Pagination, *dto.ProductFacets, error)
+	// SearchProducts returns a page of the products matching the query,
+	// best ranked first, with HTML snippets marking the matches.
+	SearchProducts(query dto.ProductSearchQuery) ([]*model.ProductSearchResult, utils.Pagination, error)
+	// Suggest autocompletes product and category names. Suggestions are
+	// cached by the normalized text, so they lag catalogue changes by up to
+	// the configured TTL.
+	Suggest(query dto.SuggestQuery) (*dto.SuggestResponse, error)
 	GetProductByID(id int) (*model.Product, error)
-	UpdateProduct(id int, data *dto.UpdateProductRequest) error
-	DeleteProduct(id int) error
+	UpdateProduct(id int, data *dto.UpdateProductRequest, organizationID string) error
+	DeleteProduct(id int, organizationID string) error
 }
 
 type productService struct {
-	logger logger.Logger
-	repo   repository.ProductRepository
+	logger       logger.Logger
+	repo         repository.ProductRepository
+	categoryRepo repository.CategoryRepository
+	catalog      config.CatalogConfig
+	cache        utils.CacheService
 }
 
-func NewProductService(logger logger.Logger, productRepository repository.ProductRepository) ProductService {
+func NewProductService(logger logger.Logger, productRepository repository.ProductRepository, categoryRepository repository.CategoryRepository, catalog config.CatalogConfig, cache utils.CacheService) ProductService {
+	for _, facet := range catalog.Facets {
+		if !slices.Contains([]string{model.FacetCategory, model.FacetPrice, model.FacetHasPrice, model.FacetHasDescription}, facet) {
+			logger.Warn("ignoring unknown facet", zap.String("facet", facet))
+		}
+	}
+
 	return &productService{
-		logger: logger,
-		repo:   productRepository,
+		logger:       logger,
+		repo:         productRepository,
+		categoryRepo: categoryRepository,
+		catalog:      catalog,
+		cache:        cache,
 	}
 }
 
-func (c *productService) CreateProduct(data *dto.CreateProductRequest) (*model.Product, error) {
-	product, err := c.repo.CreateProduct(data)
+func (c *productService) CreateProduct(data *dto.CreateProductRequest, organizationID string) (*model.Product, error) {
+	if err := c.checkCategory(data.CategoryID, organizationID); err != nil {
+		return nil, err
+	}
+
+	product, err := c.repo.CreateProduct(data, organizationID)
 	if err != nil {
 		c.logger.Error("failed to create product", zap.Error(err))
 		return nil, err
@@ -38,14 +91,166 @@ func (c *productService) CreateProduct(data *dto.CreateProductRequest) (*model.P
 	return product, err
 }
 
-func (c *productService) GetAllProducts() ([]*model.Product, error) {
-	products, err := c.repo.GetAllProducts()
+func (c *productService) GetAllProducts(query dto.ProductListQuery) ([]*model.Product, utils.Pagination, error) {
+	filter := productListFilter(query)
+
+	total, err := c.repo.CountProducts(filter)
+	if err != nil {
+		c.logger.Error("failed to count products", zap.Error(err))
+		return nil, utils.Pagination{}, err
+	}
+
+	return c.productPage(query, filter, total)
+}
+
+func (c *productService) GetProductsWithFacets(query dto.ProductListQuery) ([]*model.Product, utils.Pagination, *dto.ProductFacets, error) {
+	filter := productListFilter(query)
+
+	counts, err := c.repo.CountFacets(filter, c.catalog.PriceBuckets)
+	if err != nil {
+		c.logger.Error("failed to count product facets", zap.Error(err))
+		return nil, utils.Pagination{}, nil, err
+	}
+
+	// the counts ignore the category filter, which only narrows the other
+	// facets. Every product falls into exactly one group, so the groups of
+	// the category add up to the total and the listing needs no count of
+	// its own.
+	matching := counts
+	if filter.CategoryID > 0 {
+		matching = slices.DeleteFunc(slices.Clone(counts), func(count *model.ProductFacetCount) bool {
+			return count.CategoryID != filter.CategoryID
+		})
+	}
+	total := 0
+	for _, count := range matching {
+		total += count.Count
+	}
+
+	products, pagination, err := c.productPage(query, filter, total)
+	if err != nil {
+		return nil, pagination, nil, err
+	}
+
+	facets := &dto.ProductFacets{}
+	for _, facet := range c.catalog.Facets {
+		switch facet {
+		case model.FacetCategory:
+			facets.Categories = categoryFacets(counts)
+		case model.FacetPrice:
+			facets.Price = priceFacets(matching, c.catalog.PriceBuckets)
+		case model.FacetHasPrice:
+			facets.HasPrice = flagFacet(matching, func(count *model.ProductFacetCount) bool { return count.HasPrice })
+		case model.FacetHasDescription:
+			facets.HasDescription = flagFacet(matching, func(count *model.ProductFacetCount) bool { return count.HasDescription })
+		}
+	}
+	return products, pagination, facets, nil
+}
+
+// productPage returns the page of the listing query asks for, of total
+// products.
+func (c *productService) productPage(query dto.ProductListQuery, filter model.ProductFilter, total int) ([]*model.Product, utils.Pagination, error) {
+	pagination := utils.Pagination{Limit: query.Limit, Total: total}
+	sort := model.ProductSort{Field: query.Sort, Desc: query.Order == "desc"}
+
+	var after *model.ProductCursor
+	if query.Cursor != "" {
+		cursor, err := decodeProductCursor(query.Cursor, sort)
+		if err != nil {
+			return nil, pagination, err
+		}
+		after = cursor
+	} else {
+		pagination.Page = query.Page
+	}
+
+	// one more product tells whether there is a next page
+	products, err := c.repo.GetProducts(filter, sort, after, query.Limit+1, (query.Page-1)*query.Limit)
 	if err != nil {
 		c.logger.Error("failed to get all products", zap.Error(err))
-		return nil, err
+		return nil, pagination, err
+	}
+	if len(products) > query.Limit {
+		products = products[:query.Limit]
+		pagination.NextCursor = encodeProductCursor(products[len(products)-1], sort)
 	}
+
 	c.logger.Info("successfuly to get all products")
-	return products, err
+	return products, pagination, nil
+}
+
+func productListFilter(query dto.ProductListQuery) model.ProductFilter {
+	return model.ProductFilter{
+		OrganizationID: query.OrganizationID,
+		CategoryID:     query.CategoryID,
+		MinPrice:       query.MinPrice,
+		MaxPrice:       query.MaxPrice,
+		Search:         query.Search,
+	}
+}
+
+func (c *productService) SearchProducts(query dto.ProductSearchQuery) ([]*model.ProductSearchResult, utils.Pagination, error) {
+	pagination := utils.Pagination{Page: query.Page, Limit: query.Limit}
+
+	filter := model.ProductFilter{
+		OrganizationID: query.OrganizationID,
+		CategoryID:     query.CategoryID,
+	}
+
+	total, err := c.repo.CountSearchResults(query.Query, filter)
+	if err != nil {
+		c.logger.Error("failed to count search results", zap.Error(err))
+		return nil, pagination, err
+	}
+	pagination.Total = total
+
+	results, err := c.repo.SearchProducts(query.Query, filter, query.Limit, (query.Page-1)*query.Limit)
+	if err != nil {
+		c.logger.Error("failed to search products", zap.Error(err), zap.String("query", query.Query))
+		return nil, pagination, err
+	}
+
+	for _, result := range results {
+		result.NameHighlight = highlight(result.NameHighlight)
+		result.DescriptionHighlight = highlight(result.DescriptionHighlight)
+	}
+	return results, pagination, nil
+}
+
+func (c *productService) Suggest(query dto.SuggestQuery) (*dto.SuggestResponse, error) {
+	text := strings.Join(strings.Fields(strings.ToLower(query.Query)), " ")
+	key := suggestionKey(query.OrganizationID, text)
+
+	// the cache only speeds things up, Redis failures fall back to the
+	// database
+	if cached, err := c.cache.Get(key); err == nil {
+		var res dto.SuggestResponse
+		if err := json.Unmarshal(cached, &res); err == nil {
+			return &res, nil
+		}
+	} else if !errors.Is(err, redis.ErrNil) {
+		c.logger.Warn("failed to get cached suggestions", zap.Error(err))
+	}
+
+	products, err := c.repo.SuggestProducts(text, query.OrganizationID, productSuggestionLimit)
+	if err != nil {
+		c.logger.Error("failed to suggest products", zap.Error(err))
+		return nil, err
+	}
+	categories, err := c.categoryRepo.SuggestCategories(text, query.OrganizationID, categorySuggestionLimit)
+	if err != nil {
+		c.logger.Error("failed to suggest categories", zap.Error(err))
+		return nil, err
+	}
+
+	res := &dto.SuggestResponse{Products: products, Categories: categories}
+	if value, err := json.Marshal(res); err == nil {
+		if err := c.cache.Set(key, value, int64(c.catalog.SuggestCacheTTL.Seconds())); err != nil {
+			c.logger.Warn("failed to cache suggestions", zap.Error(err))
+		}
+	}
+	return res, nil
 }
 
 func (c *productService) GetProductByID(id int) (*model.Product, error) {
@@ -57,8 +262,17 @@ func (c *productService) GetProductByID(id int) (*model.Product, error) {
 	return product, err
 }
 
-func (c *productService) UpdateProduct(id int, data *dto.UpdateProductRequest) error {
-	if err := c.repo.UpdateProduct(id, data); err != nil {
+func (c *productService) UpdateProduct(id int, data *dto.UpdateProductRequest, organizationID string) error {
+	if data.CategoryID != 0 {
+		if err := c.checkCategory(data.CategoryID, organizationID); err != nil {
+			return err
+		}
+	}
+
+	if err := c.repo.UpdateProduct(id, data, organizationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
 		c.logger.Error("failed to update product", zap.Error(err), zap.Int("id", id))
 		return err
 	}
@@ -66,11 +280,162 @@ func (c *productService) UpdateProduct(id int, data *dto.UpdateProductRequest) e
 	return nil
 }
 
-func (c *productService) DeleteProduct(id int) error {
-	if err := c.repo.DeleteProduct(id); err != nil {
+func (c *productService) DeleteProduct(id int, organizationID string) error {
+	if err := c.repo.DeleteProduct(id, organizationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
 		c.logger.Error("failed to update product", zap.Error(err), zap.Int("id", id))
 		return err
 	}
 	c.logger.Info("successfuly to update product", zap.Int("id", id))
 	return nil
 }
+
+// checkCategory makes sure the category exists and, for an organization, is
+// a platform category or one of its own.
+func (c *productService) checkCategory(categoryID int, organizationID string) error {
+	category, err := c.categoryRepo.GetCategoryByID(categoryID)
+	if err != nil {
+		c.logger.Error("failed to get category by id", zap.Error(err), zap.Int("id", categoryID))
+		return err
+	}
+	if category == nil {
+		return ErrCategoryNotFound
+	}
+	if organizationID != "" && category.OrganizationID != nil && *category.OrganizationID != organizationID {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// productCursor is encoded into the opaque cursor of the listing.
+type productCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeProductCursor(product *model.Product, sort model.ProductSort) string {
+	var value string
+	switch sort.Field {
+	case "name":
+		value = product.Name
+	case "price":
+		value = strconv.FormatFloat(product.Price, 'f', -1, 64)
+	case "created_at":
+		value = product.CreatedAt
+	default:
+		value = strconv.Itoa(product.ID)
+	}
+
+	data, _ := json.Marshal(productCursor{Sort: sort.Field, Desc: sort.Desc, Value: value, ID: product.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeProductCursor rejects cursors of listings in another order, their
+// position means nothing in this one.
+func decodeProductCursor(encoded string, sort model.ProductSort) (*model.ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor productCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort.Field || cursor.Desc != sort.Desc {
+		return nil, ErrInvalidCursor
+	}
+	if err := validateCursorValue(cursor.Sort, cursor.Value); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &model.ProductCursor{Value: cursor.Value, ID: cursor.ID}, nil
+}
+
+// validateCursorValue makes sure the value casts to the type of the sort
+// column, a failing cast would be a database error.
+func validateCursorValue(field, value string) error {
+	var err error
+	switch field {
+	case "price":
+		_, err = strconv.ParseFloat(value, 64)
+	case "created_at":
+		_, err = time.Parse(time.RFC3339Nano, value)
+	case "id":
+		_, err = strconv.Atoi(value)
+	}
+	return err
+}
+
+var highlightReplacer = strings.NewReplacer(model.HighlightStart, "<mark>", model.HighlightStop, "</mark>")
+
+// highlight turns a snippet into HTML, the product text is escaped.
+func highlight(snippet string) string {
+	return highlightReplacer.Replace(html.EscapeString(snippet))
+}
+
+// categoryFacets lists the categories with products, the largest first.
+// They are counted without the category filter, so a listing filtered by
+// one category still offers the others.
+func categoryFacets(counts []*model.ProductFacetCount) []dto.CategoryFacet {
+	byID := map[int]*dto.CategoryFacet{}
+	facets := []dto.CategoryFacet{}
+	for _, count := range counts {
+		facet, ok := byID[count.CategoryID]
+		if !ok {
+			facet = &dto.CategoryFacet{ID: count.CategoryID, Name: count.CategoryName.String}
+			byID[count.CategoryID] = facet
+		}
+		facet.Count += count.Count
+	}
+	for _, facet := range byID {
+		facets = append(facets, *facet)
+	}
+
+	slices.SortFunc(facets, func(a, b dto.CategoryFacet) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return a.ID - b.ID
+	})
+	return facets
+}
+
+// priceFacets returns every bucket, empty ones included, so the ranges stay
+// the same across filters. Prices below the first bound are not counted.
+func priceFacets(counts []*model.ProductFacetCount, bounds []float64) []dto.PriceBucketFacet {
+	facets := make([]dto.PriceBucketFacet, len(bounds))
+	for i, bound := range bounds {
+		facets[i].Min = bound
+		if i+1 < len(bounds) {
+			facets[i].Max = &bounds[i+1]
+		}
+	}
+
+	for _, count := range counts {
+		if count.PriceBucket >= 1 && count.PriceBucket <= len(facets) {
+			facets[count.PriceBucket-1].Count += count.Count
+		}
+	}
+	return facets
+}
+
+func flagFacet(counts []*model.ProductFacetCount, flag func(*model.ProductFacetCount) bool) *dto.FlagFacet {
+	facet := &dto.FlagFacet{}
+	for _, count := range counts {
+		if flag(count) {
+			facet.True += count.Count
+		} else {
+			facet.False += count.Count
+		}
+	}
+	return facet
+}
+
+func suggestionKey(organizationID, text string) string {
+	return "product_suggest:" + organizationID + ":" + text
+}
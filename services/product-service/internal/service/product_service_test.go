@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ecomz/backend/product-service/internal/model"
+)
+
+func TestProductCursorRoundTrip(t *testing.T) {
+	// database/sql formats scanned timestamps with time.RFC3339Nano
+	createdAt := time.Date(2025, 6, 1, 12, 30, 45, 123456000, time.UTC).Format(time.RFC3339Nano)
+	product := &model.Product{ID: 42, Name: "Tea, green", Price: 9.95, CreatedAt: createdAt}
+
+	tests := []struct {
+		sort      model.ProductSort
+		wantValue string
+	}{
+		{model.ProductSort{Field: "id"}, "42"},
+		{model.ProductSort{Field: "name"}, "Tea, green"},
+		{model.ProductSort{Field: "price", Desc: true}, "9.95"},
+		{model.ProductSort{Field: "created_at", Desc: true}, createdAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort.Field, func(t *testing.T) {
+			cursor, err := decodeProductCursor(encodeProductCursor(product, tt.sort), tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor.Value != tt.wantValue || cursor.ID != product.ID {
+				t.Errorf("cursor = %+v, want value %q and id %d", *cursor, tt.wantValue, product.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeProductCursorRejectsOtherOrder(t *testing.T) {
+	product := &model.Product{ID: 42, Name: "Tea", Price: 9.95}
+	encoded := encodeProductCursor(product, model.ProductSort{Field: "price"})
+
+	tests := []struct {
+		name string
+		sort model.ProductSort
+	}{
+		{"other field", model.ProductSort{Field: "name"}},
+		{"other direction", model.ProductSort{Field: "price", Desc: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeProductCursor(encoded, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestDecodeProductCursorRejectsMalformed(t *testing.T) {
+	encode := func(data string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(data))
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		sort    model.ProductSort
+	}{
+		{"not base64", "!!!", model.ProductSort{Field: "id"}},
+		{"not json", encode("cursor"), model.ProductSort{Field: "id"}},
+		{"wrong type", encode(`{"s":"id","v":1,"id":1}`), model.ProductSort{Field: "id"}},
+		{"bad id value", encode(`{"s":"id","v":"one","id":1}`), model.ProductSort{Field: "id"}},
+		{"bad price value", encode(`{"s":"price","v":"cheap","id":1}`), model.ProductSort{Field: "price"}},
+		{"bad created_at value", encode(`{"s":"created_at","v":"2025-06-01","id":1}`), model.ProductSort{Field: "created_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeProductCursor(tt.encoded, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestValidateCursorValue(t *testing.T) {
+	tests := []struct {
+		field, value string
+		wantErr      bool
+	}{
+		{"id", "42", false},
+		{"id", "4.2", true},
+		{"id", "", true},
+		{"price", "9.95", false},
+		{"price", "1e3", false},
+		{"price", "9,95", true},
+		{"created_at", "2025-06-01T12:30:45.123456Z", false},
+		{"created_at", "2025-06-01T12:30:45+02:00", false},
+		{"created_at", "2025-06-01 12:30:45", true},
+		{"name", "anything goes", false},
+		{"name", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+"/"+tt.value, func(t *testing.T) {
+			if err := validateCursorValue(tt.field, tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}